@@ -0,0 +1,323 @@
+package ahttp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/argon2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	DefaultAPIKeyHeader = "X-API-Key"
+	// APIKeyKey is the gin key of the APIKey of a request authenticated by APIKeyMiddleware.
+	APIKeyKey = "ahttp.apiKey"
+)
+
+var (
+	ErrMissingAPIKey = errors.New("missing api key")
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	ErrAPIKeyExpired = errors.New("api key expired")
+	ErrUnknownAPIKey = errors.New("unknown api key")
+)
+
+// APIKey is the stored part of an API key. Keys are given to clients as "<id>.<secret>", and only the hash of
+// the secret is stored.
+type APIKey struct {
+	ID   string
+	Hash []byte
+
+	// Owner is the subject of the principal of the key.
+	Owner  string
+	Scopes []string
+	// Tier is the rate limit tier of the key. It is not used by the package, see RateLimitByAPIKey.
+	Tier string
+	// ExpiresAt is the zero time if the key does not expire.
+	ExpiresAt time.Time
+}
+
+// APIKeyHasher hashes the secrets of API keys.
+type APIKeyHasher interface {
+	Hash(secret string) ([]byte, error)
+	// Verify compares a secret to a hash in constant time.
+	Verify(secret string, hash []byte) bool
+}
+
+type hmacAPIKeyHasher struct {
+	pepper []byte
+}
+
+func (hasher *hmacAPIKeyHasher) Hash(secret string) ([]byte, error) {
+	mac := hmac.New(sha256.New, hasher.pepper)
+	mac.Write([]byte(secret))
+
+	return mac.Sum(nil), nil
+}
+
+func (hasher *hmacAPIKeyHasher) Verify(secret string, hash []byte) bool {
+	expected, _ := hasher.Hash(secret)
+	return hmac.Equal(expected, hash)
+}
+
+// NewHMACAPIKeyHasher hashes secrets with HMAC-SHA256, keyed by a pepper that is kept out of the key store. It
+// is fast, so secrets must be random, as the ones of NewAPIKey are.
+func NewHMACAPIKeyHasher(pepper []byte) APIKeyHasher {
+	return &hmacAPIKeyHasher{pepper: pepper}
+}
+
+// Argon2Params are the parameters of argon2id. See the recommendations of RFC 9106.
+type Argon2Params struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	KeyLen  uint32
+	SaltLen uint32
+}
+
+var DefaultArgon2Params = Argon2Params{Time: 1, Memory: 64 * 1024, Threads: 4, KeyLen: 32, SaltLen: 16}
+
+type argon2APIKeyHasher struct {
+	params Argon2Params
+}
+
+// Hash returns a hash in the PHC string format, so the parameters can change without invalidating existing
+// keys.
+func (hasher *argon2APIKeyHasher) Hash(secret string) ([]byte, error) {
+	salt := make([]byte, hasher.params.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generate salt: %w", err)
+	}
+
+	params := hasher.params
+	key := argon2.IDKey([]byte(secret), salt, params.Time, params.Memory, params.Threads, params.KeyLen)
+
+	return []byte(fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Memory, params.Time, params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	)), nil
+}
+
+func (hasher *argon2APIKeyHasher) Verify(secret string, hash []byte) bool {
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != "argon2id" || parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return false
+	}
+
+	var params Argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return false
+	}
+
+	salt, err := base64.RawStdEncoding.Strict().DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+
+	expected, err := base64.RawStdEncoding.Strict().DecodeString(parts[5])
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+
+	key := argon2.IDKey([]byte(secret), salt, params.Time, params.Memory, params.Threads, uint32(len(expected)))
+
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
+
+// NewArgon2APIKeyHasher hashes secrets with argon2id. Zero params default to DefaultArgon2Params.
+func NewArgon2APIKeyHasher(params Argon2Params) APIKeyHasher {
+	if params == (Argon2Params{}) {
+		params = DefaultArgon2Params
+	}
+
+	return &argon2APIKeyHasher{params: params}
+}
+
+// NewAPIKey generates a random key. The key is returned to the client once, and the APIKey, which only holds
+// the hash of its secret, is saved to the store after its other fields are set.
+func NewAPIKey(hasher APIKeyHasher) (string, *APIKey, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, fmt.Errorf("generate id: %w", err)
+	}
+
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, fmt.Errorf("generate secret: %w", err)
+	}
+
+	apiKey := &APIKey{ID: hex.EncodeToString(id)}
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+
+	hash, err := hasher.Hash(encodedSecret)
+	if err != nil {
+		return "", nil, fmt.Errorf("hash secret: %w", err)
+	}
+
+	apiKey.Hash = hash
+
+	return apiKey.ID + "." + encodedSecret, apiKey, nil
+}
+
+// APIKeyStore holds the API keys.
+type APIKeyStore interface {
+	// APIKey returns the key with the given ID, or ErrUnknownAPIKey.
+	APIKey(ctx context.Context, id string) (*APIKey, error)
+}
+
+// MemoryAPIKeyStore is an APIKeyStore for a small, static set of keys, such as keys loaded from configuration.
+type MemoryAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]*APIKey
+}
+
+func NewMemoryAPIKeyStore(keys ...*APIKey) *MemoryAPIKeyStore {
+	store := &MemoryAPIKeyStore{keys: make(map[string]*APIKey, len(keys))}
+	for _, key := range keys {
+		store.Add(key)
+	}
+
+	return store
+}
+
+func (store *MemoryAPIKeyStore) Add(key *APIKey) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.keys[key.ID] = key
+}
+
+func (store *MemoryAPIKeyStore) Remove(id string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.keys, id)
+}
+
+func (store *MemoryAPIKeyStore) APIKey(_ context.Context, id string) (*APIKey, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	key, ok := store.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAPIKey, id)
+	}
+
+	return key, nil
+}
+
+type APIKeyConfig struct {
+	Store  APIKeyStore
+	Hasher APIKeyHasher
+
+	// Header carries the key. Defaults to DefaultAPIKeyHeader.
+	Header string
+	// QueryParam carries the key when the header is absent, if set. Its value is redacted from the report of
+	// the request.
+	QueryParam string
+
+	// Optional lets requests without a key through, without a principal.
+	Optional bool
+}
+
+// verifyAPIKey returns the stored key of a raw key. Errors that are not ErrInvalidAPIKey or ErrAPIKeyExpired are
+// returned by the store, as is.
+func verifyAPIKey(ctx context.Context, config APIKeyConfig, raw string) (*APIKey, error) {
+	id, secret, ok := strings.Cut(raw, ".")
+	if !ok || id == "" || secret == "" {
+		return nil, ErrInvalidAPIKey
+	}
+
+	apiKey, err := config.Store.APIKey(ctx, id)
+	if errors.Is(err, ErrUnknownAPIKey) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !config.Hasher.Verify(secret, apiKey.Hash) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if !apiKey.ExpiresAt.IsZero() && !time.Now().Before(apiKey.ExpiresAt) {
+		return nil, ErrAPIKeyExpired
+	}
+
+	return apiKey, nil
+}
+
+// APIKeyMiddleware authenticates requests with API keys. The key is stored in gin, under APIKeyKey, and its
+// principal is set like the one of JWTVerifier, with the owner of the key as subject.
+//
+// Invalid keys are rejected with a 401 status. The key never appears in errors, or in the report of the request.
+func APIKeyMiddleware(config APIKeyConfig) gin.HandlerFunc {
+	if config.Header == "" {
+		config.Header = DefaultAPIKeyHeader
+	}
+
+	return func(ctx *gin.Context) {
+		if config.QueryParam != "" {
+			ctx.Set(reportRedactedQueryKey, append(ctx.GetStringSlice(reportRedactedQueryKey), config.QueryParam))
+		}
+
+		raw := ctx.GetHeader(config.Header)
+		if raw == "" && config.QueryParam != "" {
+			raw = ctx.Query(config.QueryParam)
+		}
+
+		if raw == "" && config.Optional {
+			ctx.Next()
+			return
+		}
+
+		if raw == "" {
+			HandleGRPCErrorProblem(ctx, status.Error(codes.Unauthenticated, ErrMissingAPIKey.Error()))
+			return
+		}
+
+		apiKey, err := verifyAPIKey(ctx.Request.Context(), config, raw)
+		if errors.Is(err, ErrInvalidAPIKey) || errors.Is(err, ErrAPIKeyExpired) {
+			HandleGRPCErrorProblem(ctx, status.Error(codes.Unauthenticated, err.Error()))
+			return
+		}
+
+		if err != nil {
+			HandleGRPCErrorProblem(ctx, err)
+			return
+		}
+
+		ctx.Set(APIKeyKey, apiKey)
+		setPrincipal(ctx, &Principal{
+			Subject: apiKey.Owner,
+			Scopes:  apiKey.Scopes,
+			Claims:  map[string]any{"api_key_id": apiKey.ID, "tier": apiKey.Tier},
+		})
+		ctx.Next()
+	}
+}
+
+// RateLimitByAPIKey limits requests per API key, set by APIKeyMiddleware. Requests without a key are not
+// limited.
+func RateLimitByAPIKey(ctx *gin.Context) string {
+	apiKey, ok := ctx.Get(APIKeyKey)
+	if !ok {
+		return ""
+	}
+
+	return apiKey.(*APIKey).ID
+}
@@ -0,0 +1,326 @@
+package ahttp_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/a-novel-kit/quicklog"
+	quicklogmocks "github.com/a-novel-kit/quicklog/mocks"
+
+	"github.com/a-novel-kit/ahttp"
+	ahttpmessages "github.com/a-novel-kit/ahttp/messages"
+)
+
+// Cheap parameters, so tests run fast.
+var testArgon2Params = ahttp.Argon2Params{Time: 1, Memory: 1024, Threads: 1, KeyLen: 32, SaltLen: 16}
+
+type apiKeyStoreFunc func(ctx context.Context, id string) (*ahttp.APIKey, error)
+
+func (store apiKeyStoreFunc) APIKey(ctx context.Context, id string) (*ahttp.APIKey, error) {
+	return store(ctx, id)
+}
+
+func TestAPIKeyHashers(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		hasher ahttp.APIKeyHasher
+		other  ahttp.APIKeyHasher
+	}{
+		{
+			name: "HMAC",
+
+			hasher: ahttp.NewHMACAPIKeyHasher([]byte("pepper")),
+			other:  ahttp.NewHMACAPIKeyHasher([]byte("other pepper")),
+		},
+		{
+			name: "Argon2",
+
+			hasher: ahttp.NewArgon2APIKeyHasher(testArgon2Params),
+			// Hashes carry their parameters, so they survive a change of parameters.
+			other: ahttp.NewArgon2APIKeyHasher(ahttp.Argon2Params{Time: 2, Memory: 2048, Threads: 2, KeyLen: 16, SaltLen: 8}),
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			hash, err := testCase.hasher.Hash("secret")
+			require.NoError(t, err)
+
+			require.True(t, testCase.hasher.Verify("secret", hash))
+			require.False(t, testCase.hasher.Verify("secreT", hash))
+			require.False(t, testCase.hasher.Verify("secret", []byte("foo")))
+			require.False(t, testCase.hasher.Verify("secret", nil))
+		})
+	}
+
+	t.Run("HMACPepper", func(t *testing.T) {
+		hash, err := testCases[0].hasher.Hash("secret")
+		require.NoError(t, err)
+		require.False(t, testCases[0].other.Verify("secret", hash))
+	})
+
+	t.Run("Argon2Params", func(t *testing.T) {
+		hash, err := testCases[1].hasher.Hash("secret")
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(string(hash), "$argon2id$v=19$m=1024,t=1,p=1$"))
+		require.True(t, testCases[1].other.Verify("secret", hash))
+
+		hash[len(hash)-10] ^= 1
+		require.False(t, testCases[1].hasher.Verify("secret", hash))
+	})
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	hasher := ahttp.NewArgon2APIKeyHasher(testArgon2Params)
+
+	validKey, valid, err := ahttp.NewAPIKey(hasher)
+	require.NoError(t, err)
+
+	valid.Owner = "billing-service"
+	valid.Scopes = []string{"invoices:read"}
+	valid.Tier = "gold"
+
+	expiredKey, expired, err := ahttp.NewAPIKey(hasher)
+	require.NoError(t, err)
+
+	expired.Owner = "billing-service"
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+
+	store := ahttp.NewMemoryAPIKeyStore(valid, expired)
+
+	validID, _, _ := strings.Cut(validKey, ".")
+
+	testCases := []struct {
+		name string
+
+		store    ahttp.APIKeyStore
+		optional bool
+		header   string
+		query    string
+
+		expectCode   int
+		expectBody   string
+		expectDetail string
+	}{
+		{
+			name: "Header",
+
+			header: validKey,
+
+			expectCode: http.StatusOK,
+			expectBody: "billing-service [invoices:read] gold " + validID,
+		},
+		{
+			name: "Query",
+
+			query: validKey,
+
+			expectCode: http.StatusOK,
+			expectBody: "billing-service [invoices:read] gold " + validID,
+		},
+		{
+			name: "Missing",
+
+			expectCode:   http.StatusUnauthorized,
+			expectDetail: "missing api key",
+		},
+		{
+			name: "Optional",
+
+			optional: true,
+
+			expectCode: http.StatusOK,
+			expectBody: "anonymous",
+		},
+		{
+			name: "WrongSecret",
+
+			header: validID + ".foo",
+
+			expectCode:   http.StatusUnauthorized,
+			expectDetail: "invalid api key",
+		},
+		{
+			name: "UnknownID",
+
+			header: "foo" + validKey,
+
+			expectCode:   http.StatusUnauthorized,
+			expectDetail: "invalid api key",
+		},
+		{
+			name: "Malformed",
+
+			header: validID,
+
+			expectCode:   http.StatusUnauthorized,
+			expectDetail: "invalid api key",
+		},
+		{
+			name: "Expired",
+
+			header: expiredKey,
+
+			expectCode:   http.StatusUnauthorized,
+			expectDetail: "api key expired",
+		},
+		{
+			name: "StoreUnavailable",
+
+			store: apiKeyStoreFunc(func(context.Context, string) (*ahttp.APIKey, error) {
+				return nil, status.Error(codes.Unavailable, "store down")
+			}),
+			header: validKey,
+
+			expectCode:   http.StatusServiceUnavailable,
+			expectDetail: "store down",
+		},
+		{
+			name: "StoreError",
+
+			store: apiKeyStoreFunc(func(context.Context, string) (*ahttp.APIKey, error) {
+				return nil, errors.New("connection reset")
+			}),
+			header: validKey,
+
+			expectCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			config := ahttp.APIKeyConfig{
+				Store:      testCase.store,
+				Hasher:     hasher,
+				QueryParam: "api_key",
+				Optional:   testCase.optional,
+			}
+
+			if config.Store == nil {
+				config.Store = store
+			}
+
+			router := gin.New()
+			router.GET("/foo", ahttp.APIKeyMiddleware(config), func(ctx *gin.Context) {
+				principal, ok := ahttp.PrincipalFromContext(ctx.Request.Context())
+				if !ok {
+					ctx.String(http.StatusOK, "anonymous")
+					return
+				}
+
+				apiKey := ctx.MustGet(ahttp.APIKeyKey).(*ahttp.APIKey)
+				ctx.String(
+					http.StatusOK, "%s %v %s %s",
+					principal.Subject, principal.Scopes, apiKey.Tier, ahttp.RateLimitByAPIKey(ctx),
+				)
+			})
+
+			target := "/foo"
+			if testCase.query != "" {
+				target += "?" + url.Values{"api_key": {testCase.query}}.Encode()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			if testCase.header != "" {
+				req.Header.Set(ahttp.DefaultAPIKeyHeader, testCase.header)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, testCase.expectCode, w.Code)
+
+			if testCase.expectBody != "" {
+				require.Equal(t, testCase.expectBody, w.Body.String())
+				return
+			}
+
+			require.Equal(t, ahttp.ContentTypeProblem, w.Header().Get("Content-Type"))
+			require.Contains(t, w.Body.String(), testCase.expectDetail)
+			require.NotContains(t, w.Body.String(), validKey)
+		})
+	}
+}
+
+func TestAPIKeyMiddlewareReport(t *testing.T) {
+	hasher := ahttp.NewHMACAPIKeyHasher([]byte("pepper"))
+
+	key, apiKey, err := ahttp.NewAPIKey(hasher)
+	require.NoError(t, err)
+
+	apiKey.Owner = "billing-service"
+
+	testCases := []struct {
+		name string
+
+		key string
+
+		expectCode int
+	}{
+		{
+			name: "Valid",
+
+			key: key,
+
+			expectCode: http.StatusOK,
+		},
+		{
+			name: "Invalid",
+
+			key: key + "foo",
+
+			expectCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			logger := quicklogmocks.NewMockLogger(t)
+			logger.
+				On("Log", mock.Anything, mock.Anything).
+				Run(func(args mock.Arguments) {
+					message := args.Get(1).(quicklog.Message)
+
+					report := message.RenderJSON()
+					require.Equal(t, url.Values{
+						"api_key": {ahttpmessages.RedactedValue},
+						"page":    {"2"},
+					}, report["query"])
+					require.NotContains(t, message.RenderTerminal(), testCase.key)
+					require.NotContains(t, report["errors"], testCase.key)
+				}).
+				Once()
+
+			router := gin.New()
+			router.Use(ahttp.ReportMiddleware(logger, ""))
+			router.GET("/foo", ahttp.APIKeyMiddleware(ahttp.APIKeyConfig{
+				Store:      ahttp.NewMemoryAPIKeyStore(apiKey),
+				Hasher:     hasher,
+				QueryParam: "api_key",
+			}), func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+
+			target := "/foo?" + url.Values{"api_key": {testCase.key}, "page": {"2"}}.Encode()
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+
+			require.Equal(t, testCase.expectCode, w.Code)
+			logger.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package ahttp
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	ahttpmessages "github.com/a-novel-kit/ahttp/messages"
+)
+
+// AuthorizationDomain is the domain of the ErrorInfo details of denied requests.
+const AuthorizationDomain = "ahttp"
+
+// Reasons of the ErrorInfo details of denied requests.
+const (
+	AuthorizationReasonUnauthenticated = "UNAUTHENTICATED"
+	AuthorizationReasonMissingScopes   = "MISSING_SCOPES"
+	AuthorizationReasonMissingRole     = "MISSING_ROLE"
+	AuthorizationReasonDenied          = "DENIED"
+)
+
+// Policy describes the principals allowed to access a route. All the conditions that are set must be met.
+type Policy struct {
+	// Scopes must all be granted to the principal.
+	Scopes []string
+	// Roles, if set, must contain one of the roles of the principal (see Principal.Roles).
+	Roles []string
+	// Allow is a custom condition, checked last. Route params are available through ctx.Param, see OwnerOf.
+	Allow func(ctx *gin.Context, principal *Principal) bool
+}
+
+// OwnerOf allows principals whose subject is the value of a route param, for example OwnerOf("id") on
+// "/users/:id".
+func OwnerOf(param string) func(ctx *gin.Context, principal *Principal) bool {
+	return func(ctx *gin.Context, principal *Principal) bool {
+		return principal.Subject != "" && ctx.Param(param) == principal.Subject
+	}
+}
+
+// principalOf returns the principal of a request, set by an authentication middleware of the package or with
+// WithPrincipal.
+func principalOf(ctx *gin.Context) (*Principal, bool) {
+	if principal, ok := ctx.Get(PrincipalKey); ok {
+		return principal.(*Principal), true
+	}
+
+	return PrincipalFromContext(ctx.Request.Context())
+}
+
+// denyAuthorization responds with a PermissionDenied status, carrying an ErrorInfo detail with the reason of the
+// denial. Missing scopes are listed in the metadata of the detail, and in the WWW-Authenticate header.
+func denyAuthorization(ctx *gin.Context, policy Policy, decision *ahttpmessages.AuthorizationMetrics) {
+	ctx.Set(reportAuthorizationKey, decision)
+
+	info := &errdetails.ErrorInfo{Reason: decision.Reason, Domain: AuthorizationDomain}
+	message := "permission denied"
+
+	if len(decision.MissingScopes) > 0 {
+		missingScopes := strings.Join(decision.MissingScopes, " ")
+		info.Metadata = map[string]string{"missingScopes": missingScopes}
+		message = "missing scopes: " + missingScopes
+
+		ctx.Header("WWW-Authenticate", bearerChallenge(
+			"error", AuthErrorInsufficientScope,
+			"error_description", message,
+			"scope", strings.Join(policy.Scopes, " "),
+		))
+	}
+
+	grpcStatus, err := status.New(codes.PermissionDenied, message).WithDetails(info)
+	if err != nil {
+		HandleGRPCErrorProblem(ctx, status.Error(codes.PermissionDenied, message))
+		return
+	}
+
+	HandleGRPCErrorProblem(ctx, grpcStatus.Err())
+}
+
+// Authorize rejects requests whose principal does not satisfy the policy, with a 403 status. Requests without
+// a principal are rejected with a 401 status, so the middleware must run after an authentication middleware.
+//
+// The decision is attached to the report of the request, for auditing.
+func Authorize(policy Policy) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		principal, ok := principalOf(ctx)
+		if !ok {
+			ctx.Set(reportAuthorizationKey, &ahttpmessages.AuthorizationMetrics{
+				Reason: AuthorizationReasonUnauthenticated,
+			})
+			abortUnauthenticated(ctx, "", "", ErrMissingToken)
+
+			return
+		}
+
+		var missingScopes []string
+
+		for _, scope := range policy.Scopes {
+			if !principal.HasScope(scope) {
+				missingScopes = append(missingScopes, scope)
+			}
+		}
+
+		if len(missingScopes) > 0 {
+			denyAuthorization(ctx, policy, &ahttpmessages.AuthorizationMetrics{
+				Reason:        AuthorizationReasonMissingScopes,
+				MissingScopes: missingScopes,
+			})
+
+			return
+		}
+
+		if len(policy.Roles) > 0 && !slices.ContainsFunc(policy.Roles, principal.HasRole) {
+			denyAuthorization(ctx, policy, &ahttpmessages.AuthorizationMetrics{Reason: AuthorizationReasonMissingRole})
+			return
+		}
+
+		if policy.Allow != nil && !policy.Allow(ctx, principal) {
+			denyAuthorization(ctx, policy, &ahttpmessages.AuthorizationMetrics{Reason: AuthorizationReasonDenied})
+			return
+		}
+
+		ctx.Set(reportAuthorizationKey, &ahttpmessages.AuthorizationMetrics{Allowed: true})
+		ctx.Next()
+	}
+}
@@ -0,0 +1,284 @@
+package ahttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a-novel-kit/quicklog"
+	quicklogmocks "github.com/a-novel-kit/quicklog/mocks"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+func TestAuthorize(t *testing.T) {
+	alice := &ahttp.Principal{
+		Subject: "alice",
+		Scopes:  []string{"read", "write"},
+		Claims:  map[string]any{"roles": []any{"editor", "reviewer"}},
+	}
+
+	testCases := []struct {
+		name string
+
+		policy    ahttp.Policy
+		principal *ahttp.Principal
+		path      string
+
+		expectCode      int
+		expectBody      string
+		expectChallenge string
+	}{
+		{
+			name: "Scopes",
+
+			policy:    ahttp.Policy{Scopes: []string{"read", "write"}},
+			principal: alice,
+
+			expectCode: http.StatusOK,
+		},
+		{
+			name: "MissingScopes",
+
+			policy:    ahttp.Policy{Scopes: []string{"read", "admin", "delete"}},
+			principal: alice,
+
+			expectCode: http.StatusForbidden,
+			expectBody: `{
+				"title": "Forbidden",
+				"status": 403,
+				"detail": "missing scopes: admin delete",
+				"code": "PermissionDenied",
+				"details": [{
+					"@type": "type.googleapis.com/google.rpc.ErrorInfo",
+					"reason": "MISSING_SCOPES",
+					"domain": "ahttp",
+					"metadata": {"missingScopes": "admin delete"}
+				}]
+			}`,
+			expectChallenge: `Bearer error="insufficient_scope", error_description="missing scopes: admin delete", ` +
+				`scope="read admin delete"`,
+		},
+		{
+			name: "Role",
+
+			policy:    ahttp.Policy{Roles: []string{"admin", "editor"}},
+			principal: alice,
+
+			expectCode: http.StatusOK,
+		},
+		{
+			name: "MissingRole",
+
+			policy:    ahttp.Policy{Roles: []string{"admin"}},
+			principal: alice,
+
+			expectCode: http.StatusForbidden,
+			expectBody: `{
+				"title": "Forbidden",
+				"status": 403,
+				"detail": "permission denied",
+				"code": "PermissionDenied",
+				"details": [{
+					"@type": "type.googleapis.com/google.rpc.ErrorInfo",
+					"reason": "MISSING_ROLE",
+					"domain": "ahttp"
+				}]
+			}`,
+		},
+		{
+			name: "NoRoles",
+
+			policy:    ahttp.Policy{Roles: []string{"editor"}},
+			principal: &ahttp.Principal{Subject: "bob"},
+
+			expectCode: http.StatusForbidden,
+			expectBody: `{
+				"title": "Forbidden",
+				"status": 403,
+				"detail": "permission denied",
+				"code": "PermissionDenied",
+				"details": [{
+					"@type": "type.googleapis.com/google.rpc.ErrorInfo",
+					"reason": "MISSING_ROLE",
+					"domain": "ahttp"
+				}]
+			}`,
+		},
+		{
+			name: "Owner",
+
+			policy:    ahttp.Policy{Scopes: []string{"read"}, Allow: ahttp.OwnerOf("id")},
+			principal: alice,
+			path:      "/users/alice",
+
+			expectCode: http.StatusOK,
+		},
+		{
+			name: "NotOwner",
+
+			policy:    ahttp.Policy{Allow: ahttp.OwnerOf("id")},
+			principal: alice,
+			path:      "/users/bob",
+
+			expectCode: http.StatusForbidden,
+			expectBody: `{
+				"title": "Forbidden",
+				"status": 403,
+				"detail": "permission denied",
+				"code": "PermissionDenied",
+				"details": [{
+					"@type": "type.googleapis.com/google.rpc.ErrorInfo",
+					"reason": "DENIED",
+					"domain": "ahttp"
+				}]
+			}`,
+		},
+		{
+			name: "EmptySubject",
+
+			policy:    ahttp.Policy{Allow: ahttp.OwnerOf("missing")},
+			principal: &ahttp.Principal{},
+
+			expectCode: http.StatusForbidden,
+			expectBody: `{
+				"title": "Forbidden",
+				"status": 403,
+				"detail": "permission denied",
+				"code": "PermissionDenied",
+				"details": [{
+					"@type": "type.googleapis.com/google.rpc.ErrorInfo",
+					"reason": "DENIED",
+					"domain": "ahttp"
+				}]
+			}`,
+		},
+		{
+			name: "Unauthenticated",
+
+			policy: ahttp.Policy{Scopes: []string{"read"}},
+
+			expectCode: http.StatusUnauthorized,
+			expectBody: `{
+				"title": "Unauthorized",
+				"status": 401,
+				"detail": "missing bearer token",
+				"code": "Unauthenticated"
+			}`,
+			expectChallenge: "Bearer",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET(
+				"/users/:id",
+				func(ctx *gin.Context) {
+					if testCase.principal != nil {
+						ctx.Request = ctx.Request.WithContext(ahttp.WithPrincipal(ctx.Request.Context(), testCase.principal))
+					}
+				},
+				ahttp.Authorize(testCase.policy),
+				func(ctx *gin.Context) {
+					ctx.Status(http.StatusOK)
+				},
+			)
+
+			path := testCase.path
+			if path == "" {
+				path = "/users/alice"
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+			require.Equal(t, testCase.expectCode, w.Code)
+			require.Equal(t, testCase.expectChallenge, w.Header().Get("WWW-Authenticate"))
+
+			if testCase.expectBody != "" {
+				require.Equal(t, ahttp.ContentTypeProblem, w.Header().Get("Content-Type"))
+				require.JSONEq(t, testCase.expectBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthorizeReport(t *testing.T) {
+	keys := newJWTTestKeys(t)
+
+	testCases := []struct {
+		name string
+
+		scopes []string
+
+		expectCode          int
+		expectAuthorization map[string]any
+	}{
+		{
+			name: "Allowed",
+
+			scopes: []string{"read"},
+
+			expectCode:          http.StatusOK,
+			expectAuthorization: map[string]any{"allowed": true},
+		},
+		{
+			name: "Denied",
+
+			scopes: []string{"read", "write"},
+
+			expectCode: http.StatusForbidden,
+			expectAuthorization: map[string]any{
+				"allowed":       false,
+				"reason":        ahttp.AuthorizationReasonMissingScopes,
+				"missingScopes": []string{"write"},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			logger := quicklogmocks.NewMockLogger(t)
+			logger.
+				On("Log", mock.Anything, mock.Anything).
+				Run(func(args mock.Arguments) {
+					report := args.Get(1).(quicklog.Message).RenderJSON()
+					require.Equal(t, "alice", report["subject"])
+					require.Equal(t, testCase.expectAuthorization, report["authorization"])
+				}).
+				Once()
+
+			router := gin.New()
+			router.Use(ahttp.ReportMiddleware(logger, ""))
+			router.GET(
+				"/foo",
+				ahttp.NewJWTVerifier(ahttp.JWTConfig{Keys: keys.jwks()}).Middleware(),
+				ahttp.Authorize(ahttp.Policy{Scopes: testCase.scopes}),
+				func(ctx *gin.Context) {
+					ctx.Status(http.StatusOK)
+				},
+			)
+
+			token := signJWT(t, ahttp.JWTAlgorithmEdDSA, "ed25519", keys.ed25519, map[string]any{
+				"sub":   "alice",
+				"scope": "read",
+				"exp":   time.Now().Add(time.Hour).Unix(),
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/foo", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, testCase.expectCode, w.Code)
+			logger.AssertExpectations(t)
+		})
+	}
+}
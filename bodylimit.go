@@ -0,0 +1,117 @@
+package ahttp
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BodyLimitConfig struct {
+	// Limit is the maximum size of request bodies, in bytes. Zero means no limit.
+	Limit int64
+	// ContentTypes overrides Limit for some media types, such as "multipart/form-data".
+	ContentTypes map[string]int64
+}
+
+func newBodyLimitProblem(limit int64) *Problem {
+	return newProblem(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", limit))
+}
+
+// limitedBody counts the bytes read from a request body, and fails once the limit is exceeded.
+type limitedBody struct {
+	io.ReadCloser
+
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+func (body *limitedBody) Read(p []byte) (int, error) {
+	if body.exceeded {
+		return 0, &http.MaxBytesError{Limit: body.limit}
+	}
+
+	// Read one more byte than allowed, to tell a body of exactly the limit from a larger one.
+	if remaining := body.limit - body.read + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := body.ReadCloser.Read(p)
+	body.read += int64(n)
+
+	if body.read > body.limit {
+		body.exceeded = true
+		return n - int(body.read-body.limit), &http.MaxBytesError{Limit: body.limit}
+	}
+
+	return n, err
+}
+
+// readBodyWithLimit reads a request body, for middlewares that need it whole. Bodies over limit fail with an
+// http.MaxBytesError.
+func readBodyWithLimit(req *http.Request, limit int64) ([]byte, error) {
+	if req.ContentLength > limit {
+		return nil, &http.MaxBytesError{Limit: limit}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(body)) > limit {
+		return nil, &http.MaxBytesError{Limit: limit}
+	}
+
+	return body, nil
+}
+
+// BodyLimitMiddleware limits the size of request bodies. Attach it to a route or a group to set a per-route
+// limit.
+//
+// Requests that announce a larger Content-Length are rejected before the handler runs. Otherwise, reading past
+// the limit fails with an http.MaxBytesError, which HandleGRPCErrorProblem maps to 413. If the handler does not
+// respond, the middleware does.
+func BodyLimitMiddleware(config BodyLimitConfig) gin.HandlerFunc {
+	contentTypes := make(map[string]int64, len(config.ContentTypes))
+	for contentType, limit := range config.ContentTypes {
+		contentTypes[strings.ToLower(contentType)] = limit
+	}
+
+	return func(ctx *gin.Context) {
+		limit := config.Limit
+		if contentTypeLimit, ok := contentTypes[strings.ToLower(ctx.ContentType())]; ok {
+			limit = contentTypeLimit
+		}
+
+		if limit <= 0 || ctx.Request.Body == nil || ctx.Request.Body == http.NoBody {
+			ctx.Next()
+			return
+		}
+
+		if ctx.Request.ContentLength > limit {
+			ctx.Set(reportBodyLimitKey, limit)
+			abortWithProblem(ctx, newBodyLimitProblem(limit), &http.MaxBytesError{Limit: limit})
+
+			return
+		}
+
+		body := &limitedBody{ReadCloser: ctx.Request.Body, limit: limit}
+		ctx.Request.Body = body
+
+		ctx.Next()
+
+		if !body.exceeded {
+			return
+		}
+
+		ctx.Set(reportBodyLimitKey, limit)
+
+		if !ctx.Writer.Written() {
+			HandleGRPCErrorProblem(ctx, &http.MaxBytesError{Limit: limit})
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package ahttp_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a-novel-kit/quicklog"
+	quicklogmocks "github.com/a-novel-kit/quicklog/mocks"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+// chunkedReader hides the size of a body, so the request has no Content-Length.
+type chunkedReader struct {
+	io.Reader
+}
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	const problem413 = `{"title":"Request Entity Too Large","status":413,"detail":"request body exceeds 10 bytes"}`
+
+	testCases := []struct {
+		name string
+
+		config      ahttp.BodyLimitConfig
+		body        string
+		chunked     bool
+		contentType string
+		// handleError makes the handler respond to read errors itself.
+		handleError bool
+
+		expectCode    int
+		expectBody    string
+		expectHandler bool
+	}{
+		{
+			name: "NoLimit",
+
+			body: strings.Repeat("a", 100),
+
+			expectCode:    http.StatusOK,
+			expectBody:    "100",
+			expectHandler: true,
+		},
+		{
+			name: "UnderLimit",
+
+			config: ahttp.BodyLimitConfig{Limit: 10},
+			body:   strings.Repeat("a", 10),
+
+			expectCode:    http.StatusOK,
+			expectBody:    "10",
+			expectHandler: true,
+		},
+		{
+			name: "UnderLimit/Chunked",
+
+			config:  ahttp.BodyLimitConfig{Limit: 10},
+			body:    strings.Repeat("a", 10),
+			chunked: true,
+
+			expectCode:    http.StatusOK,
+			expectBody:    "10",
+			expectHandler: true,
+		},
+		{
+			name: "ContentLength",
+
+			config: ahttp.BodyLimitConfig{Limit: 10},
+			body:   strings.Repeat("a", 11),
+
+			expectCode: http.StatusRequestEntityTooLarge,
+			expectBody: problem413,
+		},
+		{
+			name: "Chunked",
+
+			config:  ahttp.BodyLimitConfig{Limit: 10},
+			body:    strings.Repeat("a", 11),
+			chunked: true,
+
+			expectCode:    http.StatusRequestEntityTooLarge,
+			expectBody:    problem413,
+			expectHandler: true,
+		},
+		{
+			name: "Chunked/HandledByHandler",
+
+			config:      ahttp.BodyLimitConfig{Limit: 10},
+			body:        strings.Repeat("a", 11),
+			chunked:     true,
+			handleError: true,
+
+			expectCode:    http.StatusRequestEntityTooLarge,
+			expectBody:    problem413,
+			expectHandler: true,
+		},
+		{
+			name: "ContentType",
+
+			config: ahttp.BodyLimitConfig{
+				Limit:        10,
+				ContentTypes: map[string]int64{"Multipart/Form-Data": 100},
+			},
+			body:        strings.Repeat("a", 50),
+			contentType: "multipart/form-data; boundary=foo",
+
+			expectCode:    http.StatusOK,
+			expectBody:    "50",
+			expectHandler: true,
+		},
+		{
+			name: "ContentType/OtherType",
+
+			config: ahttp.BodyLimitConfig{
+				Limit:        10,
+				ContentTypes: map[string]int64{"multipart/form-data": 100},
+			},
+			body:        strings.Repeat("a", 50),
+			contentType: "application/json",
+
+			expectCode: http.StatusRequestEntityTooLarge,
+			expectBody: problem413,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			handlerCalled := false
+
+			router := gin.New()
+			router.POST("/foo", ahttp.BodyLimitMiddleware(testCase.config), func(ctx *gin.Context) {
+				handlerCalled = true
+
+				data, err := io.ReadAll(ctx.Request.Body)
+				if err != nil {
+					if testCase.handleError {
+						ahttp.HandleGRPCErrorProblem(ctx, err)
+					}
+
+					return
+				}
+
+				ctx.String(http.StatusOK, "%d", len(data))
+			})
+
+			var body io.Reader = strings.NewReader(testCase.body)
+			if testCase.chunked {
+				body = chunkedReader{body}
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/foo", body)
+			if testCase.contentType != "" {
+				req.Header.Set("Content-Type", testCase.contentType)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, testCase.expectCode, w.Code)
+			require.Equal(t, testCase.expectBody, w.Body.String())
+			require.Equal(t, testCase.expectHandler, handlerCalled)
+		})
+	}
+}
+
+func TestBodyLimitMiddlewareReport(t *testing.T) {
+	logger := quicklogmocks.NewMockLogger(t)
+	logger.
+		On("Log", quicklog.LevelWarning, mock.Anything).
+		Run(func(args mock.Arguments) {
+			report := args.Get(1).(quicklog.Message).RenderJSON()
+			require.Equal(t, int64(10), report["bodyLimit"])
+			require.Equal(t, []string{"http: request body too large"}, report["errors"])
+		}).
+		Once()
+
+	router := gin.New()
+	router.Use(ahttp.ReportMiddleware(logger, ""))
+	router.POST("/foo", ahttp.BodyLimitMiddleware(ahttp.BodyLimitConfig{Limit: 10}), func(_ *gin.Context) {})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/foo", strings.NewReader(strings.Repeat("a", 11))))
+
+	require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	require.Equal(t, ahttp.ContentTypeProblem, w.Header().Get("Content-Type"))
+	logger.AssertExpectations(t)
+}
@@ -0,0 +1,486 @@
+package ahttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/a-novel-kit/quicklog"
+
+	ahttpmessages "github.com/a-novel-kit/ahttp/messages"
+)
+
+const (
+	DefaultBreakerFailureRatio     = 0.5
+	DefaultBreakerMinRequests      = 10
+	DefaultBreakerWindow           = 10 * time.Second
+	DefaultBreakerCooldown         = 30 * time.Second
+	DefaultBreakerHalfOpenRequests = 1
+	DefaultBreakerMaxCircuits      = 1000
+)
+
+type CircuitState int
+
+const (
+	// CircuitClosed lets every call through, and counts failures.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects every call, until the cooldown expires.
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of probe calls through, to check whether the upstream recovered.
+	CircuitHalfOpen
+)
+
+func (state CircuitState) String() string {
+	switch state {
+	case CircuitOpen:
+		return ahttpmessages.CircuitOpen
+	case CircuitHalfOpen:
+		return ahttpmessages.CircuitHalfOpen
+	default:
+		return ahttpmessages.CircuitClosed
+	}
+}
+
+// Codes that indicate the upstream is unhealthy. Other codes are the result of the call itself.
+var breakerFailureCodes = map[codes.Code]bool{
+	codes.Unknown:          true,
+	codes.DeadlineExceeded: true,
+	codes.Internal:         true,
+	codes.Unavailable:      true,
+	codes.DataLoss:         true,
+}
+
+type CircuitBreakerConfig struct {
+	// FailureRatio is the ratio of failed calls, over a window, that opens the circuit.
+	// Defaults to DefaultBreakerFailureRatio.
+	FailureRatio float64
+	// MinRequests is the minimum number of calls in a window before the failure ratio is evaluated.
+	// Defaults to DefaultBreakerMinRequests.
+	MinRequests int
+	// Window is the period over which calls are counted, while the circuit is closed.
+	// Defaults to DefaultBreakerWindow.
+	Window time.Duration
+	// Cooldown is the time the circuit stays open, before probe calls are allowed.
+	// Defaults to DefaultBreakerCooldown.
+	Cooldown time.Duration
+	// HalfOpenRequests is the number of successful probe calls required to close the circuit again. A single
+	// failed probe opens it back. Defaults to DefaultBreakerHalfOpenRequests.
+	HalfOpenRequests int
+
+	// KeyByMethod tracks gRPC calls per method, rather than per target. HTTP requests are always tracked per
+	// host.
+	KeyByMethod bool
+	// MaxCircuits is the number of circuits kept in memory. The least recently used circuits are forgotten
+	// beyond it, which closes them. Defaults to DefaultBreakerMaxCircuits.
+	MaxCircuits int
+}
+
+// breakerOutcome is the outcome of a call, as far as the health of the upstream is concerned.
+type breakerOutcome int
+
+const (
+	breakerSuccess breakerOutcome = iota
+	breakerFailure
+	// breakerCanceled calls were given up by the caller. They say nothing about the upstream, so they are not
+	// counted.
+	breakerCanceled
+)
+
+// circuit is the state of a single key. Outcomes of calls that started under a previous generation are
+// ignored, so a slow call cannot affect a circuit that already changed state.
+type circuit struct {
+	state      CircuitState
+	generation uint64
+
+	windowStart time.Time
+	requests    int
+	failures    int
+
+	openedAt time.Time
+	probes   int
+	probesOK int
+}
+
+// CircuitBreaker stops sending calls to an upstream that keeps failing. While a circuit is open, calls fail
+// immediately with codes.Unavailable, and a RetryInfo detail that HandleGRPCErrorProblem turns into a Retry-After
+// header.
+type CircuitBreaker struct {
+	config CircuitBreakerConfig
+	logger quicklog.Logger
+
+	mu       sync.Mutex
+	circuits *lruCache[*circuit]
+}
+
+func (breaker *CircuitBreaker) getCircuit(key string, now time.Time) *circuit {
+	current, ok := breaker.circuits.get(key)
+	if !ok {
+		current = &circuit{windowStart: now}
+		breaker.circuits.set(key, current)
+	}
+
+	return current
+}
+
+// transition must be called with the lock held. The returned message is logged once the lock is released.
+func (breaker *CircuitBreaker) transition(
+	key string, current *circuit, to CircuitState, now time.Time,
+) *ahttpmessages.CircuitTransition {
+	transition := &ahttpmessages.CircuitTransition{
+		Key:      key,
+		From:     current.state.String(),
+		To:       to.String(),
+		Requests: current.requests,
+		Failures: current.failures,
+	}
+
+	if current.state == CircuitHalfOpen {
+		transition.Requests = current.probes
+		transition.Failures = current.probes - current.probesOK
+	}
+
+	current.state = to
+	current.generation++
+	current.windowStart = now
+	current.requests = 0
+	current.failures = 0
+	current.probes = 0
+	current.probesOK = 0
+
+	if to == CircuitOpen {
+		current.openedAt = now
+		transition.Cooldown = breaker.config.Cooldown
+	}
+
+	return transition
+}
+
+func (breaker *CircuitBreaker) log(transition *ahttpmessages.CircuitTransition) {
+	if transition != nil && breaker.logger != nil {
+		breaker.logger.Log(
+			ahttpmessages.CircuitTransitionLevel(transition),
+			ahttpmessages.NewCircuitTransition(transition),
+		)
+	}
+}
+
+// allow reserves a call on the circuit of key. If the call is allowed, done must be called with its outcome.
+func (breaker *CircuitBreaker) allow(key string) (done func(outcome breakerOutcome), err error) {
+	breaker.mu.Lock()
+
+	now := time.Now()
+	current := breaker.getCircuit(key, now)
+
+	var transition *ahttpmessages.CircuitTransition
+
+	switch current.state {
+	case CircuitClosed:
+		if now.Sub(current.windowStart) > breaker.config.Window {
+			current.windowStart = now
+			current.requests = 0
+			current.failures = 0
+		}
+	case CircuitOpen:
+		if remaining := current.openedAt.Add(breaker.config.Cooldown).Sub(now); remaining > 0 {
+			breaker.mu.Unlock()
+
+			return nil, statusWithRetryDelay(codes.Unavailable, fmt.Sprintf("circuit open for %s", key), remaining)
+		}
+
+		transition = breaker.transition(key, current, CircuitHalfOpen, now)
+	case CircuitHalfOpen:
+	}
+
+	if current.state == CircuitHalfOpen {
+		if current.probes >= breaker.config.HalfOpenRequests {
+			breaker.mu.Unlock()
+			breaker.log(transition)
+
+			return nil, statusWithRetryDelay(
+				codes.Unavailable, fmt.Sprintf("circuit half-open for %s", key), breaker.config.Cooldown,
+			)
+		}
+
+		current.probes++
+	}
+
+	generation := current.generation
+
+	breaker.mu.Unlock()
+	breaker.log(transition)
+
+	return func(outcome breakerOutcome) {
+		breaker.mu.Lock()
+
+		if current.generation != generation {
+			breaker.mu.Unlock()
+			return
+		}
+
+		if outcome == breakerCanceled {
+			// Free the probe slot for another call.
+			if current.state == CircuitHalfOpen {
+				current.probes--
+			}
+
+			breaker.mu.Unlock()
+
+			return
+		}
+
+		failure := outcome == breakerFailure
+
+		var transition *ahttpmessages.CircuitTransition
+
+		switch current.state {
+		case CircuitClosed:
+			current.requests++
+			if failure {
+				current.failures++
+			}
+
+			if current.requests >= breaker.config.MinRequests &&
+				float64(current.failures)/float64(current.requests) >= breaker.config.FailureRatio {
+				transition = breaker.transition(key, current, CircuitOpen, time.Now())
+			}
+		case CircuitHalfOpen:
+			if failure {
+				transition = breaker.transition(key, current, CircuitOpen, time.Now())
+				break
+			}
+
+			current.probesOK++
+			if current.probesOK >= breaker.config.HalfOpenRequests {
+				transition = breaker.transition(key, current, CircuitClosed, time.Now())
+			}
+		case CircuitOpen:
+		}
+
+		breaker.mu.Unlock()
+		breaker.log(transition)
+	}, nil
+}
+
+// State returns the current state of the circuit of key.
+func (breaker *CircuitBreaker) State(key string) CircuitState {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	if current, ok := breaker.circuits.get(key); ok {
+		return current.state
+	}
+
+	return CircuitClosed
+}
+
+func (breaker *CircuitBreaker) grpcKey(cc *grpc.ClientConn, method string) string {
+	if breaker.config.KeyByMethod || cc == nil {
+		return method
+	}
+
+	return cc.Target()
+}
+
+// grpcOutcome returns the outcome of a gRPC call.
+func grpcOutcome(ctx context.Context, err error) breakerOutcome {
+	if err == nil {
+		return breakerSuccess
+	}
+
+	grpcStatus, _ := statusFromError(err)
+
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled), grpcStatus.Code() == codes.Canceled:
+		return breakerCanceled
+	case breakerFailureCodes[grpcStatus.Code()]:
+		return breakerFailure
+	default:
+		return breakerSuccess
+	}
+}
+
+// UnaryClientInterceptor guards unary calls with the circuit breaker.
+func (breaker *CircuitBreaker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		done, err := breaker.allow(breaker.grpcKey(cc, method))
+		if err != nil {
+			return err
+		}
+
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		done(grpcOutcome(ctx, err))
+
+		return err
+	}
+}
+
+// breakerStream records the outcome of a stream once its final status is known: the first error of SendMsg or
+// RecvMsg, io.EOF being a success.
+type breakerStream struct {
+	grpc.ClientStream
+
+	ctx  context.Context
+	desc *grpc.StreamDesc
+	done func(outcome breakerOutcome)
+
+	once     sync.Once
+	finished chan struct{}
+}
+
+func (stream *breakerStream) finish(err error) {
+	stream.once.Do(func() {
+		close(stream.finished)
+
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+
+		stream.done(grpcOutcome(stream.ctx, err))
+	})
+}
+
+// watch gives up on the stream if the caller cancels it without reading its status.
+func (stream *breakerStream) watch() {
+	select {
+	case <-stream.ctx.Done():
+		stream.finish(stream.ctx.Err())
+	case <-stream.finished:
+	}
+}
+
+func (stream *breakerStream) SendMsg(m any) error {
+	err := stream.ClientStream.SendMsg(m)
+	// io.EOF means the stream ended: its status is returned by RecvMsg.
+	if err != nil && !errors.Is(err, io.EOF) {
+		stream.finish(err)
+	}
+
+	return err
+}
+
+func (stream *breakerStream) RecvMsg(m any) error {
+	err := stream.ClientStream.RecvMsg(m)
+	// Streams without server streaming end with their single response.
+	if err != nil || !stream.desc.ServerStreams {
+		stream.finish(err)
+	}
+
+	return err
+}
+
+// StreamClientInterceptor guards streaming calls with the circuit breaker. The outcome of a stream is its final
+// status, so streams must be read until they end, or have their context canceled, as grpc requires anyway.
+func (breaker *CircuitBreaker) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		done, err := breaker.allow(breaker.grpcKey(cc, method))
+		if err != nil {
+			return nil, err
+		}
+
+		clientStream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			done(grpcOutcome(ctx, err))
+			return nil, err
+		}
+
+		stream := &breakerStream{
+			ClientStream: clientStream,
+			ctx:          ctx,
+			desc:         desc,
+			done:         done,
+			finished:     make(chan struct{}),
+		}
+
+		go stream.watch()
+
+		return stream, nil
+	}
+}
+
+type breakerTransport struct {
+	base    http.RoundTripper
+	breaker *CircuitBreaker
+}
+
+func (transport *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	done, err := transport.breaker.allow(req.URL.Host)
+	if err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+
+		return nil, err
+	}
+
+	res, err := transport.base.RoundTrip(req)
+
+	switch {
+	case err == nil && breakerFailureCodes[HTTPToGRPCCode(res.StatusCode)]:
+		done(breakerFailure)
+	case err == nil:
+		done(breakerSuccess)
+	case errors.Is(req.Context().Err(), context.Canceled):
+		done(breakerCanceled)
+	default:
+		// Includes the deadline of the caller: the upstream was too slow.
+		done(breakerFailure)
+	}
+
+	return res, err
+}
+
+// RoundTripper guards HTTP requests with the circuit breaker, per host. Transport errors, and responses whose
+// status maps to a failure code, count as failures. If base is nil, http.DefaultTransport is used.
+func (breaker *CircuitBreaker) RoundTripper(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &breakerTransport{base: base, breaker: breaker}
+}
+
+// NewCircuitBreaker creates a circuit breaker. State transitions are logged with logger, which may be nil.
+func NewCircuitBreaker(config CircuitBreakerConfig, logger quicklog.Logger) *CircuitBreaker {
+	if config.FailureRatio <= 0 {
+		config.FailureRatio = DefaultBreakerFailureRatio
+	}
+
+	if config.MinRequests <= 0 {
+		config.MinRequests = DefaultBreakerMinRequests
+	}
+
+	if config.Window <= 0 {
+		config.Window = DefaultBreakerWindow
+	}
+
+	if config.Cooldown <= 0 {
+		config.Cooldown = DefaultBreakerCooldown
+	}
+
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = DefaultBreakerHalfOpenRequests
+	}
+
+	if config.MaxCircuits <= 0 {
+		config.MaxCircuits = DefaultBreakerMaxCircuits
+	}
+
+	return &CircuitBreaker{
+		config:   config,
+		logger:   logger,
+		circuits: newLRUCache[*circuit](config.MaxCircuits),
+	}
+}
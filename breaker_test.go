@@ -0,0 +1,337 @@
+package ahttp_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/a-novel-kit/quicklog"
+	quicklogmocks "github.com/a-novel-kit/quicklog/mocks"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+func expectTransition(logger *quicklogmocks.MockLogger, level quicklog.Level, to string) {
+	logger.
+		On("Log", level, mock.MatchedBy(func(message quicklog.Message) bool {
+			return message.RenderJSON()["circuitBreaker"].(map[string]interface{})["to"] == to
+		})).
+		Once()
+}
+
+func TestCircuitBreakerRoundTripper(t *testing.T) {
+	var upstreamStatus, upstreamCalls atomic.Int32
+
+	upstreamStatus.Store(http.StatusServiceUnavailable)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		upstreamCalls.Add(1)
+		w.WriteHeader(int(upstreamStatus.Load()))
+	}))
+	defer upstream.Close()
+
+	logger := quicklogmocks.NewMockLogger(t)
+	expectTransition(logger, quicklog.LevelError, "open")
+	expectTransition(logger, quicklog.LevelWarning, "half-open")
+	expectTransition(logger, quicklog.LevelInfo, "closed")
+
+	breaker := ahttp.NewCircuitBreaker(ahttp.CircuitBreakerConfig{
+		MinRequests: 4,
+		Cooldown:    50 * time.Millisecond,
+	}, logger)
+
+	client := &http.Client{Transport: breaker.RoundTripper(nil)}
+
+	router := gin.New()
+	router.GET("/foo", func(ctx *gin.Context) {
+		req, err := http.NewRequestWithContext(ctx.Request.Context(), http.MethodGet, upstream.URL, nil)
+		require.NoError(t, err)
+
+		res, err := client.Do(req)
+		if ahttp.HandleGRPCErrorProblem(ctx, err) {
+			return
+		}
+
+		_ = res.Body.Close()
+		ctx.Status(res.StatusCode)
+	})
+
+	call := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/foo", nil))
+
+		return w
+	}
+
+	host := upstream.Listener.Addr().String()
+
+	for range 4 {
+		require.Equal(t, http.StatusServiceUnavailable, call().Code)
+	}
+
+	require.Equal(t, ahttp.CircuitOpen, breaker.State(host))
+
+	// The upstream is no longer called while the circuit is open.
+	w := call()
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, "1", w.Header().Get("Retry-After"))
+	require.Equal(t, int32(4), upstreamCalls.Load())
+
+	time.Sleep(60 * time.Millisecond)
+	upstreamStatus.Store(http.StatusOK)
+
+	require.Equal(t, http.StatusOK, call().Code)
+	require.Equal(t, ahttp.CircuitClosed, breaker.State(host))
+	require.Equal(t, int32(5), upstreamCalls.Load())
+
+	logger.AssertExpectations(t)
+}
+
+func TestCircuitBreakerUnaryClientInterceptor(t *testing.T) {
+	logger := quicklogmocks.NewMockLogger(t)
+	expectTransition(logger, quicklog.LevelError, "open")
+	expectTransition(logger, quicklog.LevelWarning, "half-open")
+	expectTransition(logger, quicklog.LevelError, "open")
+
+	breaker := ahttp.NewCircuitBreaker(ahttp.CircuitBreakerConfig{
+		MinRequests:  4,
+		FailureRatio: 0.5,
+		Cooldown:     50 * time.Millisecond,
+		KeyByMethod:  true,
+	}, logger)
+
+	interceptor := breaker.UnaryClientInterceptor()
+
+	invoke := func(method string, err error) error {
+		return interceptor(
+			context.Background(), method, nil, nil, nil,
+			func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+				return err
+			},
+		)
+	}
+
+	// Errors caused by the request itself are not failures.
+	for range 4 {
+		err := invoke("/foo.Bar/Baz", status.Error(codes.InvalidArgument, "foo"))
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+
+	require.Equal(t, ahttp.CircuitClosed, breaker.State("/foo.Bar/Baz"))
+
+	require.Error(t, invoke("/foo.Bar/Baz", status.Error(codes.Unavailable, "foo")))
+	require.Error(t, invoke("/foo.Bar/Baz", context.DeadlineExceeded))
+	require.Error(t, invoke("/foo.Bar/Baz", status.Error(codes.Unavailable, "foo")))
+	require.Equal(t, ahttp.CircuitClosed, breaker.State("/foo.Bar/Baz"))
+	require.Error(t, invoke("/foo.Bar/Baz", status.Error(codes.Internal, "foo")))
+
+	require.Equal(t, ahttp.CircuitOpen, breaker.State("/foo.Bar/Baz"))
+	// Other methods have their own circuit.
+	require.Equal(t, ahttp.CircuitClosed, breaker.State("/foo.Bar/Qux"))
+	require.NoError(t, invoke("/foo.Bar/Qux", nil))
+
+	err := invoke("/foo.Bar/Baz", nil)
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Len(t, status.Convert(err).Details(), 1)
+
+	time.Sleep(60 * time.Millisecond)
+
+	// A failed probe opens the circuit back.
+	require.Error(t, invoke("/foo.Bar/Baz", status.Error(codes.Internal, "foo")))
+	require.Equal(t, ahttp.CircuitOpen, breaker.State("/foo.Bar/Baz"))
+
+	logger.AssertExpectations(t)
+}
+
+func TestCircuitBreakerCanceledProbe(t *testing.T) {
+	var upstreamStatus atomic.Int32
+
+	upstreamStatus.Store(http.StatusServiceUnavailable)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("slow") {
+			<-r.Context().Done()
+			return
+		}
+
+		w.WriteHeader(int(upstreamStatus.Load()))
+	}))
+	defer upstream.Close()
+
+	breaker := ahttp.NewCircuitBreaker(ahttp.CircuitBreakerConfig{
+		MinRequests: 2,
+		Cooldown:    50 * time.Millisecond,
+		KeyByMethod: true,
+	}, nil)
+
+	client := &http.Client{Transport: breaker.RoundTripper(nil)}
+	host := upstream.Listener.Addr().String()
+
+	call := func(ctx context.Context, query string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL+query, nil)
+		require.NoError(t, err)
+
+		res, err := client.Do(req)
+		if err == nil {
+			_ = res.Body.Close()
+		}
+
+		return err
+	}
+
+	require.NoError(t, call(context.Background(), ""))
+	require.NoError(t, call(context.Background(), ""))
+	require.Equal(t, ahttp.CircuitOpen, breaker.State(host))
+
+	time.Sleep(60 * time.Millisecond)
+
+	// The caller gives up on the probe: the circuit waits for another one.
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	require.ErrorIs(t, call(ctx, "?slow"), context.Canceled)
+	require.Equal(t, ahttp.CircuitHalfOpen, breaker.State(host))
+
+	// The next probe is allowed, and still finds the upstream down.
+	require.NoError(t, call(context.Background(), ""))
+	require.Equal(t, ahttp.CircuitOpen, breaker.State(host))
+
+	// The same goes for gRPC calls.
+	interceptor := breaker.UnaryClientInterceptor()
+
+	invoke := func(err error) error {
+		return interceptor(
+			context.Background(), "/foo.Bar/Baz", nil, nil, nil,
+			func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+				return err
+			},
+		)
+	}
+
+	require.Error(t, invoke(status.Error(codes.Unavailable, "foo")))
+	require.Error(t, invoke(status.Error(codes.Unavailable, "foo")))
+	require.Equal(t, ahttp.CircuitOpen, breaker.State("/foo.Bar/Baz"))
+
+	time.Sleep(60 * time.Millisecond)
+
+	require.Equal(t, codes.Canceled, status.Code(invoke(status.Error(codes.Canceled, "canceled"))))
+	require.Equal(t, ahttp.CircuitHalfOpen, breaker.State("/foo.Bar/Baz"))
+
+	require.NoError(t, invoke(nil))
+	require.Equal(t, ahttp.CircuitClosed, breaker.State("/foo.Bar/Baz"))
+}
+
+type breakerTestStream struct {
+	grpc.ClientStream
+
+	err error
+}
+
+func (stream *breakerTestStream) SendMsg(any) error {
+	return nil
+}
+
+func (stream *breakerTestStream) RecvMsg(any) error {
+	return stream.err
+}
+
+func TestCircuitBreakerStreamClientInterceptor(t *testing.T) {
+	breaker := ahttp.NewCircuitBreaker(ahttp.CircuitBreakerConfig{
+		MinRequests: 2,
+		Cooldown:    50 * time.Millisecond,
+		KeyByMethod: true,
+	}, nil)
+
+	interceptor := breaker.StreamClientInterceptor()
+	desc := &grpc.StreamDesc{ServerStreams: true}
+
+	open := func(ctx context.Context, err error) (grpc.ClientStream, error) {
+		return interceptor(
+			ctx, desc, nil, "/foo.Bar/Baz",
+			func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+				return &breakerTestStream{err: err}, nil
+			},
+		)
+	}
+
+	recv := func(err error) {
+		stream, openErr := open(context.Background(), err)
+		require.NoError(t, openErr)
+		require.NoError(t, stream.SendMsg(nil))
+		require.ErrorIs(t, stream.RecvMsg(nil), err)
+	}
+
+	// Streams that end normally are successes.
+	recv(io.EOF)
+	recv(io.EOF)
+	require.Equal(t, ahttp.CircuitClosed, breaker.State("/foo.Bar/Baz"))
+
+	// Streams that open, then fail, are failures.
+	recv(status.Error(codes.Unavailable, "foo"))
+	recv(status.Error(codes.Unavailable, "foo"))
+	require.Equal(t, ahttp.CircuitOpen, breaker.State("/foo.Bar/Baz"))
+
+	time.Sleep(60 * time.Millisecond)
+
+	// A probe abandoned by its caller frees its slot.
+	ctx, cancel := context.WithCancel(context.Background())
+
+	_, err := open(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, ahttp.CircuitHalfOpen, breaker.State("/foo.Bar/Baz"))
+
+	_, err = open(context.Background(), nil)
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	cancel()
+
+	var stream grpc.ClientStream
+
+	require.Eventually(t, func() bool {
+		stream, err = open(context.Background(), io.EOF)
+		return err == nil
+	}, time.Second, time.Millisecond)
+
+	require.ErrorIs(t, stream.RecvMsg(nil), io.EOF)
+	require.Equal(t, ahttp.CircuitClosed, breaker.State("/foo.Bar/Baz"))
+}
+
+func TestCircuitBreakerMaxCircuits(t *testing.T) {
+	breaker := ahttp.NewCircuitBreaker(ahttp.CircuitBreakerConfig{
+		MinRequests: 1,
+		KeyByMethod: true,
+		MaxCircuits: 2,
+	}, nil)
+
+	interceptor := breaker.UnaryClientInterceptor()
+
+	invoke := func(method string) error {
+		return interceptor(
+			context.Background(), method, nil, nil, nil,
+			func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+				return status.Error(codes.Unavailable, "foo")
+			},
+		)
+	}
+
+	require.Error(t, invoke("/foo.Bar/A"))
+	require.Error(t, invoke("/foo.Bar/B"))
+	require.Equal(t, ahttp.CircuitOpen, breaker.State("/foo.Bar/A"))
+	require.Equal(t, ahttp.CircuitOpen, breaker.State("/foo.Bar/B"))
+
+	// The least recently used circuit is forgotten.
+	require.Error(t, invoke("/foo.Bar/C"))
+	require.Equal(t, ahttp.CircuitClosed, breaker.State("/foo.Bar/A"))
+	require.Equal(t, ahttp.CircuitOpen, breaker.State("/foo.Bar/C"))
+}
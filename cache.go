@@ -0,0 +1,263 @@
+package ahttp
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+
+	ahttpmessages "github.com/a-novel-kit/ahttp/messages"
+)
+
+const DefaultCacheMaxEntries = 1000
+
+// StaleWarning is the Warning header of stale responses, served because the handler failed.
+const StaleWarning = `110 - "Response is Stale"`
+
+// Set by CacheMiddleware on a miss, when an expired response can be served if the handler fails.
+const cacheStaleResponseKey = "ahttp.cache.staleResponse"
+
+type cachedResponse struct {
+	response   *StoredResponse
+	storedAt   time.Time
+	expiresAt  time.Time
+	staleUntil time.Time
+	// public responses can be shared with requests that carry credentials.
+	public bool
+}
+
+func (cached *cachedResponse) write(ctx *gin.Context, now time.Time) {
+	ctx.Header("Age", strconv.Itoa(int(now.Sub(cached.storedAt).Seconds())))
+	cached.response.write(ctx.Writer)
+}
+
+// cacheEntry holds the variants of a resource. Entries are never modified, so they can be read without a lock.
+type cacheEntry struct {
+	// vary lists the request headers that select a variant, from the Vary header of the responses.
+	vary     []string
+	variants map[string]*cachedResponse
+}
+
+func (entry *cacheEntry) variantKey(header http.Header) string {
+	values := make([]string, len(entry.vary))
+	for i, name := range entry.vary {
+		values[i] = strings.Join(header.Values(name), ",")
+	}
+
+	return strings.Join(values, "\x00")
+}
+
+type CacheConfig struct {
+	// MaxEntries is the number of resources kept in memory. Defaults to DefaultCacheMaxEntries.
+	MaxEntries int
+	// TTL is the freshness of responses whose Cache-Control header sets no max-age. Those responses are not
+	// cached when it is zero.
+	TTL time.Duration
+	// StaleIfError is the time expired responses are kept for, to be served if the handler fails with
+	// Unavailable or DeadlineExceeded. It is overridden by the stale-if-error directive of responses. Stale
+	// responses are not served when it is zero.
+	StaleIfError time.Duration
+	// Principal identifies the client of a request. When it is set, each principal gets its own copy of the
+	// responses. Otherwise, requests with an Authorization or Cookie header only share responses marked public.
+	Principal func(ctx *gin.Context) string
+}
+
+type cacheControl struct {
+	noStore      bool
+	public       bool
+	maxAge       time.Duration
+	hasMaxAge    bool
+	staleIfError time.Duration
+	hasStale     bool
+}
+
+func parseCacheControl(header string) cacheControl {
+	var control cacheControl
+
+	for _, directive := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache", "private":
+			control.noStore = true
+		case "public":
+			control.public = true
+		case "max-age":
+			// s-maxage takes precedence, since this cache is shared.
+			if err == nil && !control.hasMaxAge {
+				control.maxAge, control.hasMaxAge = time.Duration(seconds)*time.Second, true
+			}
+		case "s-maxage":
+			if err == nil {
+				control.maxAge, control.hasMaxAge = time.Duration(seconds)*time.Second, true
+			}
+		case "stale-if-error":
+			if err == nil {
+				control.staleIfError, control.hasStale = time.Duration(seconds)*time.Second, true
+			}
+		}
+	}
+
+	return control
+}
+
+// cacheable returns the cached version of a response, or nil if it must not be cached.
+func (config *CacheConfig) cacheable(response *StoredResponse, now time.Time) *cachedResponse {
+	if response.Status != http.StatusOK ||
+		response.Header.Get("Set-Cookie") != "" ||
+		slices.Contains(response.Header.Values("Vary"), "*") {
+		return nil
+	}
+
+	control := parseCacheControl(strings.Join(response.Header.Values("Cache-Control"), ","))
+	if control.noStore {
+		return nil
+	}
+
+	ttl := config.TTL
+	if control.hasMaxAge {
+		ttl = control.maxAge
+	}
+
+	if ttl <= 0 {
+		return nil
+	}
+
+	staleIfError := config.StaleIfError
+	if control.hasStale {
+		staleIfError = control.staleIfError
+	}
+
+	return &cachedResponse{
+		response:   response,
+		storedAt:   now,
+		expiresAt:  now.Add(ttl),
+		staleUntil: now.Add(ttl + staleIfError),
+		public:     control.public,
+	}
+}
+
+func responseVary(header http.Header) []string {
+	var vary []string
+
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = http.CanonicalHeaderKey(strings.TrimSpace(name)); name != "" {
+				vary = append(vary, name)
+			}
+		}
+	}
+
+	slices.Sort(vary)
+
+	return slices.Compact(vary)
+}
+
+// serveStaleResponse serves the expired response set by CacheMiddleware, if the handler failed with a
+// transient error. It reports whether it did.
+func serveStaleResponse(ctx *gin.Context, code codes.Code) bool {
+	if code != codes.Unavailable && code != codes.DeadlineExceeded {
+		return false
+	}
+
+	stale, ok := ctx.Get(cacheStaleResponseKey)
+	if !ok || ctx.Writer.Written() {
+		return false
+	}
+
+	ctx.Set(reportCacheKey, ahttpmessages.CacheStale)
+	ctx.Header("Warning", StaleWarning)
+	stale.(*cachedResponse).write(ctx, time.Now())
+
+	return true
+}
+
+// CacheMiddleware caches the responses of GET routes in memory.
+//
+// Responses are cached for the max-age (or s-maxage) of their Cache-Control header, or TTL if they have none.
+// Only 200 responses are cached, and never those marked no-store, no-cache or private, those with a Set-Cookie
+// header, or those with Vary: *. Responses are cached per value of the request headers listed in their Vary
+// header. Clients can bypass the cache with a Cache-Control: no-cache request header.
+//
+// Unless CacheConfig.Principal is set, requests with an Authorization or Cookie header are only answered with, and
+// only store, responses marked public (RFC 9111, section 3.5).
+//
+// If the handler fails with Unavailable or DeadlineExceeded through HandleGRPCError or HandleGRPCErrorProblem, an
+// expired response is served instead, with a Warning header, for up to StaleIfError after it expired.
+func CacheMiddleware(config CacheConfig) gin.HandlerFunc {
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = DefaultCacheMaxEntries
+	}
+
+	cache := newLRUCache[*cacheEntry](config.MaxEntries)
+
+	return func(ctx *gin.Context) {
+		if ctx.Request.Method != http.MethodGet {
+			ctx.Next()
+			return
+		}
+
+		credentials := config.Principal == nil &&
+			(ctx.GetHeader("Authorization") != "" || ctx.GetHeader("Cookie") != "")
+
+		key := ctx.Request.URL.RequestURI()
+		if config.Principal != nil {
+			key = config.Principal(ctx) + "\x00" + key
+		}
+
+		now := time.Now()
+		bypass := parseCacheControl(ctx.GetHeader("Cache-Control")).noStore
+
+		entry, _ := cache.get(key)
+		if entry != nil && !bypass {
+			if cached := entry.variants[entry.variantKey(ctx.Request.Header)]; cached != nil &&
+				(cached.public || !credentials) {
+				switch {
+				case now.Before(cached.expiresAt):
+					ctx.Set(reportCacheKey, ahttpmessages.CacheHit)
+					cached.write(ctx, now)
+					ctx.Abort()
+
+					return
+				case now.Before(cached.staleUntil):
+					ctx.Set(cacheStaleResponseKey, cached)
+				}
+			}
+		}
+
+		ctx.Set(reportCacheKey, ahttpmessages.CacheMiss)
+
+		original := ctx.Writer
+		recorder := newResponseRecorder(original)
+		ctx.Writer = recorder
+
+		ctx.Next()
+
+		ctx.Writer = original
+
+		if ctx.GetString(reportCacheKey) == ahttpmessages.CacheStale {
+			return
+		}
+
+		response := recorder.response()
+
+		cached := config.cacheable(response, now)
+		if cached == nil || (credentials && !cached.public) {
+			return
+		}
+
+		next := &cacheEntry{vary: responseVary(response.Header), variants: make(map[string]*cachedResponse)}
+		if entry != nil && slices.Equal(entry.vary, next.vary) {
+			maps.Copy(next.variants, entry.variants)
+		}
+
+		next.variants[next.variantKey(ctx.Request.Header)] = cached
+		cache.set(key, next)
+	}
+}
@@ -0,0 +1,356 @@
+package ahttp_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/a-novel-kit/quicklog"
+	quicklogmocks "github.com/a-novel-kit/quicklog/mocks"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+type cachedRequest struct {
+	wait   time.Duration
+	header map[string]string
+
+	expectCode    int
+	expectBody    string
+	expectAge     bool
+	expectWarning bool
+}
+
+func TestCacheMiddleware(t *testing.T) {
+	succeed := func(ctx *gin.Context, calls int) {
+		ctx.String(http.StatusOK, "call %d", calls)
+	}
+
+	failAfterFirst := func(code codes.Code) func(ctx *gin.Context, calls int) {
+		return func(ctx *gin.Context, calls int) {
+			if calls > 1 {
+				ahttp.HandleGRPCErrorProblem(ctx, status.Error(code, "backend down"))
+				return
+			}
+
+			ctx.String(http.StatusOK, "call %d", calls)
+		}
+	}
+
+	failAfterFirstStatusOnly := func(code codes.Code) func(ctx *gin.Context, calls int) {
+		return func(ctx *gin.Context, calls int) {
+			if calls > 1 {
+				ahttp.HandleGRPCError(ctx, status.Error(code, "backend down"))
+				return
+			}
+
+			ctx.String(http.StatusOK, "call %d", calls)
+		}
+	}
+
+	testCases := []struct {
+		name string
+
+		config   ahttp.CacheConfig
+		handler  func(ctx *gin.Context, calls int)
+		requests []cachedRequest
+	}{
+		{
+			name: "Hit",
+
+			config:  ahttp.CacheConfig{TTL: time.Minute},
+			handler: succeed,
+			requests: []cachedRequest{
+				{expectCode: http.StatusOK, expectBody: "call 1"},
+				{expectCode: http.StatusOK, expectBody: "call 1", expectAge: true},
+			},
+		},
+		{
+			name: "Expired",
+
+			config:  ahttp.CacheConfig{TTL: 50 * time.Millisecond},
+			handler: succeed,
+			requests: []cachedRequest{
+				{expectCode: http.StatusOK, expectBody: "call 1"},
+				{wait: 60 * time.Millisecond, expectCode: http.StatusOK, expectBody: "call 2"},
+			},
+		},
+		{
+			name: "NoFreshness",
+
+			handler: succeed,
+			requests: []cachedRequest{
+				{expectCode: http.StatusOK, expectBody: "call 1"},
+				{expectCode: http.StatusOK, expectBody: "call 2"},
+			},
+		},
+		{
+			name: "MaxAge",
+
+			handler: func(ctx *gin.Context, calls int) {
+				ctx.Header("Cache-Control", "public, max-age=60")
+				ctx.String(http.StatusOK, "call %d", calls)
+			},
+			requests: []cachedRequest{
+				{expectCode: http.StatusOK, expectBody: "call 1"},
+				{expectCode: http.StatusOK, expectBody: "call 1", expectAge: true},
+			},
+		},
+		{
+			name: "NoStore",
+
+			config: ahttp.CacheConfig{TTL: time.Minute},
+			handler: func(ctx *gin.Context, calls int) {
+				ctx.Header("Cache-Control", "no-store")
+				ctx.String(http.StatusOK, "call %d", calls)
+			},
+			requests: []cachedRequest{
+				{expectCode: http.StatusOK, expectBody: "call 1"},
+				{expectCode: http.StatusOK, expectBody: "call 2"},
+			},
+		},
+		{
+			name: "ErrorStatus",
+
+			config: ahttp.CacheConfig{TTL: time.Minute},
+			handler: func(ctx *gin.Context, calls int) {
+				ctx.String(http.StatusNotFound, "call %d", calls)
+			},
+			requests: []cachedRequest{
+				{expectCode: http.StatusNotFound, expectBody: "call 1"},
+				{expectCode: http.StatusNotFound, expectBody: "call 2"},
+			},
+		},
+		{
+			name: "Vary",
+
+			config: ahttp.CacheConfig{TTL: time.Minute},
+			handler: func(ctx *gin.Context, calls int) {
+				ctx.Header("Vary", "X-Lang")
+				ctx.String(http.StatusOK, "call %d: %s", calls, ctx.GetHeader("X-Lang"))
+			},
+			requests: []cachedRequest{
+				{header: map[string]string{"X-Lang": "en"}, expectCode: http.StatusOK, expectBody: "call 1: en"},
+				{header: map[string]string{"X-Lang": "fr"}, expectCode: http.StatusOK, expectBody: "call 2: fr"},
+				{
+					header:     map[string]string{"X-Lang": "en"},
+					expectCode: http.StatusOK, expectBody: "call 1: en", expectAge: true,
+				},
+			},
+		},
+		{
+			name: "RequestNoCache",
+
+			config:  ahttp.CacheConfig{TTL: time.Minute},
+			handler: succeed,
+			requests: []cachedRequest{
+				{expectCode: http.StatusOK, expectBody: "call 1"},
+				{header: map[string]string{"Cache-Control": "no-cache"}, expectCode: http.StatusOK, expectBody: "call 2"},
+				{expectCode: http.StatusOK, expectBody: "call 2", expectAge: true},
+			},
+		},
+		{
+			name: "Authorization",
+
+			config:  ahttp.CacheConfig{TTL: time.Minute},
+			handler: succeed,
+			requests: []cachedRequest{
+				{header: map[string]string{"Authorization": "Bearer foo"}, expectCode: http.StatusOK, expectBody: "call 1"},
+				{header: map[string]string{"Authorization": "Bearer foo"}, expectCode: http.StatusOK, expectBody: "call 2"},
+			},
+		},
+		{
+			name: "Authorization/Public",
+
+			config: ahttp.CacheConfig{TTL: time.Minute},
+			handler: func(ctx *gin.Context, calls int) {
+				ctx.Header("Cache-Control", "public")
+				ctx.String(http.StatusOK, "call %d", calls)
+			},
+			requests: []cachedRequest{
+				{header: map[string]string{"Authorization": "Bearer foo"}, expectCode: http.StatusOK, expectBody: "call 1"},
+				{
+					header:     map[string]string{"Authorization": "Bearer bar"},
+					expectCode: http.StatusOK, expectBody: "call 1", expectAge: true,
+				},
+			},
+		},
+		{
+			name: "Cookie",
+
+			config:  ahttp.CacheConfig{TTL: time.Minute},
+			handler: succeed,
+			requests: []cachedRequest{
+				{header: map[string]string{"Cookie": "session=foo"}, expectCode: http.StatusOK, expectBody: "call 1"},
+				{header: map[string]string{"Cookie": "session=foo"}, expectCode: http.StatusOK, expectBody: "call 2"},
+				// Responses cached for anonymous requests are not shared with requests that carry credentials.
+				{expectCode: http.StatusOK, expectBody: "call 3"},
+				{header: map[string]string{"Cookie": "session=foo"}, expectCode: http.StatusOK, expectBody: "call 4"},
+				{expectCode: http.StatusOK, expectBody: "call 3", expectAge: true},
+			},
+		},
+		{
+			name: "Authorization/Principal",
+
+			config: ahttp.CacheConfig{
+				TTL: time.Minute,
+				Principal: func(ctx *gin.Context) string {
+					return ctx.GetHeader("Authorization")
+				},
+			},
+			handler: succeed,
+			requests: []cachedRequest{
+				{header: map[string]string{"Authorization": "Bearer foo"}, expectCode: http.StatusOK, expectBody: "call 1"},
+				{header: map[string]string{"Authorization": "Bearer bar"}, expectCode: http.StatusOK, expectBody: "call 2"},
+				{
+					header:     map[string]string{"Authorization": "Bearer foo"},
+					expectCode: http.StatusOK, expectBody: "call 1", expectAge: true,
+				},
+			},
+		},
+		{
+			name: "StaleOnError",
+
+			config:  ahttp.CacheConfig{TTL: 50 * time.Millisecond, StaleIfError: time.Minute},
+			handler: failAfterFirst(codes.Unavailable),
+			requests: []cachedRequest{
+				{expectCode: http.StatusOK, expectBody: "call 1"},
+				{
+					wait:       60 * time.Millisecond,
+					expectCode: http.StatusOK, expectBody: "call 1", expectAge: true, expectWarning: true,
+				},
+			},
+		},
+		{
+			name: "StaleOnError/Directive",
+
+			config: ahttp.CacheConfig{TTL: 50 * time.Millisecond},
+			handler: func(ctx *gin.Context, calls int) {
+				ctx.Header("Cache-Control", "stale-if-error=60")
+				failAfterFirst(codes.DeadlineExceeded)(ctx, calls)
+			},
+			requests: []cachedRequest{
+				{expectCode: http.StatusOK, expectBody: "call 1"},
+				{
+					wait:       60 * time.Millisecond,
+					expectCode: http.StatusOK, expectBody: "call 1", expectAge: true, expectWarning: true,
+				},
+			},
+		},
+		{
+			name: "StaleOnError/Disabled",
+
+			config:  ahttp.CacheConfig{TTL: 50 * time.Millisecond},
+			handler: failAfterFirst(codes.Unavailable),
+			requests: []cachedRequest{
+				{expectCode: http.StatusOK, expectBody: "call 1"},
+				{
+					wait:       60 * time.Millisecond,
+					expectCode: http.StatusServiceUnavailable,
+					expectBody: `{"title":"Service Unavailable","status":503,"detail":"backend down","code":"Unavailable"}`,
+				},
+			},
+		},
+		{
+			name: "StaleOnError/StatusOnly",
+
+			config:  ahttp.CacheConfig{TTL: 50 * time.Millisecond, StaleIfError: time.Minute},
+			handler: failAfterFirstStatusOnly(codes.Unavailable),
+			requests: []cachedRequest{
+				{expectCode: http.StatusOK, expectBody: "call 1"},
+				{
+					wait:       60 * time.Millisecond,
+					expectCode: http.StatusOK, expectBody: "call 1", expectAge: true, expectWarning: true,
+				},
+			},
+		},
+		{
+			name: "StaleOnError/StatusOnlyDisabled",
+
+			config:  ahttp.CacheConfig{TTL: 50 * time.Millisecond},
+			handler: failAfterFirstStatusOnly(codes.Unavailable),
+			requests: []cachedRequest{
+				{expectCode: http.StatusOK, expectBody: "call 1"},
+				{wait: 60 * time.Millisecond, expectCode: http.StatusServiceUnavailable},
+			},
+		},
+		{
+			name: "StaleOnError/OtherError",
+
+			config:  ahttp.CacheConfig{TTL: 50 * time.Millisecond, StaleIfError: time.Minute},
+			handler: failAfterFirst(codes.NotFound),
+			requests: []cachedRequest{
+				{expectCode: http.StatusOK, expectBody: "call 1"},
+				{
+					wait:       60 * time.Millisecond,
+					expectCode: http.StatusNotFound,
+					expectBody: `{"title":"Not Found","status":404,"detail":"backend down","code":"NotFound"}`,
+				},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			calls := 0
+
+			router := gin.New()
+			router.GET("/foo", ahttp.CacheMiddleware(testCase.config), func(ctx *gin.Context) {
+				calls++
+				testCase.handler(ctx, calls)
+			})
+
+			for i, request := range testCase.requests {
+				time.Sleep(request.wait)
+
+				req := httptest.NewRequest(http.MethodGet, "/foo", nil)
+				for key, value := range request.header {
+					req.Header.Set(key, value)
+				}
+
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				message := fmt.Sprintf("request %d", i)
+				require.Equal(t, request.expectCode, w.Code, message)
+				require.Equal(t, request.expectBody, w.Body.String(), message)
+				require.Equal(t, request.expectAge, w.Header().Get("Age") != "", message)
+				require.Equal(t, request.expectWarning, w.Header().Get("Warning") == ahttp.StaleWarning, message)
+			}
+		})
+	}
+}
+
+func TestCacheMiddlewareReport(t *testing.T) {
+	var outcomes []interface{}
+
+	logger := quicklogmocks.NewMockLogger(t)
+	logger.
+		On("Log", quicklog.LevelInfo, mock.Anything).
+		Run(func(args mock.Arguments) {
+			report := args.Get(1).(quicklog.Message).RenderJSON()
+			outcomes = append(outcomes, report["cache"], report["httpRequest"].(map[string]interface{})["cacheHit"])
+		}).
+		Twice()
+
+	router := gin.New()
+	router.Use(ahttp.ReportMiddleware(logger, ""))
+	router.GET("/foo", ahttp.CacheMiddleware(ahttp.CacheConfig{TTL: time.Minute}), func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, "foo")
+	})
+
+	for range 2 {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/foo", nil))
+	}
+
+	require.Equal(t, []interface{}{"miss", false, "hit", true}, outcomes)
+	logger.AssertExpectations(t)
+}
@@ -0,0 +1,271 @@
+package ahttpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+const (
+	DefaultMaxAttempts = 3
+	DefaultBaseDelay   = 100 * time.Millisecond
+	DefaultMaxDelay    = 10 * time.Second
+)
+
+// Maximum number of bytes of an error response included in the status message.
+const maxErrorBodySize = 512
+
+// Statuses that indicate a transient failure.
+var retryableStatuses = map[int]bool{
+	http.StatusRequestTimeout:     true,
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+type Config struct {
+	// Transport used to send requests. Defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+
+	// MaxAttempts is the maximum number of attempts for a request, including the first one.
+	// Defaults to DefaultMaxAttempts.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It doubles with every attempt, up to MaxDelay.
+	// Defaults to DefaultBaseDelay.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts. A Retry-After longer than MaxDelay is not honoured, and the
+	// request fails instead. Defaults to DefaultMaxDelay.
+	MaxDelay time.Duration
+	// AttemptTimeout is the timeout of a single attempt. The overall deadline of the request context still
+	// applies. Zero means no timeout.
+	AttemptTimeout time.Duration
+}
+
+// Client is an HTTP client that retries transient failures, and reports errors as gRPC statuses.
+type Client struct {
+	config Config
+	client *http.Client
+}
+
+// cancelOnClose releases the attempt context once the response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+
+	cancel context.CancelFunc
+}
+
+func (body *cancelOnClose) Close() error {
+	defer body.cancel()
+	return body.ReadCloser.Close()
+}
+
+// isRetryable reports whether a request can safely be sent more than once.
+func isRetryable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	return idempotentMethods[req.Method] || req.Header.Get("Idempotency-Key") != ""
+}
+
+// parseRetryAfter parses the Retry-After header, either in seconds or as an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
+
+// backoff returns the delay before the given retry, using exponential backoff with full jitter.
+func (client *Client) backoff(retry int) time.Duration {
+	delay := client.config.MaxDelay
+	if retry < 32 {
+		delay = min(client.config.BaseDelay<<retry, client.config.MaxDelay)
+	}
+
+	return rand.N(delay + 1)
+}
+
+// errorFromResponse converts an unsuccessful response to a status error. The body is consumed and closed.
+func errorFromResponse(req *http.Request, res *http.Response) error {
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBodySize))
+
+	message := fmt.Sprintf("%s %s: %s", req.Method, req.URL.Redacted(), res.Status)
+	if trimmed := strings.TrimSpace(string(body)); trimmed != "" {
+		message += ": " + trimmed
+	}
+
+	return status.Error(ahttp.HTTPToGRPCCode(res.StatusCode), message)
+}
+
+// errorFromTransport converts a transport error to a status error.
+func errorFromTransport(ctx context.Context, req *http.Request, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	message := fmt.Sprintf("%s %s: %v", req.Method, req.URL.Redacted(), err)
+
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		return status.Error(codes.Canceled, message)
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, message)
+	default:
+		return status.Error(codes.Unavailable, message)
+	}
+}
+
+func (client *Client) attempt(req *http.Request, retry int) (*http.Response, error) {
+	ctx := ahttp.WithRetryCount(req.Context(), retry)
+	cancel := context.CancelFunc(func() {})
+
+	if client.config.AttemptTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, client.config.AttemptTimeout)
+	}
+
+	attemptReq := req.Clone(ctx)
+
+	if retry > 0 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		attemptReq.Body = body
+	}
+
+	res, err := client.client.Do(attemptReq)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+
+	return res, nil
+}
+
+// Do sends a request, and retries it on transient failures if it is idempotent: either because of its method,
+// or because it carries an Idempotency-Key header. Requests with a body are only retried if it can be
+// replayed (see http.Request.GetBody).
+//
+// Retries use exponential backoff with full jitter. On 429 and 503 responses, the Retry-After header takes
+// precedence.
+//
+// Responses with a status of 400 or more are converted to status errors (see ahttp.HTTPToGRPCCode), as well as
+// transport errors, so callers can handle them like errors returned by a gRPC client.
+func (client *Client) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	retryable := isRetryable(req)
+
+	for retry := 0; ; retry++ {
+		res, err := client.attempt(req, retry)
+
+		var (
+			finalErr error
+			delay    = client.backoff(retry)
+		)
+
+		switch {
+		case err != nil:
+			finalErr = errorFromTransport(ctx, req, err)
+
+			// Errors that already are statuses come from a decision of the transport, such as an open circuit.
+			if _, isStatus := status.FromError(err); isStatus || ctx.Err() != nil {
+				return nil, finalErr
+			}
+		case res.StatusCode < http.StatusBadRequest:
+			return res, nil
+		default:
+			if retryAfter, ok := parseRetryAfter(res.Header.Get("Retry-After")); ok &&
+				(res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable) {
+				if retryAfter > client.config.MaxDelay {
+					return nil, errorFromResponse(req, res)
+				}
+
+				delay = retryAfter
+			}
+
+			if !retryableStatuses[res.StatusCode] {
+				return nil, errorFromResponse(req, res)
+			}
+
+			finalErr = errorFromResponse(req, res)
+		}
+
+		if !retryable || retry+1 >= client.config.MaxAttempts {
+			return nil, finalErr
+		}
+
+		// Don't wait if the next attempt cannot complete in time.
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return nil, finalErr
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, errorFromTransport(ctx, req, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+func NewClient(config Config) *Client {
+	if config.Transport == nil {
+		config.Transport = http.DefaultTransport
+	}
+
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultMaxAttempts
+	}
+
+	if config.BaseDelay <= 0 {
+		config.BaseDelay = DefaultBaseDelay
+	}
+
+	if config.MaxDelay <= 0 {
+		config.MaxDelay = DefaultMaxDelay
+	}
+
+	return &Client{
+		config: config,
+		client: &http.Client{Transport: config.Transport},
+	}
+}
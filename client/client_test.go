@@ -0,0 +1,255 @@
+package ahttpclient_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	ahttpclient "github.com/a-novel-kit/ahttp/client"
+)
+
+type attemptResponse struct {
+	status     int
+	retryAfter string
+	body       string
+	delay      time.Duration
+}
+
+func TestClient(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		config    ahttpclient.Config
+		method    string
+		body      string
+		header    http.Header
+		responses []attemptResponse
+
+		expectCode     codes.Code
+		expectMessage  string
+		expectAttempts int32
+		expectBodies   []string
+	}{
+		{
+			name: "Success",
+
+			method:    http.MethodGet,
+			responses: []attemptResponse{{status: http.StatusOK}},
+
+			expectCode:     codes.OK,
+			expectAttempts: 1,
+		},
+		{
+			name: "RetryThenSuccess",
+
+			method: http.MethodGet,
+			responses: []attemptResponse{
+				{status: http.StatusServiceUnavailable},
+				{status: http.StatusBadGateway},
+				{status: http.StatusOK},
+			},
+
+			expectCode:     codes.OK,
+			expectAttempts: 3,
+		},
+		{
+			name: "RetriesExhausted",
+
+			method: http.MethodGet,
+			responses: []attemptResponse{
+				{status: http.StatusServiceUnavailable},
+				{status: http.StatusServiceUnavailable},
+				{status: http.StatusServiceUnavailable, body: "down for maintenance"},
+			},
+
+			expectCode:     codes.Unavailable,
+			expectMessage:  "503 Service Unavailable: down for maintenance",
+			expectAttempts: 3,
+		},
+		{
+			name: "NotRetryableStatus",
+
+			method:    http.MethodGet,
+			responses: []attemptResponse{{status: http.StatusNotFound, body: "no such thing"}},
+
+			expectCode:     codes.NotFound,
+			expectMessage:  "404 Not Found: no such thing",
+			expectAttempts: 1,
+		},
+		{
+			name: "NotIdempotent",
+
+			method:    http.MethodPost,
+			body:      "foo",
+			responses: []attemptResponse{{status: http.StatusServiceUnavailable}},
+
+			expectCode:     codes.Unavailable,
+			expectAttempts: 1,
+			expectBodies:   []string{"foo"},
+		},
+		{
+			name: "IdempotencyKey",
+
+			method: http.MethodPost,
+			body:   "foo",
+			header: http.Header{"Idempotency-Key": []string{"abc"}},
+			responses: []attemptResponse{
+				{status: http.StatusServiceUnavailable},
+				{status: http.StatusCreated},
+			},
+
+			expectCode:     codes.OK,
+			expectAttempts: 2,
+			expectBodies:   []string{"foo", "foo"},
+		},
+		{
+			name: "RetryAfter",
+
+			method: http.MethodGet,
+			responses: []attemptResponse{
+				{status: http.StatusTooManyRequests, retryAfter: "0"},
+				{status: http.StatusOK},
+			},
+
+			expectCode:     codes.OK,
+			expectAttempts: 2,
+		},
+		{
+			name: "RetryAfterTooLong",
+
+			method: http.MethodGet,
+			responses: []attemptResponse{
+				{status: http.StatusTooManyRequests, retryAfter: "3600"},
+			},
+
+			expectCode:     codes.ResourceExhausted,
+			expectAttempts: 1,
+		},
+		{
+			name: "AttemptTimeout",
+
+			config: ahttpclient.Config{AttemptTimeout: 20 * time.Millisecond},
+			method: http.MethodGet,
+			responses: []attemptResponse{
+				{status: http.StatusOK, delay: 200 * time.Millisecond},
+				{status: http.StatusOK},
+			},
+
+			expectCode:     codes.OK,
+			expectAttempts: 2,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var attempts atomic.Int32
+
+			bodies := make(chan string, 10)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempt := attempts.Add(1)
+				response := testCase.responses[min(int(attempt), len(testCase.responses))-1]
+
+				body, _ := io.ReadAll(r.Body)
+				if len(body) > 0 {
+					bodies <- string(body)
+				}
+
+				select {
+				case <-time.After(response.delay):
+				case <-r.Context().Done():
+					return
+				}
+
+				if response.retryAfter != "" {
+					w.Header().Set("Retry-After", response.retryAfter)
+				}
+
+				w.WriteHeader(response.status)
+				_, _ = w.Write([]byte(response.body))
+			}))
+			defer server.Close()
+
+			config := testCase.config
+			config.BaseDelay = time.Millisecond
+
+			client := ahttpclient.NewClient(config)
+
+			var body io.Reader
+			if testCase.body != "" {
+				body = strings.NewReader(testCase.body)
+			}
+
+			req, err := http.NewRequestWithContext(context.Background(), testCase.method, server.URL, body)
+			require.NoError(t, err)
+
+			for key, values := range testCase.header {
+				req.Header[key] = values
+			}
+
+			res, err := client.Do(req)
+			if err == nil {
+				require.NoError(t, res.Body.Close())
+			}
+
+			require.Equal(t, testCase.expectCode, status.Code(err))
+			require.Equal(t, testCase.expectAttempts, attempts.Load())
+
+			if testCase.expectMessage != "" {
+				require.Contains(t, status.Convert(err).Message(), testCase.expectMessage)
+			}
+
+			close(bodies)
+
+			var receivedBodies []string
+			for receivedBody := range bodies {
+				receivedBodies = append(receivedBodies, receivedBody)
+			}
+
+			require.Equal(t, testCase.expectBodies, receivedBodies)
+		})
+	}
+}
+
+func TestClientTransportError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	client := ahttpclient.NewClient(ahttpclient.Config{BaseDelay: time.Millisecond})
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	_, err = client.Do(req)
+	require.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestClientContextCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := ahttpclient.NewClient(ahttpclient.Config{MaxAttempts: 10, BaseDelay: time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = client.Do(req)
+
+	require.Error(t, err)
+	require.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,232 @@
+package ahttp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultMaxStreamItemSize is the default maximum size of a single item forwarded by ForwardClientStream.
+const DefaultMaxStreamItemSize = 64 * 1024
+
+var (
+	ErrStreamItemTooLarge       = errors.New("stream item too large")
+	ErrTooManyStreamItems       = errors.New("too many stream items")
+	ErrUnsupportedStreamContent = errors.New("unsupported stream content type")
+)
+
+type ClientStreamConfig[Req any] struct {
+	// MaxBodySize is the maximum number of bytes read from the request body. Zero means no limit.
+	MaxBodySize int64
+	// MaxItems is the maximum number of messages sent to the stream. Zero means no limit.
+	MaxItems int
+	// MaxItemSize is the maximum size of a single NDJSON line, and the size of multipart chunks.
+	// Defaults to DefaultMaxStreamItemSize.
+	MaxItemSize int
+
+	// NewChunk builds a stream message out of a chunk of a multipart part. Multipart bodies are rejected
+	// if it is nil.
+	NewChunk func(part *multipart.Part, chunk []byte) (*Req, error)
+}
+
+// unmarshalStreamMessage decodes a JSON stream item. Protobuf messages use the protojson mapping.
+func unmarshalStreamMessage(data []byte, msg any) error {
+	if protoMsg, ok := msg.(proto.Message); ok {
+		return protojson.Unmarshal(data, protoMsg)
+	}
+
+	return json.Unmarshal(data, msg)
+}
+
+// abortWithBodyError terminates a request whose body could not be read. Size violations map to 413, everything
+// else to 422.
+func abortWithBodyError(ctx *gin.Context, err error) {
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		HandleGRPCErrorProblem(ctx, err)
+	case errors.Is(err, ErrStreamItemTooLarge), errors.Is(err, ErrTooManyStreamItems):
+		abortWithProblem(ctx, newProblem(http.StatusRequestEntityTooLarge, err.Error()), err)
+	case errors.Is(err, ErrUnsupportedStreamContent):
+		abortWithProblem(ctx, newProblem(http.StatusUnsupportedMediaType, err.Error()), err)
+	default:
+		abortWithProblem(ctx, newProblem(http.StatusUnprocessableEntity, err.Error()), err)
+	}
+}
+
+type clientStreamForwarder[Req, Res any] struct {
+	stream grpc.ClientStreamingClient[Req, Res]
+	config ClientStreamConfig[Req]
+
+	items int
+}
+
+// send forwards a message to the stream. Errors returned by the stream are wrapped in a streamSendError.
+func (forwarder *clientStreamForwarder[Req, Res]) send(msg *Req) error {
+	forwarder.items++
+	if forwarder.config.MaxItems > 0 && forwarder.items > forwarder.config.MaxItems {
+		return fmt.Errorf("%w: more than %d items", ErrTooManyStreamItems, forwarder.config.MaxItems)
+	}
+
+	if err := forwarder.stream.Send(msg); err != nil {
+		return &streamSendError{err: err}
+	}
+
+	return nil
+}
+
+func (forwarder *clientStreamForwarder[Req, Res]) forwardNDJSON(body io.Reader) error {
+	scanner := bufio.NewScanner(body)
+	initialSize := min(forwarder.config.MaxItemSize, bufio.MaxScanTokenSize)
+	scanner.Buffer(make([]byte, 0, initialSize), forwarder.config.MaxItemSize)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		msg := new(Req)
+		if err := unmarshalStreamMessage(line, msg); err != nil {
+			// The last line may be truncated because the body could not be read entirely.
+			if scanner.Err() != nil {
+				return scanner.Err()
+			}
+
+			return fmt.Errorf("decode item %d: %w", forwarder.items+1, err)
+		}
+
+		if err := forwarder.send(msg); err != nil {
+			return err
+		}
+	}
+
+	if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		return fmt.Errorf("%w: line exceeds %d bytes", ErrStreamItemTooLarge, forwarder.config.MaxItemSize)
+	}
+
+	return scanner.Err()
+}
+
+func (forwarder *clientStreamForwarder[Req, Res]) forwardMultipart(reader *multipart.Reader) error {
+	buffer := make([]byte, forwarder.config.MaxItemSize)
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("read part: %w", err)
+		}
+
+		for {
+			n, err := io.ReadFull(part, buffer)
+			if n > 0 {
+				msg, chunkErr := forwarder.config.NewChunk(part, bytes.Clone(buffer[:n]))
+				if chunkErr != nil {
+					return fmt.Errorf("decode chunk: %w", chunkErr)
+				}
+
+				if sendErr := forwarder.send(msg); sendErr != nil {
+					return sendErr
+				}
+			}
+
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+
+			if err != nil {
+				return fmt.Errorf("read part: %w", err)
+			}
+		}
+	}
+}
+
+// streamSendError wraps errors returned by the gRPC stream, so they are not mistaken for body errors.
+type streamSendError struct {
+	err error
+}
+
+func (err *streamSendError) Error() string {
+	return err.err.Error()
+}
+
+func (err *streamSendError) Unwrap() error {
+	return err.err
+}
+
+// ForwardClientStream reads the request body incrementally, and forwards each item to a client-streaming RPC.
+// It returns the response of the RPC, and a boolean indicating whether the context was terminated.
+//
+// NDJSON bodies are decoded one line at a time, each line being a message. Multipart bodies are split into
+// chunks of config.MaxItemSize bytes, converted to messages by config.NewChunk.
+//
+// Oversized bodies or items, and too many items, are rejected with 413. Malformed bodies are rejected with 422.
+// Errors returned by the stream are handled by HandleGRPCErrorProblem.
+//
+// The stream must be opened with ctx.Request.Context(): when the body is rejected, the stream is not closed,
+// and the upload is cancelled instead of being committed when the request completes.
+func ForwardClientStream[Req, Res any](
+	ctx *gin.Context, stream grpc.ClientStreamingClient[Req, Res], config ClientStreamConfig[Req],
+) (*Res, bool) {
+	if config.MaxItemSize <= 0 {
+		config.MaxItemSize = DefaultMaxStreamItemSize
+	}
+
+	body := ctx.Request.Body
+	if config.MaxBodySize > 0 {
+		body = http.MaxBytesReader(ctx.Writer, body, config.MaxBodySize)
+	}
+
+	forwarder := &clientStreamForwarder[Req, Res]{stream: stream, config: config}
+
+	var err error
+
+	switch contentType := ctx.ContentType(); {
+	case contentType == ContentTypeNDJSON || contentType == "application/jsonl":
+		err = forwarder.forwardNDJSON(body)
+	case strings.HasPrefix(contentType, "multipart/") && config.NewChunk != nil:
+		ctx.Request.Body = body
+
+		var reader *multipart.Reader
+		if reader, err = ctx.Request.MultipartReader(); err == nil {
+			err = forwarder.forwardMultipart(reader)
+		}
+	default:
+		err = fmt.Errorf("%w: %q", ErrUnsupportedStreamContent, contentType)
+	}
+
+	var sendErr *streamSendError
+
+	switch {
+	case errors.As(err, &sendErr) && errors.Is(sendErr.err, io.EOF):
+		// The server closed the stream early: its status is returned by CloseAndRecv.
+	case sendErr != nil:
+		return nil, HandleGRPCErrorProblem(ctx, sendErr.err)
+	case err != nil:
+		abortWithBodyError(ctx, err)
+		return nil, true
+	}
+
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, HandleGRPCErrorProblem(ctx, err)
+	}
+
+	return res, false
+}
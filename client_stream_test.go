@@ -0,0 +1,216 @@
+package ahttp_test
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+type fakeClientStream struct {
+	grpc.ClientStream
+
+	sendErr  error
+	closeErr error
+
+	received []string
+}
+
+func (stream *fakeClientStream) Send(msg *wrapperspb.StringValue) error {
+	if stream.sendErr != nil {
+		return stream.sendErr
+	}
+
+	stream.received = append(stream.received, msg.GetValue())
+
+	return nil
+}
+
+func (stream *fakeClientStream) CloseAndRecv() (*wrapperspb.Int64Value, error) {
+	if stream.closeErr != nil {
+		return nil, stream.closeErr
+	}
+
+	return wrapperspb.Int64(int64(len(stream.received))), nil
+}
+
+func multipartBody(t *testing.T, parts map[string]string) (string, io.Reader) {
+	t.Helper()
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+
+	for name, content := range parts {
+		part, err := writer.CreateFormFile(name, name+".txt")
+		require.NoError(t, err)
+
+		_, err = part.Write([]byte(content))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, writer.Close())
+
+	return writer.FormDataContentType(), body
+}
+
+func TestForwardClientStream(t *testing.T) {
+	newChunk := func(part *multipart.Part, chunk []byte) (*wrapperspb.StringValue, error) {
+		return wrapperspb.String(part.FormName() + ":" + string(chunk)), nil
+	}
+
+	testCases := []struct {
+		name string
+
+		contentType string
+		body        func(t *testing.T) (string, io.Reader)
+		config      ahttp.ClientStreamConfig[wrapperspb.StringValue]
+		stream      *fakeClientStream
+
+		expect           *wrapperspb.Int64Value
+		expectTerminated bool
+		expectCode       int
+		expectReceived   []string
+	}{
+		{
+			name: "NDJSON",
+
+			body: func(_ *testing.T) (string, io.Reader) {
+				return ahttp.ContentTypeNDJSON, strings.NewReader("\"foo\"\n\n\"bar\"\n\"baz\"")
+			},
+			stream: &fakeClientStream{},
+
+			expect:         wrapperspb.Int64(3),
+			expectCode:     http.StatusOK,
+			expectReceived: []string{"foo", "bar", "baz"},
+		},
+		{
+			name: "NDJSON/Malformed",
+
+			body: func(_ *testing.T) (string, io.Reader) {
+				return ahttp.ContentTypeNDJSON, strings.NewReader("\"foo\"\n{not json\n")
+			},
+			stream: &fakeClientStream{},
+
+			expectTerminated: true,
+			expectCode:       http.StatusUnprocessableEntity,
+			expectReceived:   []string{"foo"},
+		},
+		{
+			name: "NDJSON/ItemTooLarge",
+
+			body: func(_ *testing.T) (string, io.Reader) {
+				return ahttp.ContentTypeNDJSON, strings.NewReader("\"foo\"\n\"" + strings.Repeat("a", 32) + "\"\n")
+			},
+			config: ahttp.ClientStreamConfig[wrapperspb.StringValue]{MaxItemSize: 16},
+			stream: &fakeClientStream{},
+
+			expectTerminated: true,
+			expectCode:       http.StatusRequestEntityTooLarge,
+			expectReceived:   []string{"foo"},
+		},
+		{
+			name: "NDJSON/TooManyItems",
+
+			body: func(_ *testing.T) (string, io.Reader) {
+				return ahttp.ContentTypeNDJSON, strings.NewReader("\"foo\"\n\"bar\"\n\"baz\"\n")
+			},
+			config: ahttp.ClientStreamConfig[wrapperspb.StringValue]{MaxItems: 2},
+			stream: &fakeClientStream{},
+
+			expectTerminated: true,
+			expectCode:       http.StatusRequestEntityTooLarge,
+			expectReceived:   []string{"foo", "bar"},
+		},
+		{
+			name: "NDJSON/BodyTooLarge",
+
+			body: func(_ *testing.T) (string, io.Reader) {
+				return ahttp.ContentTypeNDJSON, strings.NewReader("\"foo\"\n\"bar\"\n\"baz\"\n")
+			},
+			config: ahttp.ClientStreamConfig[wrapperspb.StringValue]{MaxBodySize: 8},
+			stream: &fakeClientStream{},
+
+			expectTerminated: true,
+			expectCode:       http.StatusRequestEntityTooLarge,
+			expectReceived:   []string{"foo"},
+		},
+		{
+			name: "Multipart",
+
+			body: func(t *testing.T) (string, io.Reader) {
+				return multipartBody(t, map[string]string{"file": "abcdefghij"})
+			},
+			config: ahttp.ClientStreamConfig[wrapperspb.StringValue]{MaxItemSize: 4, NewChunk: newChunk},
+			stream: &fakeClientStream{},
+
+			expect:         wrapperspb.Int64(3),
+			expectCode:     http.StatusOK,
+			expectReceived: []string{"file:abcd", "file:efgh", "file:ij"},
+		},
+		{
+			name: "Multipart/NoChunkBuilder",
+
+			body: func(t *testing.T) (string, io.Reader) {
+				return multipartBody(t, map[string]string{"file": "abcdefghij"})
+			},
+			stream: &fakeClientStream{},
+
+			expectTerminated: true,
+			expectCode:       http.StatusUnsupportedMediaType,
+		},
+		{
+			name: "SendError",
+
+			body: func(_ *testing.T) (string, io.Reader) {
+				return ahttp.ContentTypeNDJSON, strings.NewReader("\"foo\"\n")
+			},
+			stream: &fakeClientStream{sendErr: status.Error(codes.Unavailable, "gone")},
+
+			expectTerminated: true,
+			expectCode:       http.StatusServiceUnavailable,
+		},
+		{
+			name: "ServerClosedEarly",
+
+			body: func(_ *testing.T) (string, io.Reader) {
+				return ahttp.ContentTypeNDJSON, strings.NewReader("\"foo\"\n")
+			},
+			stream: &fakeClientStream{
+				sendErr:  io.EOF,
+				closeErr: status.Error(codes.InvalidArgument, "bad"),
+			},
+
+			expectTerminated: true,
+			expectCode:       http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			contentType, body := testCase.body(t)
+
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/foo", body)
+			ctx.Request.Header.Set("Content-Type", contentType)
+
+			res, terminated := ahttp.ForwardClientStream(ctx, testCase.stream, testCase.config)
+			require.Equal(t, testCase.expectTerminated, terminated)
+			require.Equal(t, testCase.expect.GetValue(), res.GetValue())
+			require.Equal(t, testCase.expectCode, w.Code)
+			require.Equal(t, testCase.expectReceived, testCase.stream.received)
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package ahttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// coalescedCall is a request in flight, whose response is shared with identical requests.
+type coalescedCall struct {
+	done chan struct{}
+	// response is nil if the leader could not produce a response for its followers.
+	response *StoredResponse
+	errs     []error
+}
+
+// CoalesceByRequest identifies requests by their URI, and their Authorization and Cookie headers, so clients only
+// share responses they are allowed to see.
+func CoalesceByRequest(ctx *gin.Context) string {
+	return ctx.Request.URL.RequestURI() + "\x00" + ctx.GetHeader("Authorization") + "\x00" + ctx.GetHeader("Cookie")
+}
+
+type CoalesceConfig struct {
+	// Key identifies identical requests. Defaults to CoalesceByRequest. Requests with an empty key are not
+	// coalesced.
+	Key func(ctx *gin.Context) string
+}
+
+type coalescer struct {
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+// join returns the call in flight for key, or registers a new one. It reports whether the caller leads it.
+func (coalescer *coalescer) join(key string) (*coalescedCall, bool) {
+	coalescer.mu.Lock()
+	defer coalescer.mu.Unlock()
+
+	if call, ok := coalescer.calls[key]; ok {
+		return call, false
+	}
+
+	call := &coalescedCall{done: make(chan struct{})}
+	coalescer.calls[key] = call
+
+	return call, true
+}
+
+func (coalescer *coalescer) leave(key string, call *coalescedCall) {
+	coalescer.mu.Lock()
+	delete(coalescer.calls, key)
+	coalescer.mu.Unlock()
+
+	close(call.done)
+}
+
+// CoalesceMiddleware deduplicates identical GET requests in flight. The first request runs the handler, and
+// the others wait for it to share its response, including its status and errors. Coalesced requests are marked
+// in the report.
+//
+// If the first request fails to produce a response, because it panicked or its client went away, the others
+// run the handler themselves.
+func CoalesceMiddleware(config CoalesceConfig) gin.HandlerFunc {
+	if config.Key == nil {
+		config.Key = CoalesceByRequest
+	}
+
+	coalescer := &coalescer{calls: make(map[string]*coalescedCall)}
+
+	return func(ctx *gin.Context) {
+		if ctx.Request.Method != http.MethodGet || ctx.GetHeader("Upgrade") != "" {
+			ctx.Next()
+			return
+		}
+
+		key := config.Key(ctx)
+		if key == "" {
+			ctx.Next()
+			return
+		}
+
+		call, leader := coalescer.join(key)
+		if !leader {
+			select {
+			case <-call.done:
+			case <-ctx.Request.Context().Done():
+				_ = ctx.Error(ctx.Request.Context().Err())
+				ctx.Abort()
+
+				return
+			}
+
+			if call.response == nil {
+				ctx.Next()
+				return
+			}
+
+			ctx.Set(reportCoalescedKey, true)
+
+			for _, err := range call.errs {
+				_ = ctx.Error(err)
+			}
+
+			call.response.write(ctx.Writer)
+			ctx.Abort()
+
+			return
+		}
+
+		defer coalescer.leave(key, call)
+
+		original := ctx.Writer
+		recorder := newResponseRecorder(original)
+		ctx.Writer = recorder
+
+		ctx.Next()
+
+		ctx.Writer = original
+
+		if errors.Is(ctx.Request.Context().Err(), context.Canceled) {
+			return
+		}
+
+		call.response = recorder.response()
+
+		for _, err := range ctx.Errors {
+			call.errs = append(call.errs, err.Err)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package ahttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/a-novel-kit/quicklog"
+	quicklogmocks "github.com/a-novel-kit/quicklog/mocks"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+// serveConcurrently sends a first request, then the others while the handler of the first one is blocked.
+func serveConcurrently(
+	router *gin.Engine, entered <-chan struct{}, release chan<- struct{}, requests []*http.Request,
+) []*httptest.ResponseRecorder {
+	responses := make([]*httptest.ResponseRecorder, len(requests))
+
+	var wg sync.WaitGroup
+
+	serve := func(i int) {
+		defer wg.Done()
+
+		responses[i] = httptest.NewRecorder()
+		router.ServeHTTP(responses[i], requests[i])
+	}
+
+	wg.Add(len(requests))
+
+	go serve(0)
+	<-entered
+
+	for i := 1; i < len(requests); i++ {
+		go serve(i)
+	}
+
+	// Gives the other requests time to join the first one.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	return responses
+}
+
+func TestCoalesceMiddleware(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		uris    []string
+		handler func(ctx *gin.Context)
+
+		expectCalls  int64
+		expectCode   int
+		expectBody   string
+		expectHeader string
+	}{
+		{
+			name: "Success",
+
+			uris: []string{"/foo?a=1", "/foo?a=1", "/foo?a=1", "/foo?a=1"},
+			handler: func(ctx *gin.Context) {
+				ctx.Header("X-Foo", "bar")
+				ctx.String(http.StatusOK, "hello")
+			},
+
+			expectCalls:  1,
+			expectCode:   http.StatusOK,
+			expectBody:   "hello",
+			expectHeader: "bar",
+		},
+		{
+			name: "Error",
+
+			uris: []string{"/foo", "/foo", "/foo"},
+			handler: func(ctx *gin.Context) {
+				ahttp.HandleGRPCErrorProblem(ctx, status.Error(codes.Unavailable, "backend down"))
+			},
+
+			expectCalls: 1,
+			expectCode:  http.StatusServiceUnavailable,
+			expectBody:  `{"title":"Service Unavailable","status":503,"detail":"backend down","code":"Unavailable"}`,
+		},
+		{
+			name: "DifferentQueries",
+
+			uris: []string{"/foo?a=1", "/foo?a=2", "/foo?a=1"},
+			handler: func(ctx *gin.Context) {
+				ctx.String(http.StatusOK, "hello")
+			},
+
+			expectCalls: 2,
+			expectCode:  http.StatusOK,
+			expectBody:  "hello",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var calls atomic.Int64
+
+			entered := make(chan struct{}, len(testCase.uris))
+			release := make(chan struct{})
+
+			router := gin.New()
+			router.GET("/foo", ahttp.CoalesceMiddleware(ahttp.CoalesceConfig{}), func(ctx *gin.Context) {
+				calls.Add(1)
+				entered <- struct{}{}
+				<-release
+				testCase.handler(ctx)
+			})
+
+			requests := make([]*http.Request, len(testCase.uris))
+			for i, uri := range testCase.uris {
+				requests[i] = httptest.NewRequest(http.MethodGet, uri, nil)
+			}
+
+			for _, w := range serveConcurrently(router, entered, release, requests) {
+				require.Equal(t, testCase.expectCode, w.Code)
+				require.Equal(t, testCase.expectBody, w.Body.String())
+				require.Equal(t, testCase.expectHeader, w.Header().Get("X-Foo"))
+			}
+
+			require.Equal(t, testCase.expectCalls, calls.Load())
+		})
+	}
+}
+
+func TestCoalesceMiddlewareCredentials(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		header string
+		values []string
+	}{
+		{
+			name: "Authorization",
+
+			header: "Authorization",
+			values: []string{"Bearer alice", "Bearer bob"},
+		},
+		{
+			name: "Cookie",
+
+			header: "Cookie",
+			values: []string{"session=alice", "session=bob"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var calls atomic.Int64
+
+			entered := make(chan struct{}, 2)
+			release := make(chan struct{})
+
+			router := gin.New()
+			router.GET("/foo", ahttp.CoalesceMiddleware(ahttp.CoalesceConfig{}), func(ctx *gin.Context) {
+				calls.Add(1)
+				entered <- struct{}{}
+				<-release
+				ctx.String(http.StatusOK, ctx.GetHeader(testCase.header))
+			})
+
+			requests := []*http.Request{
+				httptest.NewRequest(http.MethodGet, "/foo", nil),
+				httptest.NewRequest(http.MethodGet, "/foo", nil),
+			}
+			requests[0].Header.Set(testCase.header, testCase.values[0])
+			requests[1].Header.Set(testCase.header, testCase.values[1])
+
+			responses := serveConcurrently(router, entered, release, requests)
+
+			require.Equal(t, testCase.values[0], responses[0].Body.String())
+			require.Equal(t, testCase.values[1], responses[1].Body.String())
+			require.Equal(t, int64(2), calls.Load())
+		})
+	}
+}
+
+func TestCoalesceMiddlewareLeaderPanic(t *testing.T) {
+	var calls atomic.Int64
+
+	entered := make(chan struct{}, 3)
+	release := make(chan struct{})
+
+	router := gin.New()
+	router.Use(gin.CustomRecovery(func(ctx *gin.Context, _ any) {
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	router.GET("/foo", ahttp.CoalesceMiddleware(ahttp.CoalesceConfig{}), func(ctx *gin.Context) {
+		entered <- struct{}{}
+		<-release
+
+		if calls.Add(1) == 1 {
+			panic("oops")
+		}
+
+		ctx.String(http.StatusOK, "hello")
+	})
+
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/foo", nil),
+		httptest.NewRequest(http.MethodGet, "/foo", nil),
+		httptest.NewRequest(http.MethodGet, "/foo", nil),
+	}
+
+	responses := serveConcurrently(router, entered, release, requests)
+
+	// The followers ran the handler themselves, and may have been coalesced again.
+	require.Equal(t, http.StatusInternalServerError, responses[0].Code)
+	require.Equal(t, http.StatusOK, responses[1].Code)
+	require.Equal(t, http.StatusOK, responses[2].Code)
+	require.GreaterOrEqual(t, calls.Load(), int64(2))
+}
+
+func TestCoalesceMiddlewareReport(t *testing.T) {
+	var coalesced atomic.Int64
+
+	logger := quicklogmocks.NewMockLogger(t)
+	logger.
+		On("Log", quicklog.LevelError, mock.Anything).
+		Run(func(args mock.Arguments) {
+			report := args.Get(1).(quicklog.Message).RenderJSON()
+			require.Equal(t, []string{"rpc error: code = Unavailable desc = backend down"}, report["errors"])
+
+			if report["coalesced"] == true {
+				coalesced.Add(1)
+			}
+		}).
+		Times(3)
+
+	entered := make(chan struct{}, 3)
+	release := make(chan struct{})
+
+	router := gin.New()
+	router.Use(ahttp.ReportMiddleware(logger, ""))
+	router.GET("/foo", ahttp.CoalesceMiddleware(ahttp.CoalesceConfig{}), func(ctx *gin.Context) {
+		entered <- struct{}{}
+		<-release
+		ahttp.HandleGRPCErrorProblem(ctx, status.Error(codes.Unavailable, "backend down"))
+	})
+
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/foo", nil),
+		httptest.NewRequest(http.MethodGet, "/foo", nil),
+		httptest.NewRequest(http.MethodGet, "/foo", nil),
+	}
+
+	serveConcurrently(router, entered, release, requests)
+
+	require.Equal(t, int64(2), coalesced.Load())
+	logger.AssertExpectations(t)
+}
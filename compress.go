@@ -0,0 +1,413 @@
+package ahttp
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	ahttpmessages "github.com/a-novel-kit/ahttp/messages"
+)
+
+const (
+	DefaultCompressionMinSize  = 1024
+	DefaultMaxDecompressedSize = 10 << 20
+)
+
+const (
+	acceptEncodingHeader  = "Accept-Encoding"
+	contentEncodingHeader = "Content-Encoding"
+	identityEncoding      = "identity"
+	wildcardEncoding      = "*"
+)
+
+// DefaultCompressibleContentTypes are the media types compressed by default. Entries ending with a slash match
+// every subtype. Event streams are never compressed, since compression buffers events.
+var DefaultCompressibleContentTypes = []string{
+	"text/",
+	"application/json",
+	"application/problem+json",
+	"application/x-ndjson",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+var ErrUnsupportedContentEncoding = errors.New("unsupported content encoding")
+
+// Encoding is a content coding, such as gzip.
+type Encoding struct {
+	// Name is the token of the coding, in the Accept-Encoding and Content-Encoding headers.
+	Name      string
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+	// NewReader is used to decompress request bodies. It can be nil for encodings only used for responses.
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+var GzipEncoding = Encoding{
+	Name: "gzip",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	},
+	NewReader: func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+}
+
+// DeflateEncoding is the "deflate" coding of HTTP, which is actually the zlib format.
+var DeflateEncoding = Encoding{
+	Name: "deflate",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return zlib.NewWriter(w), nil
+	},
+	NewReader: func(r io.Reader) (io.ReadCloser, error) {
+		return zlib.NewReader(r)
+	},
+}
+
+type CompressionConfig struct {
+	// Encodings are the supported codings, in order of preference. Defaults to gzip and deflate. Other codings,
+	// such as zstd, can be added with their own Encoding.
+	Encodings []Encoding
+	// MinSize is the size under which responses are not compressed. Defaults to DefaultCompressionMinSize.
+	MinSize int
+	// ContentTypes are the media types to compress. Defaults to DefaultCompressibleContentTypes.
+	ContentTypes []string
+	// MaxDecompressedSize limits the size of request bodies, once decompressed. It protects against
+	// decompression bombs. Defaults to DefaultMaxDecompressedSize.
+	MaxDecompressedSize int64
+}
+
+func (config *CompressionConfig) encoding(name string) *Encoding {
+	for i, encoding := range config.Encodings {
+		if strings.EqualFold(encoding.Name, name) {
+			return &config.Encodings[i]
+		}
+	}
+
+	return nil
+}
+
+func (config *CompressionConfig) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == ContentTypeSSE {
+		return false
+	}
+
+	for _, allowed := range config.ContentTypes {
+		if mediaType == allowed || (strings.HasSuffix(allowed, "/") && strings.HasPrefix(mediaType, allowed)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// negotiateEncoding selects the encoding of a response, based on the Accept-Encoding header of the request.
+// Equal weights are broken by the order of preference of the server. It returns nil if the response must not
+// be encoded.
+func (config *CompressionConfig) negotiateEncoding(acceptEncoding string) *Encoding {
+	weights := make(map[string]float64)
+
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(item, ";")
+
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		weight := 1.0
+
+		if key, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(key) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+
+			weight = parsed
+		}
+
+		weights[name] = weight
+	}
+
+	var (
+		selected     *Encoding
+		selectedRank float64
+	)
+
+	for i, encoding := range config.Encodings {
+		weight, ok := weights[strings.ToLower(encoding.Name)]
+		if !ok {
+			weight, ok = weights[wildcardEncoding]
+		}
+
+		if ok && weight > selectedRank {
+			selected, selectedRank = &config.Encodings[i], weight
+		}
+	}
+
+	return selected
+}
+
+func bodyAllowedForStatus(status int) bool {
+	return status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// compressWriter buffers the beginning of the response, until it knows whether to compress it.
+type compressWriter struct {
+	gin.ResponseWriter
+
+	config   *CompressionConfig
+	encoding *Encoding
+
+	buffer       []byte
+	decided      bool
+	compressor   io.WriteCloser
+	uncompressed int64
+}
+
+// decide chooses whether to compress the response, and writes the buffered data. Streamed responses are
+// compressed regardless of their size, since it is unknown.
+func (writer *compressWriter) decide(streaming bool) {
+	if writer.decided {
+		return
+	}
+
+	writer.decided = true
+
+	header := writer.Header()
+	if header.Get("Content-Type") == "" && len(writer.buffer) > 0 {
+		header.Set("Content-Type", http.DetectContentType(writer.buffer))
+	}
+
+	compressible := writer.config.compressible(header.Get("Content-Type"))
+	if compressible && !slices.Contains(header.Values("Vary"), acceptEncodingHeader) {
+		header.Add("Vary", acceptEncodingHeader)
+	}
+
+	buffer := writer.buffer
+	writer.buffer = nil
+
+	if compressible &&
+		writer.encoding != nil &&
+		header.Get(contentEncodingHeader) == "" &&
+		bodyAllowedForStatus(writer.Status()) &&
+		(streaming || len(buffer) >= writer.config.MinSize) {
+		compressor, err := writer.encoding.NewWriter(writer.ResponseWriter)
+		if err == nil {
+			header.Del("Content-Length")
+			header.Set(contentEncodingHeader, writer.encoding.Name)
+
+			writer.compressor = compressor
+		}
+	}
+
+	if len(buffer) > 0 {
+		_, _ = writer.writeDecided(buffer)
+	}
+}
+
+func (writer *compressWriter) writeDecided(data []byte) (int, error) {
+	if writer.compressor != nil {
+		return writer.compressor.Write(data)
+	}
+
+	return writer.ResponseWriter.Write(data)
+}
+
+func (writer *compressWriter) Write(data []byte) (int, error) {
+	writer.uncompressed += int64(len(data))
+
+	if writer.decided {
+		return writer.writeDecided(data)
+	}
+
+	writer.buffer = append(writer.buffer, data...)
+	if len(writer.buffer) >= writer.config.MinSize {
+		writer.decide(false)
+	}
+
+	return len(data), nil
+}
+
+func (writer *compressWriter) WriteString(data string) (int, error) {
+	return writer.Write([]byte(data))
+}
+
+func (writer *compressWriter) WriteHeaderNow() {
+	writer.decide(false)
+	writer.ResponseWriter.WriteHeaderNow()
+}
+
+func (writer *compressWriter) Written() bool {
+	return writer.uncompressed > 0 || writer.ResponseWriter.Written()
+}
+
+func (writer *compressWriter) Flush() {
+	writer.decide(true)
+
+	if flusher, ok := writer.compressor.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+
+	writer.ResponseWriter.Flush()
+}
+
+// finish writes the rest of the response.
+func (writer *compressWriter) finish() {
+	writer.decide(false)
+
+	if writer.compressor != nil {
+		_ = writer.compressor.Close()
+	}
+}
+
+// countingReader counts the bytes read from a compressed request body.
+type countingReader struct {
+	io.ReadCloser
+
+	read int64
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.ReadCloser.Read(p)
+	reader.read += int64(n)
+
+	return n, err
+}
+
+// decompressedBody closes both the decompressor and the original body.
+type decompressedBody struct {
+	io.Reader
+
+	decompressor io.Closer
+	body         io.Closer
+}
+
+func (body *decompressedBody) Close() error {
+	return errors.Join(body.decompressor.Close(), body.body.Close())
+}
+
+// decompressRequest replaces the body of a compressed request with its decompressed content. It returns the
+// compressed and decompressed bodies, or nil if the request is not compressed.
+func decompressRequest(ctx *gin.Context, config *CompressionConfig) (*countingReader, *limitedBody, error) {
+	contentEncoding := strings.TrimSpace(ctx.GetHeader(contentEncodingHeader))
+	if contentEncoding == "" || strings.EqualFold(contentEncoding, identityEncoding) ||
+		ctx.Request.Body == nil || ctx.Request.Body == http.NoBody {
+		return nil, nil, nil
+	}
+
+	encoding := config.encoding(contentEncoding)
+	if encoding == nil || encoding.NewReader == nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnsupportedContentEncoding, contentEncoding)
+	}
+
+	compressed := &countingReader{ReadCloser: ctx.Request.Body}
+
+	decompressor, err := encoding.NewReader(compressed)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decompress request body: %w", err)
+	}
+
+	decompressed := &limitedBody{
+		ReadCloser: &decompressedBody{Reader: decompressor, decompressor: decompressor, body: compressed},
+		limit:      config.MaxDecompressedSize,
+	}
+
+	ctx.Request.Body = decompressed
+	ctx.Request.ContentLength = -1
+	ctx.Request.Header.Del(contentEncodingHeader)
+	ctx.Request.Header.Del("Content-Length")
+
+	return compressed, decompressed, nil
+}
+
+// CompressionMiddleware compresses responses, and decompresses request bodies.
+//
+// The encoding of responses is negotiated with the Accept-Encoding header. Only responses of at least MinSize
+// bytes, with a compressible content type, and no Content-Encoding of their own are compressed. Streamed
+// responses are compressed as soon as they are flushed, except event streams. Vary: Accept-Encoding is set on
+// every compressible response, so caches do not mix encodings.
+//
+// Request bodies with a supported Content-Encoding are decompressed transparently, up to MaxDecompressedSize
+// bytes. Other encodings are rejected with a 415 status.
+func CompressionMiddleware(config CompressionConfig) gin.HandlerFunc {
+	if config.Encodings == nil {
+		config.Encodings = []Encoding{GzipEncoding, DeflateEncoding}
+	}
+
+	if config.MinSize <= 0 {
+		config.MinSize = DefaultCompressionMinSize
+	}
+
+	if config.ContentTypes == nil {
+		config.ContentTypes = DefaultCompressibleContentTypes
+	}
+
+	if config.MaxDecompressedSize <= 0 {
+		config.MaxDecompressedSize = DefaultMaxDecompressedSize
+	}
+
+	return func(ctx *gin.Context) {
+		requestEncoding := ctx.GetHeader(contentEncodingHeader)
+
+		compressed, decompressed, err := decompressRequest(ctx, &config)
+		if err != nil {
+			httpStatus := http.StatusBadRequest
+			if errors.Is(err, ErrUnsupportedContentEncoding) {
+				httpStatus = http.StatusUnsupportedMediaType
+			}
+
+			abortWithProblem(ctx, newProblem(httpStatus, err.Error()), err)
+
+			return
+		}
+
+		original := ctx.Writer
+		writer := &compressWriter{
+			ResponseWriter: original,
+			config:         &config,
+			encoding:       config.negotiateEncoding(ctx.GetHeader(acceptEncodingHeader)),
+		}
+
+		ctx.Writer = writer
+
+		ctx.Next()
+
+		writer.finish()
+		ctx.Writer = original
+
+		if compressed == nil && writer.compressor == nil {
+			return
+		}
+
+		metrics := &ahttpmessages.CompressionMetrics{}
+
+		if compressed != nil {
+			metrics.RequestEncoding = strings.ToLower(requestEncoding)
+			metrics.RequestSize = compressed.read
+			metrics.UncompressedRequestSize = decompressed.read
+
+			if decompressed.exceeded {
+				ctx.Set(reportBodyLimitKey, decompressed.limit)
+			}
+		}
+
+		if writer.compressor != nil {
+			metrics.ResponseEncoding = writer.encoding.Name
+			metrics.ResponseSize = int64(max(original.Size(), 0))
+			metrics.UncompressedResponseSize = writer.uncompressed
+		}
+
+		ctx.Set(reportCompressionKey, metrics)
+	}
+}
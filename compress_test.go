@@ -0,0 +1,371 @@
+package ahttp_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a-novel-kit/quicklog"
+	quicklogmocks "github.com/a-novel-kit/quicklog/mocks"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+func gzipData(t *testing.T, data string) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+
+	writer := gzip.NewWriter(&buffer)
+	_, err := writer.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	return buffer.Bytes()
+}
+
+func decodeBody(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+
+	var (
+		reader io.Reader
+		err    error
+	)
+
+	switch encoding {
+	case "gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		reader, err = zlib.NewReader(bytes.NewReader(body))
+	default:
+		return string(body)
+	}
+
+	require.NoError(t, err)
+
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+
+	return string(data)
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	largeBody := strings.Repeat("hello world ", 200)
+
+	testCases := []struct {
+		name string
+
+		acceptEncoding string
+		handler        gin.HandlerFunc
+
+		expectEncoding string
+		expectVary     bool
+		expectBody     string
+	}{
+		{
+			name: "Gzip",
+
+			acceptEncoding: "gzip, deflate",
+			handler: func(ctx *gin.Context) {
+				ctx.String(http.StatusOK, largeBody)
+			},
+
+			expectEncoding: "gzip",
+			expectVary:     true,
+			expectBody:     largeBody,
+		},
+		{
+			name: "Deflate/Weights",
+
+			acceptEncoding: "gzip;q=0.5, deflate",
+			handler: func(ctx *gin.Context) {
+				ctx.String(http.StatusOK, largeBody)
+			},
+
+			expectEncoding: "deflate",
+			expectVary:     true,
+			expectBody:     largeBody,
+		},
+		{
+			name: "Wildcard",
+
+			acceptEncoding: "gzip;q=0, *",
+			handler: func(ctx *gin.Context) {
+				ctx.String(http.StatusOK, largeBody)
+			},
+
+			expectEncoding: "deflate",
+			expectVary:     true,
+			expectBody:     largeBody,
+		},
+		{
+			name: "NotAccepted",
+
+			acceptEncoding: "br",
+			handler: func(ctx *gin.Context) {
+				ctx.String(http.StatusOK, largeBody)
+			},
+
+			expectVary: true,
+			expectBody: largeBody,
+		},
+		{
+			name: "NoAcceptEncoding",
+
+			handler: func(ctx *gin.Context) {
+				ctx.String(http.StatusOK, largeBody)
+			},
+
+			expectVary: true,
+			expectBody: largeBody,
+		},
+		{
+			name: "TooSmall",
+
+			acceptEncoding: "gzip",
+			handler: func(ctx *gin.Context) {
+				ctx.String(http.StatusOK, "hello")
+			},
+
+			expectVary: true,
+			expectBody: "hello",
+		},
+		{
+			name: "ManySmallWrites",
+
+			acceptEncoding: "gzip",
+			handler: func(ctx *gin.Context) {
+				ctx.Header("Content-Type", "text/plain")
+
+				for range 200 {
+					_, _ = ctx.Writer.WriteString("hello world ")
+				}
+			},
+
+			expectEncoding: "gzip",
+			expectVary:     true,
+			expectBody:     largeBody,
+		},
+		{
+			name: "NotCompressible",
+
+			acceptEncoding: "gzip",
+			handler: func(ctx *gin.Context) {
+				ctx.Data(http.StatusOK, "image/png", []byte(largeBody))
+			},
+
+			expectBody: largeBody,
+		},
+		{
+			name: "AlreadyEncoded",
+
+			acceptEncoding: "gzip",
+			handler: func(ctx *gin.Context) {
+				ctx.Header("Content-Encoding", "br")
+				ctx.Data(http.StatusOK, "text/plain", []byte(largeBody))
+			},
+
+			expectEncoding: "br",
+			expectVary:     true,
+			expectBody:     largeBody,
+		},
+		{
+			name: "Streaming",
+
+			acceptEncoding: "gzip",
+			handler: func(ctx *gin.Context) {
+				ctx.Header("Content-Type", "application/x-ndjson")
+
+				_, _ = ctx.Writer.WriteString("{}\n")
+				ctx.Writer.Flush()
+				_, _ = ctx.Writer.WriteString("{}\n")
+			},
+
+			expectEncoding: "gzip",
+			expectVary:     true,
+			expectBody:     "{}\n{}\n",
+		},
+		{
+			name: "SSE",
+
+			acceptEncoding: "gzip",
+			handler: func(ctx *gin.Context) {
+				ctx.Header("Content-Type", ahttp.ContentTypeSSE)
+
+				_, _ = ctx.Writer.WriteString(largeBody)
+				ctx.Writer.Flush()
+			},
+
+			expectBody: largeBody,
+		},
+		{
+			name: "NoContent",
+
+			acceptEncoding: "gzip",
+			handler: func(ctx *gin.Context) {
+				ctx.Status(http.StatusNoContent)
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/foo", ahttp.CompressionMiddleware(ahttp.CompressionConfig{}), testCase.handler)
+
+			req := httptest.NewRequest(http.MethodGet, "/foo", nil)
+			if testCase.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", testCase.acceptEncoding)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, testCase.expectEncoding, w.Header().Get("Content-Encoding"))
+			require.Equal(t, testCase.expectVary, w.Header().Get("Vary") == "Accept-Encoding")
+			require.Equal(t, testCase.expectBody, decodeBody(t, testCase.expectEncoding, w.Body.Bytes()))
+		})
+	}
+}
+
+func TestCompressionMiddlewareRequest(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		contentEncoding string
+		body            []byte
+
+		expectCode int
+		expectBody string
+	}{
+		{
+			name: "Plain",
+
+			body: []byte("hello"),
+
+			expectCode: http.StatusOK,
+			expectBody: "hello",
+		},
+		{
+			name: "Gzip",
+
+			contentEncoding: "gzip",
+			body:            gzipData(t, "hello"),
+
+			expectCode: http.StatusOK,
+			expectBody: "hello",
+		},
+		{
+			name: "Gzip/Bomb",
+
+			contentEncoding: "gzip",
+			body:            gzipData(t, strings.Repeat("a", 1000)),
+
+			expectCode: http.StatusRequestEntityTooLarge,
+			expectBody: `{"title":"Request Entity Too Large","status":413,"detail":"request body exceeds 100 bytes"}`,
+		},
+		{
+			name: "Gzip/Invalid",
+
+			contentEncoding: "gzip",
+			body:            []byte("hello"),
+
+			expectCode: http.StatusBadRequest,
+			expectBody: `{"title":"Bad Request","status":400,` +
+				`"detail":"decompress request body: unexpected EOF","code":"FailedPrecondition"}`,
+		},
+		{
+			name: "Unsupported",
+
+			contentEncoding: "br",
+			body:            []byte("hello"),
+
+			expectCode: http.StatusUnsupportedMediaType,
+			expectBody: `{"title":"Unsupported Media Type","status":415,` +
+				`"detail":"unsupported content encoding: br"}`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router := gin.New()
+			router.POST(
+				"/foo",
+				ahttp.CompressionMiddleware(ahttp.CompressionConfig{MaxDecompressedSize: 100}),
+				func(ctx *gin.Context) {
+					require.Empty(t, ctx.GetHeader("Content-Encoding"))
+
+					data, err := io.ReadAll(ctx.Request.Body)
+					if err != nil {
+						ahttp.HandleGRPCErrorProblem(ctx, err)
+						return
+					}
+
+					ctx.String(http.StatusOK, string(data))
+				},
+			)
+
+			req := httptest.NewRequest(http.MethodPost, "/foo", bytes.NewReader(testCase.body))
+			if testCase.contentEncoding != "" {
+				req.Header.Set("Content-Encoding", testCase.contentEncoding)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, testCase.expectCode, w.Code)
+			require.Equal(t, testCase.expectBody, w.Body.String())
+		})
+	}
+}
+
+func TestCompressionMiddlewareReport(t *testing.T) {
+	requestBody := gzipData(t, strings.Repeat("a", 2000))
+	responseBody := strings.Repeat("hello world ", 200)
+
+	logger := quicklogmocks.NewMockLogger(t)
+	logger.
+		On("Log", quicklog.LevelInfo, mock.Anything).
+		Run(func(args mock.Arguments) {
+			report := args.Get(1).(quicklog.Message).RenderJSON()
+			compression := report["compression"].(map[string]interface{})
+
+			require.Equal(t, map[string]interface{}{
+				"encoding":         "gzip",
+				"size":             int64(len(requestBody)),
+				"uncompressedSize": int64(2000),
+			}, compression["request"])
+
+			response := compression["response"].(map[string]interface{})
+			require.Equal(t, "gzip", response["encoding"])
+			require.Equal(t, int64(len(responseBody)), response["uncompressedSize"])
+			require.Less(t, response["size"], int64(len(responseBody)))
+		}).
+		Once()
+
+	router := gin.New()
+	router.Use(ahttp.ReportMiddleware(logger, ""), ahttp.CompressionMiddleware(ahttp.CompressionConfig{}))
+	router.POST("/foo", func(ctx *gin.Context) {
+		_, _ = io.ReadAll(ctx.Request.Body)
+		ctx.String(http.StatusOK, responseBody)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/foo", bytes.NewReader(requestBody))
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	logger.AssertExpectations(t)
+}
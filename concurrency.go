@@ -0,0 +1,244 @@
+package ahttp
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PriorityHeader lets clients lower the priority of their requests. It cannot raise it above the priority of
+// the route.
+const PriorityHeader = "X-Request-Priority"
+
+const (
+	DefaultConcurrencyInitialLimit  = 20
+	DefaultConcurrencyMinLimit      = 1
+	DefaultConcurrencyMaxLimit      = 1000
+	DefaultConcurrencyLatencyTarget = time.Second
+	DefaultConcurrencyBackoffRatio  = 0.9
+)
+
+// Shares of the limit available to lower priorities.
+const (
+	prioritySheddableShare = 0.5
+	priorityDefaultShare   = 0.9
+)
+
+// The limit only grows while at least this share of it is in use.
+const concurrencyUtilizationRate = 0.5
+
+type Priority int
+
+const (
+	// PrioritySheddable requests are shed first, when the server is half loaded.
+	PrioritySheddable Priority = iota
+	// PriorityDefault requests are shed when the server is almost fully loaded.
+	PriorityDefault
+	// PriorityCritical requests are only shed when the server is fully loaded.
+	PriorityCritical
+)
+
+var priorityNames = map[Priority]string{
+	PrioritySheddable: "sheddable",
+	PriorityDefault:   "default",
+	PriorityCritical:  "critical",
+}
+
+func (priority Priority) String() string {
+	return priorityNames[priority]
+}
+
+// share returns the share of the concurrency limit that requests of this priority can use.
+func (priority Priority) share() float64 {
+	switch priority {
+	case PrioritySheddable:
+		return prioritySheddableShare
+	case PriorityCritical:
+		return 1
+	default:
+		return priorityDefaultShare
+	}
+}
+
+// ParsePriority parses the name of a priority, as sent in the PriorityHeader.
+func ParsePriority(name string) (Priority, bool) {
+	for priority, priorityName := range priorityNames {
+		if strings.EqualFold(strings.TrimSpace(name), priorityName) {
+			return priority, true
+		}
+	}
+
+	return PriorityDefault, false
+}
+
+type ConcurrencyLimiterConfig struct {
+	// InitialLimit is the number of concurrent requests allowed on startup.
+	// Defaults to DefaultConcurrencyInitialLimit.
+	InitialLimit int
+	// MinLimit and MaxLimit bound the limit. They default to DefaultConcurrencyMinLimit and
+	// DefaultConcurrencyMaxLimit.
+	MinLimit int
+	MaxLimit int
+
+	// LatencyTarget is the latency above which a request is considered a sign of overload.
+	// Defaults to DefaultConcurrencyLatencyTarget.
+	LatencyTarget time.Duration
+	// BackoffRatio is applied to the limit on signs of overload, at most once per round of requests.
+	// Defaults to DefaultConcurrencyBackoffRatio.
+	BackoffRatio float64
+
+	// Routes sets the priority of some routes, by full path (see gin.Context.FullPath). Other routes have the
+	// default priority.
+	Routes map[string]Priority
+}
+
+type ConcurrencyStats struct {
+	// Limit is the current number of concurrent requests allowed.
+	Limit    int
+	InFlight int
+	// Shed is the total number of requests shed, per priority.
+	Shed map[Priority]int64
+}
+
+// ConcurrencyLimiter limits the number of requests processed concurrently. The limit adapts to the observed
+// latency, using additive increase / multiplicative decrease (AIMD): it grows by one every time as many
+// requests complete in time, and shrinks by BackoffRatio whenever a request exceeds the latency target, or
+// fails with a 503 or 504 status. Requests that started before the last decrease were admitted under the old
+// limit, so they cannot decrease it again: a burst of slow requests only shrinks the limit once.
+//
+// Requests over the limit are shed immediately with codes.Unavailable, rather than queued. Lower priorities
+// are only allowed a share of the limit, so they are shed first.
+type ConcurrencyLimiter struct {
+	config ConcurrencyLimiterConfig
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	shed     map[Priority]int64
+	// lastDecrease is the time the limit was last decreased.
+	lastDecrease time.Time
+}
+
+func (limiter *ConcurrencyLimiter) priority(ctx *gin.Context) Priority {
+	priority, ok := limiter.config.Routes[ctx.FullPath()]
+	if !ok {
+		priority = PriorityDefault
+	}
+
+	if requested, ok := ParsePriority(ctx.GetHeader(PriorityHeader)); ok && requested < priority {
+		priority = requested
+	}
+
+	return priority
+}
+
+func (limiter *ConcurrencyLimiter) acquire(priority Priority) bool {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	if float64(limiter.inFlight) >= math.Max(1, math.Floor(limiter.limit*priority.share())) {
+		limiter.shed[priority]++
+		return false
+	}
+
+	limiter.inFlight++
+
+	return true
+}
+
+func (limiter *ConcurrencyLimiter) release(start time.Time, statusCode int) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	now := time.Now()
+	inFlight := limiter.inFlight
+	limiter.inFlight--
+
+	overloaded := now.Sub(start) > limiter.config.LatencyTarget ||
+		statusCode == http.StatusServiceUnavailable ||
+		statusCode == http.StatusGatewayTimeout
+
+	switch {
+	case overloaded && start.Before(limiter.lastDecrease):
+		// The limit already backed off for this round of requests.
+	case overloaded:
+		limiter.limit = math.Max(float64(limiter.config.MinLimit), limiter.limit*limiter.config.BackoffRatio)
+		limiter.lastDecrease = now
+	// Otherwise, the limit would grow forever under low traffic.
+	case float64(inFlight) >= limiter.limit*concurrencyUtilizationRate:
+		limiter.limit = math.Min(float64(limiter.config.MaxLimit), limiter.limit+1/limiter.limit)
+	}
+}
+
+// Stats returns the current state of the limiter, for export as metrics.
+func (limiter *ConcurrencyLimiter) Stats() ConcurrencyStats {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	shed := make(map[Priority]int64, len(limiter.shed))
+	for priority, count := range limiter.shed {
+		shed[priority] = count
+	}
+
+	return ConcurrencyStats{
+		Limit:    int(limiter.limit),
+		InFlight: limiter.inFlight,
+		Shed:     shed,
+	}
+}
+
+// Middleware returns the gin middleware that enforces the limit.
+func (limiter *ConcurrencyLimiter) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !limiter.acquire(limiter.priority(ctx)) {
+			ctx.Set(reportShedKey, true)
+			HandleGRPCErrorProblem(ctx, status.Error(codes.Unavailable, "server overloaded"))
+
+			return
+		}
+
+		start := time.Now()
+
+		defer func() {
+			limiter.release(start, ctx.Writer.Status())
+		}()
+
+		ctx.Next()
+	}
+}
+
+func NewConcurrencyLimiter(config ConcurrencyLimiterConfig) *ConcurrencyLimiter {
+	if config.MinLimit <= 0 {
+		config.MinLimit = DefaultConcurrencyMinLimit
+	}
+
+	if config.MaxLimit <= 0 {
+		config.MaxLimit = DefaultConcurrencyMaxLimit
+	}
+
+	if config.InitialLimit <= 0 {
+		config.InitialLimit = DefaultConcurrencyInitialLimit
+	}
+
+	config.InitialLimit = min(max(config.InitialLimit, config.MinLimit), config.MaxLimit)
+
+	if config.LatencyTarget <= 0 {
+		config.LatencyTarget = DefaultConcurrencyLatencyTarget
+	}
+
+	if config.BackoffRatio <= 0 || config.BackoffRatio >= 1 {
+		config.BackoffRatio = DefaultConcurrencyBackoffRatio
+	}
+
+	return &ConcurrencyLimiter{
+		config: config,
+		limit:  float64(config.InitialLimit),
+		shed:   make(map[Priority]int64),
+	}
+}
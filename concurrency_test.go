@@ -0,0 +1,247 @@
+package ahttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+func TestParsePriority(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		in string
+
+		expect   ahttp.Priority
+		expectOK bool
+	}{
+		{name: "Sheddable", in: "sheddable", expect: ahttp.PrioritySheddable, expectOK: true},
+		{name: "Default", in: "default", expect: ahttp.PriorityDefault, expectOK: true},
+		{name: "Critical", in: " Critical ", expect: ahttp.PriorityCritical, expectOK: true},
+		{name: "Unknown", in: "urgent", expect: ahttp.PriorityDefault, expectOK: false},
+		{name: "Empty", in: "", expect: ahttp.PriorityDefault, expectOK: false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			priority, ok := ahttp.ParsePriority(testCase.in)
+			require.Equal(t, testCase.expect, priority)
+			require.Equal(t, testCase.expectOK, ok)
+		})
+	}
+}
+
+func TestConcurrencyLimiterShedding(t *testing.T) {
+	// Sheddable requests can use 2 slots, default requests 3, and critical requests 4.
+	limiter := ahttp.NewConcurrencyLimiter(ahttp.ConcurrencyLimiterConfig{
+		InitialLimit: 4,
+		MinLimit:     4,
+		MaxLimit:     4,
+		Routes:       map[string]ahttp.Priority{"/critical": ahttp.PriorityCritical},
+	})
+
+	release := make(chan struct{})
+
+	router := gin.New()
+	router.Use(limiter.Middleware())
+	router.GET("/foo", func(ctx *gin.Context) {
+		<-release
+		ctx.Status(http.StatusOK)
+	})
+	router.GET("/critical", func(ctx *gin.Context) {
+		<-release
+		ctx.Status(http.StatusOK)
+	})
+
+	send := func(path, priority string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if priority != "" {
+			req.Header.Set(ahttp.PriorityHeader, priority)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		return w.Code
+	}
+
+	var wg sync.WaitGroup
+
+	admit := func(path, priority string) {
+		inFlight := limiter.Stats().InFlight
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			require.Equal(t, http.StatusOK, send(path, priority))
+		}()
+
+		require.Eventually(t, func() bool {
+			return limiter.Stats().InFlight == inFlight+1
+		}, time.Second, time.Millisecond)
+	}
+
+	admit("/critical", "")
+	admit("/critical", "")
+	require.Equal(t, http.StatusServiceUnavailable, send("/foo", "sheddable"))
+
+	admit("/foo", "")
+	require.Equal(t, http.StatusServiceUnavailable, send("/foo", ""))
+	// The header cannot raise the priority of a route.
+	require.Equal(t, http.StatusServiceUnavailable, send("/foo", "critical"))
+
+	admit("/critical", "")
+	require.Equal(t, http.StatusServiceUnavailable, send("/critical", ""))
+	// The header can lower the priority of a route.
+	require.Equal(t, http.StatusServiceUnavailable, send("/critical", "sheddable"))
+
+	close(release)
+	wg.Wait()
+
+	require.Equal(t, ahttp.ConcurrencyStats{
+		Limit:    4,
+		InFlight: 0,
+		Shed: map[ahttp.Priority]int64{
+			ahttp.PrioritySheddable: 2,
+			ahttp.PriorityDefault:   2,
+			ahttp.PriorityCritical:  1,
+		},
+	}, limiter.Stats())
+}
+
+func TestConcurrencyLimiterAdaptive(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		config ahttp.ConcurrencyLimiterConfig
+		delay  time.Duration
+		status int
+
+		expectLimit int
+	}{
+		{
+			name: "Increase",
+
+			config: ahttp.ConcurrencyLimiterConfig{InitialLimit: 1},
+			status: http.StatusOK,
+
+			expectLimit: 2,
+		},
+		{
+			name: "Increase/Max",
+
+			config: ahttp.ConcurrencyLimiterConfig{InitialLimit: 1, MaxLimit: 1},
+			status: http.StatusOK,
+
+			expectLimit: 1,
+		},
+		{
+			name: "Increase/Underused",
+
+			config: ahttp.ConcurrencyLimiterConfig{InitialLimit: 10},
+			status: http.StatusOK,
+
+			expectLimit: 10,
+		},
+		{
+			name: "DecreaseOnLatency",
+
+			config: ahttp.ConcurrencyLimiterConfig{InitialLimit: 10, LatencyTarget: 10 * time.Millisecond},
+			delay:  20 * time.Millisecond,
+			status: http.StatusOK,
+
+			expectLimit: 9,
+		},
+		{
+			name: "DecreaseOnUnavailable",
+
+			config: ahttp.ConcurrencyLimiterConfig{InitialLimit: 10, BackoffRatio: 0.5},
+			status: http.StatusServiceUnavailable,
+
+			expectLimit: 5,
+		},
+		{
+			name: "Decrease/Min",
+
+			config: ahttp.ConcurrencyLimiterConfig{InitialLimit: 10, MinLimit: 8, BackoffRatio: 0.5},
+			status: http.StatusGatewayTimeout,
+
+			expectLimit: 8,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			limiter := ahttp.NewConcurrencyLimiter(testCase.config)
+
+			router := gin.New()
+			router.Use(limiter.Middleware())
+			router.GET("/foo", func(ctx *gin.Context) {
+				time.Sleep(testCase.delay)
+				ctx.Status(testCase.status)
+			})
+
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/foo", nil))
+
+			require.Equal(t, testCase.expectLimit, limiter.Stats().Limit)
+		})
+	}
+}
+
+func TestConcurrencyLimiterBurst(t *testing.T) {
+	limiter := ahttp.NewConcurrencyLimiter(ahttp.ConcurrencyLimiterConfig{
+		InitialLimit:  10,
+		LatencyTarget: 10 * time.Millisecond,
+		BackoffRatio:  0.5,
+	})
+
+	release := make(chan struct{})
+
+	router := gin.New()
+	router.Use(limiter.Middleware())
+	router.GET("/foo", func(ctx *gin.Context) {
+		<-release
+		ctx.Status(http.StatusOK)
+	})
+
+	var wg sync.WaitGroup
+
+	for range 4 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/foo", nil))
+		}()
+	}
+
+	require.Eventually(t, func() bool {
+		return limiter.Stats().InFlight == 4
+	}, time.Second, time.Millisecond)
+
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// The whole burst was admitted under the same limit, so it only decreases it once.
+	require.Equal(t, 5, limiter.Stats().Limit)
+
+	// Requests that start after the decrease can decrease the limit again.
+	router.GET("/slow", func(ctx *gin.Context) {
+		time.Sleep(20 * time.Millisecond)
+		ctx.Status(http.StatusOK)
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	require.Equal(t, 2, limiter.Stats().Limit)
+}
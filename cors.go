@@ -0,0 +1,317 @@
+package ahttp
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var DefaultCORSMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+}
+
+var DefaultCORSHeaders = []string{
+	"Accept", "Accept-Language", "Authorization", "Content-Type", "If-Match", "If-None-Match", IdempotencyKeyHeader,
+}
+
+// CORSPolicy describes the cross-origin requests allowed on a route.
+type CORSPolicy struct {
+	// AllowedOrigins are exact origins, such as "https://example.com", or origins with a wildcard subdomain, such
+	// as "https://*.example.com". "*" allows any origin.
+	AllowedOrigins []string
+	// AllowedOriginPatterns are regular expressions, that must match the whole origin.
+	AllowedOriginPatterns []*regexp.Regexp
+
+	// AllowedMethods defaults to DefaultCORSMethods.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed. "*" allows any header. Defaults to DefaultCORSHeaders.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers readable by scripts, besides the CORS-safelisted ones.
+	ExposedHeaders []string
+
+	// AllowCredentials cannot be combined with the "*" origin, which would let any site read responses with the
+	// credentials of the user.
+	AllowCredentials bool
+	// MaxAge is the time browsers cache preflight responses for. The header is omitted when zero.
+	MaxAge time.Duration
+}
+
+type CORSConfig struct {
+	// Policy applies to every route that has no policy of its own.
+	Policy CORSPolicy
+	// Routes overrides Policy for some routes, by full path (see gin.Context.FullPath). Preflight requests do
+	// not match a route, unless an OPTIONS route is registered, so their path is matched against the patterns.
+	Routes map[string]CORSPolicy
+}
+
+type corsPolicy struct {
+	origins   map[string]bool
+	patterns  []*regexp.Regexp
+	anyOrigin bool
+
+	methods   []string
+	headers   map[string]bool
+	anyHeader bool
+
+	allowMethods  string
+	allowHeaders  string
+	exposeHeaders string
+	credentials   bool
+	maxAge        string
+}
+
+// wildcardOriginPattern matches the subdomains replaced by a "*" in an origin.
+const wildcardOriginPattern = `[a-zA-Z0-9-]+(?:\.[a-zA-Z0-9-]+)*`
+
+func newCORSPolicy(policy CORSPolicy) *corsPolicy {
+	if policy.AllowedMethods == nil {
+		policy.AllowedMethods = DefaultCORSMethods
+	}
+
+	if policy.AllowedHeaders == nil {
+		policy.AllowedHeaders = DefaultCORSHeaders
+	}
+
+	compiled := &corsPolicy{
+		origins:       make(map[string]bool),
+		headers:       make(map[string]bool),
+		methods:       policy.AllowedMethods,
+		allowMethods:  strings.Join(policy.AllowedMethods, ", "),
+		allowHeaders:  strings.Join(policy.AllowedHeaders, ", "),
+		exposeHeaders: strings.Join(policy.ExposedHeaders, ", "),
+		credentials:   policy.AllowCredentials,
+	}
+
+	if policy.MaxAge > 0 {
+		compiled.maxAge = strconv.Itoa(int(policy.MaxAge.Seconds()))
+	}
+
+	for _, origin := range policy.AllowedOrigins {
+		switch {
+		case origin == "*" && policy.AllowCredentials:
+			panic(`ahttp: CORS policies cannot allow credentials from any origin ("*")`)
+		case origin == "*":
+			compiled.anyOrigin = true
+		case strings.Contains(origin, "*"):
+			compiled.patterns = append(compiled.patterns, regexp.MustCompile(
+				"^"+strings.ReplaceAll(regexp.QuoteMeta(origin), `\*`, wildcardOriginPattern)+"$",
+			))
+		default:
+			compiled.origins[origin] = true
+		}
+	}
+
+	for _, pattern := range policy.AllowedOriginPatterns {
+		compiled.patterns = append(compiled.patterns, regexp.MustCompile("^(?:"+pattern.String()+")$"))
+	}
+
+	for _, header := range policy.AllowedHeaders {
+		if header == "*" {
+			compiled.anyHeader = true
+		}
+
+		compiled.headers[strings.ToLower(header)] = true
+	}
+
+	return compiled
+}
+
+func (policy *corsPolicy) allowsOrigin(origin string) bool {
+	if policy.anyOrigin || policy.origins[origin] {
+		return true
+	}
+
+	return slices.ContainsFunc(policy.patterns, func(pattern *regexp.Regexp) bool {
+		return pattern.MatchString(origin)
+	})
+}
+
+func (policy *corsPolicy) setOriginHeaders(ctx *gin.Context, origin string) {
+	if policy.anyOrigin {
+		ctx.Header("Access-Control-Allow-Origin", "*")
+	} else {
+		ctx.Header("Access-Control-Allow-Origin", origin)
+	}
+
+	if policy.credentials {
+		ctx.Header("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// preflightRejection returns the reason a preflight request is rejected, if it is.
+func (policy *corsPolicy) preflightRejection(origin, method string, headers []string) string {
+	if !policy.allowsOrigin(origin) {
+		return fmt.Sprintf("origin %s not allowed", origin)
+	}
+
+	if !slices.Contains(policy.methods, method) {
+		return fmt.Sprintf("method %s not allowed", method)
+	}
+
+	if !policy.anyHeader {
+		for _, header := range headers {
+			if !policy.headers[header] {
+				return fmt.Sprintf("header %s not allowed", header)
+			}
+		}
+	}
+
+	return ""
+}
+
+func (policy *corsPolicy) preflight(ctx *gin.Context, origin string) {
+	method := ctx.GetHeader("Access-Control-Request-Method")
+	requestHeaders := ctx.GetHeader("Access-Control-Request-Headers")
+
+	var headers []string
+
+	for _, header := range strings.Split(requestHeaders, ",") {
+		if header = strings.ToLower(strings.TrimSpace(header)); header != "" {
+			headers = append(headers, header)
+		}
+	}
+
+	ctx.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+	ctx.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+
+	if reason := policy.preflightRejection(origin, method, headers); reason != "" {
+		ctx.Set(reportCORSKey, reason)
+		HandleGRPCErrorProblem(ctx, status.Error(codes.PermissionDenied, "cors: "+reason))
+
+		return
+	}
+
+	policy.setOriginHeaders(ctx, origin)
+	ctx.Header("Access-Control-Allow-Methods", policy.allowMethods)
+
+	if len(headers) > 0 {
+		// The wildcard is not honored for requests with credentials, so the requested headers are echoed.
+		if policy.anyHeader {
+			ctx.Header("Access-Control-Allow-Headers", requestHeaders)
+		} else {
+			ctx.Header("Access-Control-Allow-Headers", policy.allowHeaders)
+		}
+	}
+
+	if policy.maxAge != "" {
+		ctx.Header("Access-Control-Max-Age", policy.maxAge)
+	}
+
+	ctx.AbortWithStatus(http.StatusNoContent)
+}
+
+// matchRoute reports whether a path matches a gin route pattern, with ":param" and "*wildcard" segments.
+func matchRoute(pattern, path string) bool {
+	patternSegments := strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+
+	for i, segment := range patternSegments {
+		if strings.HasPrefix(segment, "*") {
+			return true
+		}
+
+		if i >= len(pathSegments) {
+			return false
+		}
+
+		if strings.HasPrefix(segment, ":") {
+			if pathSegments[i] == "" {
+				return false
+			}
+
+			continue
+		}
+
+		if segment != pathSegments[i] {
+			return false
+		}
+	}
+
+	return len(patternSegments) == len(pathSegments)
+}
+
+func routeParams(pattern string) int {
+	return strings.Count(pattern, ":") + strings.Count(pattern, "*")
+}
+
+// CORSMiddleware answers CORS preflight requests, and sets the CORS headers of allowed cross-origin requests. It
+// must be attached to the engine, so it also runs for preflight requests, which have no route of their own.
+//
+// It panics if a policy allows credentials from any origin.
+//
+// Preflight requests that are not allowed are rejected with a 403 status, and the reason of the rejection is
+// attached to the report of the request. Other requests from origins that are not allowed are served without
+// CORS headers, so browsers block their response.
+func CORSMiddleware(config CORSConfig) gin.HandlerFunc {
+	defaultPolicy := newCORSPolicy(config.Policy)
+	routes := make(map[string]*corsPolicy, len(config.Routes))
+	patterns := make([]string, 0, len(config.Routes))
+
+	for route, policy := range config.Routes {
+		routes[route] = newCORSPolicy(policy)
+		patterns = append(patterns, route)
+	}
+
+	// Static routes take precedence over routes with parameters, as they do in gin.
+	slices.SortFunc(patterns, func(a, b string) int {
+		if diff := routeParams(a) - routeParams(b); diff != 0 {
+			return diff
+		}
+
+		return strings.Compare(a, b)
+	})
+
+	policyOf := func(ctx *gin.Context) *corsPolicy {
+		if policy, ok := routes[ctx.FullPath()]; ok {
+			return policy
+		}
+
+		if ctx.FullPath() == "" {
+			for _, pattern := range patterns {
+				if matchRoute(pattern, ctx.Request.URL.Path) {
+					return routes[pattern]
+				}
+			}
+		}
+
+		return defaultPolicy
+	}
+
+	return func(ctx *gin.Context) {
+		policy := policyOf(ctx)
+
+		// The response depends on the origin, unless every origin gets the same one.
+		if !policy.anyOrigin {
+			ctx.Writer.Header().Add("Vary", "Origin")
+		}
+
+		origin := ctx.GetHeader("Origin")
+		if origin == "" {
+			ctx.Next()
+			return
+		}
+
+		if ctx.Request.Method == http.MethodOptions && ctx.GetHeader("Access-Control-Request-Method") != "" {
+			policy.preflight(ctx, origin)
+			return
+		}
+
+		if policy.allowsOrigin(origin) {
+			policy.setOriginHeaders(ctx, origin)
+
+			if policy.exposeHeaders != "" {
+				ctx.Header("Access-Control-Expose-Headers", policy.exposeHeaders)
+			}
+		}
+
+		ctx.Next()
+	}
+}
@@ -0,0 +1,375 @@
+package ahttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a-novel-kit/quicklog"
+	quicklogmocks "github.com/a-novel-kit/quicklog/mocks"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	config := ahttp.CORSConfig{
+		Policy: ahttp.CORSPolicy{
+			AllowedOrigins:        []string{"https://example.com", "https://*.example.org"},
+			AllowedOriginPatterns: []*regexp.Regexp{regexp.MustCompile(`https://preview-\d+\.example\.net`)},
+			ExposedHeaders:        []string{"X-Request-Id"},
+			AllowCredentials:      true,
+			MaxAge:                10 * time.Minute,
+		},
+		Routes: map[string]ahttp.CORSPolicy{
+			"/public/:id": {
+				AllowedOrigins: []string{"*"},
+				AllowedMethods: []string{http.MethodGet},
+				AllowedHeaders: []string{"*"},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name string
+
+		method  string
+		path    string
+		headers map[string]string
+
+		expectCode    int
+		expectHeaders map[string]string
+		expectVary    []string
+	}{
+		{
+			name: "ExactOrigin",
+
+			method:  http.MethodGet,
+			path:    "/private",
+			headers: map[string]string{"Origin": "https://example.com"},
+
+			expectCode: http.StatusOK,
+			expectHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Request-Id",
+			},
+			expectVary: []string{"Origin"},
+		},
+		{
+			name: "WildcardOrigin",
+
+			method:  http.MethodGet,
+			path:    "/private",
+			headers: map[string]string{"Origin": "https://api.eu.example.org"},
+
+			expectCode: http.StatusOK,
+			expectHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "https://api.eu.example.org",
+			},
+			expectVary: []string{"Origin"},
+		},
+		{
+			name: "WildcardOriginRoot",
+
+			method:  http.MethodGet,
+			path:    "/private",
+			headers: map[string]string{"Origin": "https://example.org"},
+
+			expectCode:    http.StatusOK,
+			expectHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+			expectVary:    []string{"Origin"},
+		},
+		{
+			name: "PatternOrigin",
+
+			method:  http.MethodGet,
+			path:    "/private",
+			headers: map[string]string{"Origin": "https://preview-42.example.net"},
+
+			expectCode: http.StatusOK,
+			expectHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "https://preview-42.example.net",
+			},
+			expectVary: []string{"Origin"},
+		},
+		{
+			name: "PatternOriginPartial",
+
+			method:  http.MethodGet,
+			path:    "/private",
+			headers: map[string]string{"Origin": "https://preview-42.example.net.evil.com"},
+
+			expectCode:    http.StatusOK,
+			expectHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+			expectVary:    []string{"Origin"},
+		},
+		{
+			name: "OriginNotAllowed",
+
+			method:  http.MethodGet,
+			path:    "/private",
+			headers: map[string]string{"Origin": "https://evil.com"},
+
+			expectCode: http.StatusOK,
+			expectHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "",
+				"Access-Control-Allow-Credentials": "",
+				"Access-Control-Expose-Headers":    "",
+			},
+			expectVary: []string{"Origin"},
+		},
+		{
+			name: "SameOrigin",
+
+			method: http.MethodGet,
+			path:   "/private",
+
+			expectCode:    http.StatusOK,
+			expectHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+			expectVary:    []string{"Origin"},
+		},
+		{
+			name: "Preflight",
+
+			method: http.MethodOptions,
+			path:   "/private",
+			headers: map[string]string{
+				"Origin":                         "https://example.com",
+				"Access-Control-Request-Method":  http.MethodPut,
+				"Access-Control-Request-Headers": "content-type, authorization",
+			},
+
+			expectCode: http.StatusNoContent,
+			expectHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Allow-Methods":     "GET, HEAD, POST, PUT, PATCH, DELETE",
+				"Access-Control-Allow-Headers": "Accept, Accept-Language, Authorization, Content-Type, If-Match, " +
+					"If-None-Match, " + ahttp.IdempotencyKeyHeader,
+				"Access-Control-Max-Age": "600",
+			},
+			expectVary: []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name: "PreflightOriginNotAllowed",
+
+			method: http.MethodOptions,
+			path:   "/private",
+			headers: map[string]string{
+				"Origin":                        "https://evil.com",
+				"Access-Control-Request-Method": http.MethodGet,
+			},
+
+			expectCode:    http.StatusForbidden,
+			expectHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+			expectVary:    []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name: "PreflightMethodNotAllowed",
+
+			method: http.MethodOptions,
+			path:   "/private",
+			headers: map[string]string{
+				"Origin":                        "https://example.com",
+				"Access-Control-Request-Method": "PURGE",
+			},
+
+			expectCode:    http.StatusForbidden,
+			expectHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+			expectVary:    []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name: "PreflightHeaderNotAllowed",
+
+			method: http.MethodOptions,
+			path:   "/private",
+			headers: map[string]string{
+				"Origin":                         "https://example.com",
+				"Access-Control-Request-Method":  http.MethodGet,
+				"Access-Control-Request-Headers": "x-foo",
+			},
+
+			expectCode:    http.StatusForbidden,
+			expectHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+			expectVary:    []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name: "RouteAnyOrigin",
+
+			method:  http.MethodGet,
+			path:    "/public/1",
+			headers: map[string]string{"Origin": "https://evil.com"},
+
+			expectCode: http.StatusOK,
+			expectHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Credentials": "",
+				"Access-Control-Expose-Headers":    "",
+			},
+		},
+		{
+			name: "RoutePreflight",
+
+			method: http.MethodOptions,
+			path:   "/public/1",
+			headers: map[string]string{
+				"Origin":                         "https://evil.com",
+				"Access-Control-Request-Method":  http.MethodGet,
+				"Access-Control-Request-Headers": "x-foo, x-bar",
+			},
+
+			expectCode: http.StatusNoContent,
+			expectHeaders: map[string]string{
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Methods": http.MethodGet,
+				"Access-Control-Allow-Headers": "x-foo, x-bar",
+				"Access-Control-Max-Age":       "",
+			},
+			expectVary: []string{"Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name: "RoutePreflightMethodNotAllowed",
+
+			method: http.MethodOptions,
+			path:   "/public/1",
+			headers: map[string]string{
+				"Origin":                        "https://example.com",
+				"Access-Control-Request-Method": http.MethodDelete,
+			},
+
+			expectCode:    http.StatusForbidden,
+			expectHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+			expectVary:    []string{"Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(ahttp.CORSMiddleware(config))
+
+			handler := func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			}
+
+			router.GET("/private", handler)
+			router.PUT("/private", handler)
+			router.GET("/public/:id", handler)
+
+			req := httptest.NewRequest(testCase.method, testCase.path, nil)
+			for key, value := range testCase.headers {
+				req.Header.Set(key, value)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, testCase.expectCode, w.Code)
+
+			for key, value := range testCase.expectHeaders {
+				require.Equal(t, value, w.Header().Get(key), key)
+			}
+
+			require.Equal(t, testCase.expectVary, w.Header().Values("Vary"))
+
+			if testCase.expectCode == http.StatusForbidden {
+				require.Equal(t, ahttp.ContentTypeProblem, w.Header().Get("Content-Type"))
+				require.Contains(t, w.Body.String(), "not allowed")
+			}
+		})
+	}
+}
+
+func TestCORSMiddlewareAnyOriginWithCredentials(t *testing.T) {
+	policy := ahttp.CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+
+	require.Panics(t, func() {
+		ahttp.CORSMiddleware(ahttp.CORSConfig{Policy: policy})
+	})
+	require.Panics(t, func() {
+		ahttp.CORSMiddleware(ahttp.CORSConfig{Routes: map[string]ahttp.CORSPolicy{"/public/:id": policy}})
+	})
+}
+
+func TestCORSMiddlewareReport(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		origin string
+		method string
+
+		expectCode   int
+		expectReason any
+	}{
+		{
+			name: "Allowed",
+
+			origin: "https://example.com",
+			method: http.MethodGet,
+
+			expectCode:   http.StatusNoContent,
+			expectReason: nil,
+		},
+		{
+			name: "OriginNotAllowed",
+
+			origin: "https://evil.com",
+			method: http.MethodGet,
+
+			expectCode:   http.StatusForbidden,
+			expectReason: "origin https://evil.com not allowed",
+		},
+		{
+			name: "MethodNotAllowed",
+
+			origin: "https://example.com",
+			method: http.MethodDelete,
+
+			expectCode:   http.StatusForbidden,
+			expectReason: "method DELETE not allowed",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			logger := quicklogmocks.NewMockLogger(t)
+			logger.
+				On("Log", mock.Anything, mock.Anything).
+				Run(func(args mock.Arguments) {
+					message := args.Get(1).(quicklog.Message)
+
+					report := message.RenderJSON()
+					require.Equal(t, testCase.expectReason, report["corsRejected"])
+				}).
+				Once()
+
+			router := gin.New()
+			router.Use(ahttp.ReportMiddleware(logger, ""))
+			router.Use(ahttp.CORSMiddleware(ahttp.CORSConfig{
+				Policy: ahttp.CORSPolicy{
+					AllowedOrigins: []string{"https://example.com"},
+					AllowedMethods: []string{http.MethodGet},
+				},
+			}))
+			router.GET("/foo", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodOptions, "/foo", nil)
+			req.Header.Set("Origin", testCase.origin)
+			req.Header.Set("Access-Control-Request-Method", testCase.method)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, testCase.expectCode, w.Code)
+			logger.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package ahttp
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// RequestTimeoutHeader lets clients specify how long they are willing to wait for a response. The value is
+	// either a Go duration ("1.5s") or a number of seconds ("30").
+	RequestTimeoutHeader = "X-Request-Timeout"
+	// GRPCTimeoutHeader is the standard gRPC timeout header, as sent by gRPC-Web clients.
+	GRPCTimeoutHeader = "Grpc-Timeout"
+)
+
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// parseGRPCTimeout parses a timeout in the gRPC wire format: up to 8 digits, followed by a unit.
+func parseGRPCTimeout(value string) (time.Duration, bool) {
+	if len(value) < 2 || len(value) > 9 {
+		return 0, false
+	}
+
+	unit, ok := grpcTimeoutUnits[value[len(value)-1]]
+	if !ok {
+		return 0, false
+	}
+
+	amount, err := strconv.ParseUint(value[:len(value)-1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	// Hours overflow a time.Duration past about 2.5 million: such timeouts are as good as no timeout.
+	if amount > uint64(math.MaxInt64/int64(unit)) {
+		return math.MaxInt64, true
+	}
+
+	return time.Duration(amount) * unit, true
+}
+
+// parseRequestTimeout parses a timeout from the X-Request-Timeout header.
+func parseRequestTimeout(value string) (time.Duration, bool) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		// Also rejects NaN and values that would overflow a time.Duration.
+		if !(seconds > 0 && seconds < float64(math.MaxInt64)/float64(time.Second)) {
+			return 0, false
+		}
+
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, false
+	}
+
+	return duration, true
+}
+
+// ClientTimeout returns the timeout requested by the client, if any. Invalid or non-positive values are ignored.
+func ClientTimeout(header http.Header) (time.Duration, bool) {
+	if value := header.Get(RequestTimeoutHeader); value != "" {
+		if timeout, ok := parseRequestTimeout(value); ok && timeout > 0 {
+			return timeout, true
+		}
+	}
+
+	if value := header.Get(GRPCTimeoutHeader); value != "" {
+		if timeout, ok := parseGRPCTimeout(value); ok && timeout > 0 {
+			return timeout, true
+		}
+	}
+
+	return 0, false
+}
+
+// DeadlineMiddleware sets a deadline on the request context. gRPC calls made with ctx.Request.Context()
+// automatically inherit it.
+//
+// The timeout is taken from the client headers (see ClientTimeout) if present, and defaultTimeout otherwise.
+// It is capped by maxTimeout. A zero value disables the corresponding bound.
+//
+// When the deadline fires and the handler did not write a response, the middleware responds with the
+// DeadlineExceeded mapping (504). In both cases, the report is marked as timed out.
+func DeadlineMiddleware(defaultTimeout, maxTimeout time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		timeout := defaultTimeout
+		if clientTimeout, ok := ClientTimeout(ctx.Request.Header); ok {
+			timeout = clientTimeout
+		}
+
+		if maxTimeout > 0 && (timeout <= 0 || timeout > maxTimeout) {
+			timeout = maxTimeout
+		}
+
+		if timeout <= 0 {
+			ctx.Next()
+			return
+		}
+
+		reqCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+
+		ctx.Request = ctx.Request.WithContext(reqCtx)
+		ctx.Next()
+
+		if !errors.Is(reqCtx.Err(), context.DeadlineExceeded) {
+			return
+		}
+
+		ctx.Set(reportTimedOutKey, true)
+
+		if !ctx.Writer.Written() {
+			HandleGRPCErrorProblem(ctx, status.FromContextError(reqCtx.Err()).Err())
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package ahttp_test
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a-novel-kit/quicklog"
+	quicklogmocks "github.com/a-novel-kit/quicklog/mocks"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+func TestClientTimeout(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		header http.Header
+
+		expect   time.Duration
+		expectOK bool
+	}{
+		{
+			name: "NoHeader",
+
+			header: http.Header{},
+		},
+		{
+			name: "RequestTimeout/Seconds",
+
+			header: http.Header{"X-Request-Timeout": []string{"1.5"}},
+
+			expect:   1500 * time.Millisecond,
+			expectOK: true,
+		},
+		{
+			name: "RequestTimeout/Duration",
+
+			header: http.Header{"X-Request-Timeout": []string{"200ms"}},
+
+			expect:   200 * time.Millisecond,
+			expectOK: true,
+		},
+		{
+			name: "RequestTimeout/Invalid",
+
+			header: http.Header{"X-Request-Timeout": []string{"NaN"}},
+		},
+		{
+			name: "RequestTimeout/Negative",
+
+			header: http.Header{"X-Request-Timeout": []string{"-1s"}},
+		},
+		{
+			name: "GRPCTimeout",
+
+			header: http.Header{"Grpc-Timeout": []string{"250m"}},
+
+			expect:   250 * time.Millisecond,
+			expectOK: true,
+		},
+		{
+			name: "GRPCTimeout/InvalidUnit",
+
+			header: http.Header{"Grpc-Timeout": []string{"250x"}},
+		},
+		{
+			name: "GRPCTimeout/Overflow",
+
+			header: http.Header{"Grpc-Timeout": []string{"99999999H"}},
+
+			expect:   math.MaxInt64,
+			expectOK: true,
+		},
+		{
+			name: "GRPCTimeout/TooLong",
+
+			header: http.Header{"Grpc-Timeout": []string{"123456789S"}},
+		},
+		{
+			name: "RequestTimeoutFirst",
+
+			header: http.Header{
+				"X-Request-Timeout": []string{"2"},
+				"Grpc-Timeout":      []string{"1S"},
+			},
+
+			expect:   2 * time.Second,
+			expectOK: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			timeout, ok := ahttp.ClientTimeout(testCase.header)
+			require.Equal(t, testCase.expectOK, ok)
+			require.Equal(t, testCase.expect, timeout)
+		})
+	}
+}
+
+func TestDeadlineMiddleware(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		defaultTimeout time.Duration
+		maxTimeout     time.Duration
+		header         http.Header
+
+		expectDeadline bool
+		expectTimeout  time.Duration
+	}{
+		{
+			name: "NoTimeout",
+		},
+		{
+			name: "Default",
+
+			defaultTimeout: time.Minute,
+
+			expectDeadline: true,
+			expectTimeout:  time.Minute,
+		},
+		{
+			name: "Client",
+
+			defaultTimeout: time.Minute,
+			header:         http.Header{"X-Request-Timeout": []string{"10"}},
+
+			expectDeadline: true,
+			expectTimeout:  10 * time.Second,
+		},
+		{
+			name: "Client/Capped",
+
+			defaultTimeout: time.Minute,
+			maxTimeout:     2 * time.Minute,
+			header:         http.Header{"Grpc-Timeout": []string{"1H"}},
+
+			expectDeadline: true,
+			expectTimeout:  2 * time.Minute,
+		},
+		{
+			name: "MaxOnly",
+
+			maxTimeout: time.Minute,
+
+			expectDeadline: true,
+			expectTimeout:  time.Minute,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/foo", ahttp.DeadlineMiddleware(testCase.defaultTimeout, testCase.maxTimeout), func(ctx *gin.Context) {
+				deadline, ok := ctx.Request.Context().Deadline()
+				require.Equal(t, testCase.expectDeadline, ok)
+
+				if ok {
+					require.InDelta(t, testCase.expectTimeout, time.Until(deadline), float64(time.Second))
+				}
+
+				ctx.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/foo", nil)
+			for key, values := range testCase.header {
+				req.Header[key] = values
+			}
+
+			router.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code)
+		})
+	}
+}
+
+func TestDeadlineMiddlewareExceeded(t *testing.T) {
+	logger := quicklogmocks.NewMockLogger(t)
+	logger.
+		On("Log", quicklog.LevelError, mock.Anything).
+		Run(func(args mock.Arguments) {
+			require.Equal(t, true, args.Get(1).(quicklog.Message).RenderJSON()["timedOut"])
+		}).
+		Once()
+
+	router := gin.New()
+	router.Use(ahttp.ReportMiddleware(logger, ""))
+	router.GET("/foo", ahttp.DeadlineMiddleware(10*time.Millisecond, 0), func(ctx *gin.Context) {
+		<-ctx.Request.Context().Done()
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/foo", nil))
+
+	require.Equal(t, http.StatusGatewayTimeout, w.Code)
+	logger.AssertExpectations(t)
+}
@@ -0,0 +1,280 @@
+package ahttp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ETagMismatchReason is the reason of the ErrorInfo, or the type of the PreconditionFailure violation, that
+// marks a gRPC error as an etag mismatch.
+const ETagMismatchReason = "ETAG_MISMATCH"
+
+var errPreconditionFailed = errors.New("precondition failed")
+
+// IsETagMismatch reports whether err is a FailedPrecondition or Aborted status caused by an etag mismatch. The
+// status must carry an ErrorInfo or a PreconditionFailure detail with ETagMismatchReason.
+func IsETagMismatch(err error) bool {
+	grpcStatus, ok := statusFromError(err)
+	if !ok || (grpcStatus.Code() != codes.FailedPrecondition && grpcStatus.Code() != codes.Aborted) {
+		return false
+	}
+
+	for _, detail := range grpcStatus.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			if detail.GetReason() == ETagMismatchReason {
+				return true
+			}
+		case *errdetails.PreconditionFailure:
+			for _, violation := range detail.GetViolations() {
+				if strings.EqualFold(violation.GetType(), ETagMismatchReason) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func etagMismatchProblem(grpcStatus *status.Status) *Problem {
+	problem := problemFromStatus(grpcStatus)
+	problem.Status = http.StatusPreconditionFailed
+	problem.Title = http.StatusText(http.StatusPreconditionFailed)
+
+	return problem
+}
+
+// ETagFromProto returns the ETag of a message, from its etag field, or from its update_time field as a weak
+// ETag. It returns an empty string if the message has neither.
+func ETagFromProto(message proto.Message) string {
+	reflected := message.ProtoReflect()
+	fields := reflected.Descriptor().Fields()
+
+	if field := fields.ByName("etag"); field != nil && field.Kind() == protoreflect.StringKind {
+		if etag := reflected.Get(field).String(); etag != "" {
+			return quoteETag(etag)
+		}
+	}
+
+	field := fields.ByName("update_time")
+	if field == nil || field.Message() == nil || field.Message().FullName() != "google.protobuf.Timestamp" ||
+		!reflected.Has(field) {
+		return ""
+	}
+
+	updateTime := reflected.Get(field).Message()
+	timestampFields := updateTime.Descriptor().Fields()
+	seconds := updateTime.Get(timestampFields.ByName("seconds")).Int()
+	nanos := updateTime.Get(timestampFields.ByName("nanos")).Int()
+
+	return fmt.Sprintf(`W/"%x"`, time.Unix(seconds, nanos).UnixNano())
+}
+
+// quoteETag turns an opaque value into an entity tag, unless it already is one.
+func quoteETag(etag string) string {
+	if strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+
+	return `"` + etag + `"`
+}
+
+// matchETag reports whether etag matches one of the entity tags of a conditional header. Weak comparison
+// ignores the weakness of tags, strong comparison requires both tags to be strong.
+func matchETag(header, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+
+	etagWeak := strings.HasPrefix(etag, "W/")
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+
+		candidateWeak := strings.HasPrefix(candidate, "W/")
+		if !weak && (etagWeak || candidateWeak) {
+			continue
+		}
+
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckIfMatch checks the If-Match header of a write against the current ETag of the resource, which is empty
+// if it does not exist. On failure, it aborts the request with a 412 status, and returns false.
+func CheckIfMatch(ctx *gin.Context, etag string) bool {
+	header := ctx.GetHeader("If-Match")
+	if header == "" || matchETag(header, etag, false) {
+		return true
+	}
+
+	abortWithProblem(ctx, newProblem(http.StatusPreconditionFailed, "resource was modified"), errPreconditionFailed)
+
+	return false
+}
+
+// etagWriter buffers the response, so it can be replaced with a 304 once its ETag is known. Flushed responses
+// are streamed instead.
+type etagWriter struct {
+	gin.ResponseWriter
+
+	body      bytes.Buffer
+	committed bool
+	streaming bool
+}
+
+func (writer *etagWriter) Write(data []byte) (int, error) {
+	if writer.streaming {
+		return writer.ResponseWriter.Write(data)
+	}
+
+	writer.committed = true
+
+	return writer.body.Write(data)
+}
+
+func (writer *etagWriter) WriteString(data string) (int, error) {
+	return writer.Write([]byte(data))
+}
+
+func (writer *etagWriter) WriteHeaderNow() {
+	if writer.streaming {
+		writer.ResponseWriter.WriteHeaderNow()
+		return
+	}
+
+	writer.committed = true
+}
+
+func (writer *etagWriter) Written() bool {
+	return writer.committed || writer.ResponseWriter.Written()
+}
+
+func (writer *etagWriter) Flush() {
+	if !writer.streaming {
+		writer.streaming = true
+		_, _ = writer.ResponseWriter.Write(writer.body.Bytes())
+		writer.body.Reset()
+	}
+
+	writer.ResponseWriter.Flush()
+}
+
+type ETagConfig struct {
+	// Weak generates weak ETags, for responses whose representation may change without their content changing,
+	// such as when they are compressed.
+	Weak bool
+}
+
+// notModified reports whether a GET request can be answered with a 304 status.
+func notModified(ctx *gin.Context, etag string, header http.Header) bool {
+	if ifNoneMatch := ctx.GetHeader("If-None-Match"); ifNoneMatch != "" {
+		return matchETag(ifNoneMatch, etag, true)
+	}
+
+	ifModifiedSince, err := http.ParseTime(ctx.GetHeader("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+
+	return !lastModified.Truncate(time.Second).After(ifModifiedSince)
+}
+
+// ETagMiddleware sets the ETag of GET responses, and answers conditional GET requests.
+//
+// Handlers can set their own ETag header, for example with ETagFromProto. Otherwise, the ETag is a hash of the
+// response body. Requests whose If-None-Match header matches the ETag, or whose If-Modified-Since header is not
+// older than the Last-Modified header of the response, receive a 304 status. Requests whose If-Match header
+// does not match receive a 412 status.
+//
+// Writes are checked by the handler, with CheckIfMatch, or by the backend: see IsETagMismatch.
+//
+// The middleware must run inside CompressionMiddleware, so the ETag is computed on the uncompressed body.
+func ETagMiddleware(config ETagConfig) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.Request.Method != http.MethodGet && ctx.Request.Method != http.MethodHead {
+			ctx.Next()
+			return
+		}
+
+		original := ctx.Writer
+		writer := &etagWriter{ResponseWriter: original}
+		ctx.Writer = writer
+
+		ctx.Next()
+
+		ctx.Writer = original
+
+		if writer.streaming {
+			return
+		}
+
+		header := original.Header()
+
+		if original.Status() == http.StatusOK {
+			etag := header.Get("ETag")
+			if etag == "" {
+				sum := sha256.Sum256(writer.body.Bytes())
+				etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+
+				if config.Weak {
+					etag = "W/" + etag
+				}
+
+				header.Set("ETag", etag)
+			}
+
+			if ifMatch := ctx.GetHeader("If-Match"); ifMatch != "" && !matchETag(ifMatch, etag, false) {
+				header.Del("Content-Length")
+				_ = ctx.Error(errPreconditionFailed)
+				writeProblem(original, newProblem(http.StatusPreconditionFailed, "resource was modified"))
+
+				return
+			}
+
+			if notModified(ctx, etag, header) {
+				header.Del("Content-Type")
+				header.Del("Content-Length")
+				original.WriteHeader(http.StatusNotModified)
+				original.WriteHeaderNow()
+
+				return
+			}
+		}
+
+		// Writing the body commits the headers. Committing them first would prevent an outer CompressionMiddleware
+		// from compressing the body, since it decides on the first write.
+		if writer.body.Len() == 0 {
+			original.WriteHeaderNow()
+			return
+		}
+
+		_, _ = original.Write(writer.body.Bytes())
+	}
+}
@@ -0,0 +1,475 @@
+package ahttp_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+func TestETagMiddleware(t *testing.T) {
+	sum := sha256.Sum256([]byte("hello"))
+	helloETag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	lastModified := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	hello := func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, "hello")
+	}
+
+	testCases := []struct {
+		name string
+
+		config  ahttp.ETagConfig
+		method  string
+		header  map[string]string
+		handler gin.HandlerFunc
+
+		expectCode int
+		expectBody string
+		expectETag string
+	}{
+		{
+			name: "Generated",
+
+			handler: hello,
+
+			expectCode: http.StatusOK,
+			expectBody: "hello",
+			expectETag: helloETag,
+		},
+		{
+			name: "Generated/Weak",
+
+			config:  ahttp.ETagConfig{Weak: true},
+			handler: hello,
+
+			expectCode: http.StatusOK,
+			expectBody: "hello",
+			expectETag: "W/" + helloETag,
+		},
+		{
+			name: "FromHandler",
+
+			handler: func(ctx *gin.Context) {
+				ctx.Header("ETag", `"v1"`)
+				ctx.String(http.StatusOK, "hello")
+			},
+
+			expectCode: http.StatusOK,
+			expectBody: "hello",
+			expectETag: `"v1"`,
+		},
+		{
+			name: "IfNoneMatch",
+
+			header:  map[string]string{"If-None-Match": `"foo", ` + helloETag},
+			handler: hello,
+
+			expectCode: http.StatusNotModified,
+			expectETag: helloETag,
+		},
+		{
+			name: "IfNoneMatch/Weak",
+
+			header:  map[string]string{"If-None-Match": "W/" + helloETag},
+			handler: hello,
+
+			expectCode: http.StatusNotModified,
+			expectETag: helloETag,
+		},
+		{
+			name: "IfNoneMatch/Mismatch",
+
+			header:  map[string]string{"If-None-Match": `"foo"`},
+			handler: hello,
+
+			expectCode: http.StatusOK,
+			expectBody: "hello",
+			expectETag: helloETag,
+		},
+		{
+			name: "IfModifiedSince",
+
+			header: map[string]string{"If-Modified-Since": lastModified.Format(http.TimeFormat)},
+			handler: func(ctx *gin.Context) {
+				ctx.Header("Last-Modified", lastModified.Format(http.TimeFormat))
+				ctx.String(http.StatusOK, "hello")
+			},
+
+			expectCode: http.StatusNotModified,
+			expectETag: helloETag,
+		},
+		{
+			name: "IfModifiedSince/Modified",
+
+			header: map[string]string{"If-Modified-Since": lastModified.Add(-time.Hour).Format(http.TimeFormat)},
+			handler: func(ctx *gin.Context) {
+				ctx.Header("Last-Modified", lastModified.Format(http.TimeFormat))
+				ctx.String(http.StatusOK, "hello")
+			},
+
+			expectCode: http.StatusOK,
+			expectBody: "hello",
+			expectETag: helloETag,
+		},
+		{
+			name: "IfModifiedSince/IgnoredWithIfNoneMatch",
+
+			header: map[string]string{
+				"If-None-Match":     `"foo"`,
+				"If-Modified-Since": lastModified.Format(http.TimeFormat),
+			},
+			handler: func(ctx *gin.Context) {
+				ctx.Header("Last-Modified", lastModified.Format(http.TimeFormat))
+				ctx.String(http.StatusOK, "hello")
+			},
+
+			expectCode: http.StatusOK,
+			expectBody: "hello",
+			expectETag: helloETag,
+		},
+		{
+			name: "IfMatch/Mismatch",
+
+			header:  map[string]string{"If-Match": `"foo"`},
+			handler: hello,
+
+			expectCode: http.StatusPreconditionFailed,
+			expectBody: `{"title":"Precondition Failed","status":412,"detail":"resource was modified"}`,
+			expectETag: helloETag,
+		},
+		{
+			name: "ErrorStatus",
+
+			header: map[string]string{"If-None-Match": "*"},
+			handler: func(ctx *gin.Context) {
+				ctx.String(http.StatusNotFound, "hello")
+			},
+
+			expectCode: http.StatusNotFound,
+			expectBody: "hello",
+		},
+		{
+			name: "Write",
+
+			method:  http.MethodPut,
+			header:  map[string]string{"If-None-Match": "*"},
+			handler: hello,
+
+			expectCode: http.StatusOK,
+			expectBody: "hello",
+		},
+		{
+			name: "Streaming",
+
+			header: map[string]string{"If-None-Match": "*"},
+			handler: func(ctx *gin.Context) {
+				ctx.String(http.StatusOK, "hello")
+				ctx.Writer.Flush()
+			},
+
+			expectCode: http.StatusOK,
+			expectBody: "hello",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			method := testCase.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			router := gin.New()
+			router.Handle(method, "/foo", ahttp.ETagMiddleware(testCase.config), testCase.handler)
+
+			req := httptest.NewRequest(method, "/foo", nil)
+			for key, value := range testCase.header {
+				req.Header.Set(key, value)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, testCase.expectCode, w.Code)
+			require.Equal(t, testCase.expectBody, w.Body.String())
+			require.Equal(t, testCase.expectETag, w.Header().Get("ETag"))
+		})
+	}
+}
+
+func TestETagMiddlewareCompression(t *testing.T) {
+	body := strings.Repeat(`{"foo":"bar"}`, 300)
+
+	sum := sha256.Sum256([]byte(body))
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	testCases := []struct {
+		name string
+
+		header map[string]string
+
+		expectCode     int
+		expectEncoding string
+		expectBody     string
+	}{
+		{
+			name: "Compressed",
+
+			header: map[string]string{"Accept-Encoding": "gzip"},
+
+			expectCode:     http.StatusOK,
+			expectEncoding: "gzip",
+			expectBody:     body,
+		},
+		{
+			name: "Identity",
+
+			expectCode: http.StatusOK,
+			expectBody: body,
+		},
+		{
+			name: "NotModified",
+
+			header: map[string]string{"Accept-Encoding": "gzip", "If-None-Match": etag},
+
+			expectCode: http.StatusNotModified,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET(
+				"/foo",
+				ahttp.CompressionMiddleware(ahttp.CompressionConfig{}),
+				ahttp.ETagMiddleware(ahttp.ETagConfig{}),
+				func(ctx *gin.Context) {
+					ctx.Data(http.StatusOK, "application/json", []byte(body))
+				},
+			)
+
+			req := httptest.NewRequest(http.MethodGet, "/foo", nil)
+			for key, value := range testCase.header {
+				req.Header.Set(key, value)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, testCase.expectCode, w.Code)
+			require.Equal(t, etag, w.Header().Get("ETag"))
+			require.Equal(t, testCase.expectEncoding, w.Header().Get("Content-Encoding"))
+			require.Equal(t, testCase.expectBody, decodeBody(t, testCase.expectEncoding, w.Body.Bytes()))
+
+			if testCase.expectEncoding != "" {
+				require.Less(t, w.Body.Len(), len(body))
+			}
+		})
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		ifMatch string
+		etag    string
+
+		expect bool
+	}{
+		{name: "NoHeader", etag: `"v1"`, expect: true},
+		{name: "Match", ifMatch: `"v0", "v1"`, etag: `"v1"`, expect: true},
+		{name: "Mismatch", ifMatch: `"v0"`, etag: `"v1"`},
+		{name: "Weak", ifMatch: `W/"v1"`, etag: `"v1"`},
+		{name: "Wildcard", ifMatch: "*", etag: `"v1"`, expect: true},
+		{name: "Wildcard/Missing", ifMatch: "*"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodPut, "/foo", nil)
+
+			if testCase.ifMatch != "" {
+				ctx.Request.Header.Set("If-Match", testCase.ifMatch)
+			}
+
+			require.Equal(t, testCase.expect, ahttp.CheckIfMatch(ctx, testCase.etag))
+
+			if !testCase.expect {
+				require.Equal(t, http.StatusPreconditionFailed, w.Code)
+				require.True(t, ctx.IsAborted())
+			}
+		})
+	}
+}
+
+func TestIsETagMismatch(t *testing.T) {
+	withDetails := func(code codes.Code, details ...protoadapt.MessageV1) error {
+		grpcStatus, err := status.New(code, "conflict").WithDetails(details...)
+		require.NoError(t, err)
+
+		return grpcStatus.Err()
+	}
+
+	testCases := []struct {
+		name string
+
+		err error
+
+		expect bool
+	}{
+		{
+			name:   "ErrorInfo",
+			err:    withDetails(codes.Aborted, &errdetails.ErrorInfo{Reason: ahttp.ETagMismatchReason}),
+			expect: true,
+		},
+		{
+			name: "PreconditionFailure",
+			err: withDetails(codes.FailedPrecondition, &errdetails.PreconditionFailure{
+				Violations: []*errdetails.PreconditionFailure_Violation{{Type: ahttp.ETagMismatchReason}},
+			}),
+			expect: true,
+		},
+		{
+			name: "MessageOnly",
+			err:  status.Error(codes.FailedPrecondition, "etag field is required"),
+		},
+		{
+			name: "OtherReason",
+			err:  withDetails(codes.Aborted, &errdetails.ErrorInfo{Reason: "LOCKED"}),
+		},
+		{
+			name: "OtherCode",
+			err:  status.Error(codes.InvalidArgument, "invalid etag"),
+		},
+		{
+			name: "NotAStatus",
+			err:  http.ErrHandlerTimeout,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.expect, ahttp.IsETagMismatch(testCase.err))
+		})
+	}
+}
+
+// newResourceDescriptor describes a message with an etag and an update_time field.
+func newResourceDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("resource.proto"),
+		Package:    proto.String("test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Resource"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{
+					Name:     proto.String("etag"),
+					Number:   proto.Int32(1),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					JsonName: proto.String("etag"),
+				},
+				{
+					Name:     proto.String("update_time"),
+					Number:   proto.Int32(2),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+					TypeName: proto.String(".google.protobuf.Timestamp"),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					JsonName: proto.String("updateTime"),
+				},
+			},
+		}},
+	}, protoregistry.GlobalFiles)
+	require.NoError(t, err)
+
+	return file.Messages().ByName("Resource")
+}
+
+func TestETagFromProto(t *testing.T) {
+	descriptor := newResourceDescriptor(t)
+	updateTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newResource := func(etag string, updateTime *time.Time) proto.Message {
+		message := dynamicpb.NewMessage(descriptor)
+		fields := descriptor.Fields()
+
+		if etag != "" {
+			message.Set(fields.ByName("etag"), protoreflect.ValueOfString(etag))
+		}
+
+		if updateTime != nil {
+			message.Set(
+				fields.ByName("update_time"),
+				protoreflect.ValueOfMessage(timestamppb.New(*updateTime).ProtoReflect()),
+			)
+		}
+
+		return message
+	}
+
+	testCases := []struct {
+		name string
+
+		message proto.Message
+
+		expect string
+	}{
+		{
+			name:    "ETag",
+			message: newResource("v1", &updateTime),
+			expect:  `"v1"`,
+		},
+		{
+			name:    "ETag/Quoted",
+			message: newResource(`W/"v1"`, nil),
+			expect:  `W/"v1"`,
+		},
+		{
+			name:    "UpdateTime",
+			message: newResource("", &updateTime),
+			expect:  `W/"1655f29d787c0000"`,
+		},
+		{
+			name:    "None",
+			message: newResource("", nil),
+		},
+		{
+			name:    "NoFields",
+			message: timestamppb.New(updateTime),
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.expect, ahttp.ETagFromProto(testCase.message))
+		})
+	}
+}
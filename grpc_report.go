@@ -0,0 +1,125 @@
+package ahttp
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/a-novel-kit/quicklog"
+
+	ahttpmessages "github.com/a-novel-kit/ahttp/messages"
+)
+
+func messageSize(msg any) int64 {
+	if protoMsg, ok := msg.(proto.Message); ok {
+		return int64(proto.Size(protoMsg))
+	}
+
+	return 0
+}
+
+func newGRPCRequest(ctx context.Context, method string, err error) *ahttpmessages.GRPCRequest {
+	request := &ahttpmessages.GRPCRequest{
+		Method: method,
+		Err:    err,
+	}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		request.Peer = p.Addr.String()
+	}
+
+	request.Metadata, _ = metadata.FromIncomingContext(ctx)
+
+	// Errors that are not statuses resolve to codes.Unknown.
+	grpcStatus, _ := statusFromError(err)
+	request.Code = grpcStatus.Code()
+	request.HTTPStatus = GRPCToHTTPCode(request.Code)
+
+	return request
+}
+
+// UnaryReportInterceptor is the gRPC equivalent of ReportMiddleware, for unary calls.
+func UnaryReportInterceptor(logger quicklog.Logger, projectID string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		res, err := handler(ctx, req)
+
+		request := newGRPCRequest(ctx, info.FullMethod, err)
+
+		logger.Log(ahttpmessages.LevelFromStatus(request.HTTPStatus), ahttpmessages.NewGRPCReport(
+			&ahttpmessages.GRPCMetrics{
+				Latency:      time.Since(start),
+				StartedAt:    start,
+				RequestSize:  messageSize(req),
+				ResponseSize: messageSize(res),
+			},
+			projectID,
+			request,
+		))
+
+		return res, err
+	}
+}
+
+// reportServerStream counts the messages going through a server stream. Messages may be sent and received from
+// different goroutines.
+type reportServerStream struct {
+	grpc.ServerStream
+
+	in, out         atomic.Int64
+	inSize, outSize atomic.Int64
+}
+
+func (stream *reportServerStream) SendMsg(msg any) error {
+	err := stream.ServerStream.SendMsg(msg)
+	if err == nil {
+		stream.out.Add(1)
+		stream.outSize.Add(messageSize(msg))
+	}
+
+	return err
+}
+
+func (stream *reportServerStream) RecvMsg(msg any) error {
+	err := stream.ServerStream.RecvMsg(msg)
+	if err == nil {
+		stream.in.Add(1)
+		stream.inSize.Add(messageSize(msg))
+	}
+
+	return err
+}
+
+// StreamReportInterceptor is the gRPC equivalent of ReportMiddleware, for streaming calls. The report is logged
+// once the stream terminates.
+func StreamReportInterceptor(logger quicklog.Logger, projectID string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		stream := &reportServerStream{ServerStream: ss}
+		err := handler(srv, stream)
+
+		request := newGRPCRequest(ss.Context(), info.FullMethod, err)
+
+		logger.Log(ahttpmessages.LevelFromStatus(request.HTTPStatus), ahttpmessages.NewGRPCReport(
+			&ahttpmessages.GRPCMetrics{
+				Latency:      time.Since(start),
+				StartedAt:    start,
+				RequestSize:  stream.inSize.Load(),
+				ResponseSize: stream.outSize.Load(),
+				Stream: &ahttpmessages.GRPCStreamMetrics{
+					MessagesIn:  stream.in.Load(),
+					MessagesOut: stream.out.Load(),
+				},
+			},
+			projectID,
+			request,
+		))
+
+		return err
+	}
+}
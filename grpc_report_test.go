@@ -0,0 +1,157 @@
+package ahttp_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/a-novel-kit/quicklog"
+	quicklogmocks "github.com/a-novel-kit/quicklog/mocks"
+	testutils "github.com/a-novel-kit/test-utils"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+func grpcTestContext() context.Context {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234},
+	})
+
+	return metadata.NewIncomingContext(ctx, metadata.Pairs("x-cloud-trace-context", "abcdefg/hijklmnop"))
+}
+
+func TestUnaryReportInterceptor(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		err error
+
+		expectLevel quicklog.Level
+		expectCode  string
+	}{
+		{
+			name: "Success",
+
+			expectLevel: quicklog.LevelInfo,
+			expectCode:  "OK",
+		},
+		{
+			name: "ClientError",
+
+			err: status.Error(codes.NotFound, "not found"),
+
+			expectLevel: quicklog.LevelWarning,
+			expectCode:  "NotFound",
+		},
+		{
+			name: "ServerError",
+
+			err: testutils.ErrDummy,
+
+			expectLevel: quicklog.LevelError,
+			expectCode:  "Unknown",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			logger := quicklogmocks.NewMockLogger(t)
+			logger.
+				On("Log", testCase.expectLevel, mock.Anything).
+				Run(func(args mock.Arguments) {
+					report := args.Get(1).(quicklog.Message).RenderJSON()
+					require.Equal(t, "projects/cd/traces/abcdefg", report["logging.googleapis.com/trace"])
+					require.Equal(t, "127.0.0.1", report["ip"])
+
+					grpcReport := report["grpc"].(map[string]interface{})
+					require.Equal(t, "/foo.Bar/Baz", grpcReport["method"])
+					require.Equal(t, testCase.expectCode, grpcReport["code"])
+
+					httpRequest := report["httpRequest"].(map[string]interface{})
+					require.Equal(t, "5", httpRequest["requestSize"])
+				}).
+				Once()
+
+			interceptor := ahttp.UnaryReportInterceptor(logger, "cd")
+
+			_, err := interceptor(
+				grpcTestContext(),
+				wrapperspb.String("foo"),
+				&grpc.UnaryServerInfo{FullMethod: "/foo.Bar/Baz"},
+				func(_ context.Context, _ any) (any, error) {
+					return wrapperspb.String("bar"), testCase.err
+				},
+			)
+			require.ErrorIs(t, err, testCase.err)
+
+			logger.AssertExpectations(t)
+		})
+	}
+}
+
+type fakeServerStreamHandle struct {
+	grpc.ServerStream
+
+	received int
+}
+
+func (stream *fakeServerStreamHandle) Context() context.Context {
+	return grpcTestContext()
+}
+
+func (stream *fakeServerStreamHandle) SendMsg(_ any) error {
+	return nil
+}
+
+func (stream *fakeServerStreamHandle) RecvMsg(msg any) error {
+	stream.received++
+	msg.(*wrapperspb.StringValue).Value = "foo"
+
+	return nil
+}
+
+func TestStreamReportInterceptor(t *testing.T) {
+	logger := quicklogmocks.NewMockLogger(t)
+	logger.
+		On("Log", quicklog.LevelError, mock.Anything).
+		Run(func(args mock.Arguments) {
+			report := args.Get(1).(quicklog.Message).RenderJSON()
+
+			grpcReport := report["grpc"].(map[string]interface{})
+			require.Equal(t, "Unavailable", grpcReport["code"])
+			require.Equal(t, int64(2), grpcReport["messagesIn"])
+			require.Equal(t, int64(3), grpcReport["messagesOut"])
+		}).
+		Once()
+
+	interceptor := ahttp.StreamReportInterceptor(logger, "")
+
+	err := interceptor(
+		nil,
+		&fakeServerStreamHandle{},
+		&grpc.StreamServerInfo{FullMethod: "/foo.Bar/Baz"},
+		func(_ any, stream grpc.ServerStream) error {
+			for range 2 {
+				require.NoError(t, stream.RecvMsg(new(wrapperspb.StringValue)))
+			}
+
+			for range 3 {
+				require.NoError(t, stream.SendMsg(wrapperspb.String("bar")))
+			}
+
+			return status.Error(codes.Unavailable, "gone")
+		},
+	)
+	require.Error(t, err)
+
+	logger.AssertExpectations(t)
+}
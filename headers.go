@@ -0,0 +1,156 @@
+package ahttp
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/metadata"
+)
+
+// GRPCMetadataHeaderPrefix is prepended to gRPC response metadata keys when they are copied onto an HTTP response.
+const GRPCMetadataHeaderPrefix = "Grpc-Metadata-"
+
+// DefaultForwardedHeaders is the list of incoming HTTP headers forwarded to gRPC metadata when no explicit
+// allowlist is provided.
+var DefaultForwardedHeaders = []string{
+	"Authorization",
+	"Accept-Language",
+	"X-Request-Id",
+	"X-Cloud-Trace-Context",
+	"Traceparent",
+	"Tracestate",
+}
+
+// Headers that only make sense for a single transport hop, and must never be forwarded.
+var hopByHopHeaders = map[string]bool{
+	"connection":          true,
+	"keep-alive":          true,
+	"proxy-authenticate":  true,
+	"proxy-authorization": true,
+	"proxy-connection":    true,
+	"te":                  true,
+	"trailer":             true,
+	"transfer-encoding":   true,
+	"upgrade":             true,
+}
+
+// Headers that are managed by the gRPC or HTTP transports themselves.
+var reservedHeaders = map[string]bool{
+	"content-type":   true,
+	"content-length": true,
+	"user-agent":     true,
+	"host":           true,
+}
+
+// isForwardableKey reports whether a header / metadata key can safely cross the HTTP <-> gRPC boundary.
+func isForwardableKey(key string) bool {
+	key = strings.ToLower(key)
+
+	if key == "" || strings.HasPrefix(key, ":") || strings.HasPrefix(key, "grpc-") {
+		return false
+	}
+
+	return !hopByHopHeaders[key] && !reservedHeaders[key]
+}
+
+// isPrintableASCII reports whether a value can be sent as a non-binary gRPC metadata value, or as an HTTP header
+// value.
+func isPrintableASCII(value string) bool {
+	for i := range len(value) {
+		if value[i] < 0x20 || value[i] > 0x7E {
+			return false
+		}
+	}
+
+	return true
+}
+
+// HeadersToMetadata extracts the allowed headers from an HTTP request, and converts them to gRPC metadata.
+// If no allowlist is provided, DefaultForwardedHeaders is used.
+//
+// Hop-by-hop headers (including the ones listed in the Connection header), transport-reserved headers and
+// values that are not valid metadata are always dropped.
+func HeadersToMetadata(header http.Header, allowed ...string) metadata.MD {
+	if len(allowed) == 0 {
+		allowed = DefaultForwardedHeaders
+	}
+
+	// Any header listed in the Connection header is hop-by-hop for this request.
+	connectionHeaders := map[string]bool{}
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			connectionHeaders[strings.ToLower(strings.TrimSpace(name))] = true
+		}
+	}
+
+	md := metadata.MD{}
+
+	for _, name := range allowed {
+		key := strings.ToLower(name)
+		if !isForwardableKey(key) || connectionHeaders[key] {
+			continue
+		}
+
+		for _, value := range header.Values(name) {
+			if isPrintableASCII(value) {
+				md.Append(key, value)
+			}
+		}
+	}
+
+	return md
+}
+
+// ForwardHeadersMiddleware attaches the allowed incoming headers as outgoing gRPC metadata on the request
+// context. If no allowlist is provided, DefaultForwardedHeaders is used.
+//
+// gRPC clients must be called with ctx.Request.Context() for the metadata to be sent.
+func ForwardHeadersMiddleware(allowed ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		md := HeadersToMetadata(ctx.Request.Header, allowed...)
+
+		if len(md) > 0 {
+			reqCtx := ctx.Request.Context()
+			if existing, ok := metadata.FromOutgoingContext(reqCtx); ok {
+				md = metadata.Join(existing, md)
+			}
+
+			ctx.Request = ctx.Request.WithContext(metadata.NewOutgoingContext(reqCtx, md))
+		}
+
+		ctx.Next()
+	}
+}
+
+// WriteGRPCMetadata copies gRPC response headers and trailers onto the HTTP response. Each key is prefixed with
+// GRPCMetadataHeaderPrefix.
+//
+// Binary metadata (keys ending with "-bin") is base64 encoded. Reserved and hop-by-hop keys, as well as values
+// that cannot be represented as HTTP header values, are dropped.
+func WriteGRPCMetadata(ctx *gin.Context, mds ...metadata.MD) {
+	header := ctx.Writer.Header()
+
+	for _, md := range mds {
+		for key, values := range md {
+			if !isForwardableKey(key) {
+				continue
+			}
+
+			name := GRPCMetadataHeaderPrefix + textproto.CanonicalMIMEHeaderKey(key)
+			binary := strings.HasSuffix(key, "-bin")
+
+			for _, value := range values {
+				if binary {
+					value = base64.StdEncoding.EncodeToString([]byte(value))
+				}
+
+				if isPrintableASCII(value) {
+					header.Add(name, value)
+				}
+			}
+		}
+	}
+}
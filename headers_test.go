@@ -0,0 +1,170 @@
+package ahttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+func TestHeadersToMetadata(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		header  http.Header
+		allowed []string
+
+		expect metadata.MD
+	}{
+		{
+			name: "DefaultAllowlist",
+
+			header: http.Header{
+				"Authorization":   []string{"Bearer foo"},
+				"Accept-Language": []string{"fr-FR"},
+				"X-Request-Id":    []string{"abc"},
+				"X-Other":         []string{"bar"},
+			},
+
+			expect: metadata.MD{
+				"authorization":   []string{"Bearer foo"},
+				"accept-language": []string{"fr-FR"},
+				"x-request-id":    []string{"abc"},
+			},
+		},
+		{
+			name: "CustomAllowlist",
+
+			header: http.Header{
+				"Authorization": []string{"Bearer foo"},
+				"X-Other":       []string{"bar", "baz"},
+			},
+			allowed: []string{"X-Other"},
+
+			expect: metadata.MD{
+				"x-other": []string{"bar", "baz"},
+			},
+		},
+		{
+			name: "ReservedAndHopByHop",
+
+			header: http.Header{
+				"Connection":   []string{"X-Custom"},
+				"Content-Type": []string{"application/json"},
+				"Grpc-Timeout": []string{"1S"},
+				"Te":           []string{"trailers"},
+				"X-Custom":     []string{"foo"},
+				"X-Other":      []string{"bar"},
+			},
+			allowed: []string{"Connection", "Content-Type", "Grpc-Timeout", "Te", "X-Custom", "X-Other"},
+
+			expect: metadata.MD{
+				"x-other": []string{"bar"},
+			},
+		},
+		{
+			name: "InvalidValue",
+
+			header: http.Header{
+				"X-Other": []string{"bar\x00", "baz"},
+			},
+			allowed: []string{"X-Other"},
+
+			expect: metadata.MD{
+				"x-other": []string{"baz"},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.expect, ahttp.HeadersToMetadata(testCase.header, testCase.allowed...))
+		})
+	}
+}
+
+func TestForwardHeadersMiddleware(t *testing.T) {
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/foo", nil)
+	ctx.Request.Header.Set("Authorization", "Bearer foo")
+	ctx.Request = ctx.Request.WithContext(
+		metadata.NewOutgoingContext(ctx.Request.Context(), metadata.Pairs("x-existing", "bar")),
+	)
+
+	ahttp.ForwardHeadersMiddleware()(ctx)
+
+	md, ok := metadata.FromOutgoingContext(ctx.Request.Context())
+	require.True(t, ok)
+	require.Equal(t, metadata.MD{
+		"authorization": []string{"Bearer foo"},
+		"x-existing":    []string{"bar"},
+	}, md)
+}
+
+func TestWriteGRPCMetadata(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		mds []metadata.MD
+
+		expect http.Header
+	}{
+		{
+			name: "HeadersAndTrailers",
+
+			mds: []metadata.MD{
+				metadata.Pairs("x-foo", "bar"),
+				metadata.Pairs("x-baz", "qux", "x-baz", "quux"),
+			},
+
+			expect: http.Header{
+				"Grpc-Metadata-X-Foo": []string{"bar"},
+				"Grpc-Metadata-X-Baz": []string{"qux", "quux"},
+			},
+		},
+		{
+			name: "Binary",
+
+			mds: []metadata.MD{
+				metadata.Pairs("x-data-bin", "\x00\x01"),
+			},
+
+			expect: http.Header{
+				"Grpc-Metadata-X-Data-Bin": []string{"AAE="},
+			},
+		},
+		{
+			name: "Reserved",
+
+			mds: []metadata.MD{
+				metadata.Pairs(
+					"content-type", "application/grpc",
+					"grpc-status", "0",
+					"connection", "close",
+					"x-foo", "bar",
+				),
+			},
+
+			expect: http.Header{
+				"Grpc-Metadata-X-Foo": []string{"bar"},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodGet, "/foo", nil)
+
+			ahttp.WriteGRPCMetadata(ctx, testCase.mds...)
+			require.Equal(t, testCase.expect, ctx.Writer.Header())
+		})
+	}
+}
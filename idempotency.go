@@ -0,0 +1,252 @@
+package ahttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	DefaultIdempotencyTTL     = 24 * time.Hour
+	DefaultIdempotencyLockTTL = time.Minute
+	// DefaultIdempotencyMaxBodySize is the size of the largest body hashed by IdempotencyMiddleware.
+	DefaultIdempotencyMaxBodySize = 1 << 20
+)
+
+// Keys longer than this are rejected, so clients cannot fill the store with large keys.
+const idempotencyMaxKeyLength = 255
+
+// IdempotencyRecord is the state of an idempotency key.
+type IdempotencyRecord struct {
+	// BodyHash is the SHA-256 of the body of the original request.
+	BodyHash string
+	// Response is nil while the original request is in flight.
+	Response *StoredResponse
+}
+
+// IdempotencyStore persists idempotency records.
+type IdempotencyStore interface {
+	// Lock creates the record of key, unless one exists. If it does, Lock returns it and false. The record
+	// expires after ttl.
+	Lock(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, bool, error)
+	// Save replaces the record of key, which expires after ttl.
+	Save(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error
+	// Unlock removes the record of key, so the request can be retried.
+	Unlock(ctx context.Context, key string) error
+}
+
+type memoryIdempotencyStore struct {
+	cache *ttlCache[*IdempotencyRecord]
+}
+
+func (store *memoryIdempotencyStore) Lock(
+	_ context.Context, key string, record *IdempotencyRecord, ttl time.Duration,
+) (*IdempotencyRecord, bool, error) {
+	var existing *IdempotencyRecord
+
+	locked := store.cache.update(
+		key, time.Now(),
+		func(current *IdempotencyRecord, found bool) (*IdempotencyRecord, time.Duration, bool) {
+			existing = current
+			return record, ttl, !found
+		},
+	)
+
+	return existing, locked, nil
+}
+
+func (store *memoryIdempotencyStore) Save(
+	_ context.Context, key string, record *IdempotencyRecord, ttl time.Duration,
+) error {
+	store.cache.update(key, time.Now(), func(_ *IdempotencyRecord, _ bool) (*IdempotencyRecord, time.Duration, bool) {
+		return record, ttl, true
+	})
+
+	return nil
+}
+
+func (store *memoryIdempotencyStore) Unlock(_ context.Context, key string) error {
+	store.cache.delete(key)
+	return nil
+}
+
+// NewMemoryIdempotencyStore returns an IdempotencyStore that keeps records in memory, until they expire. It is
+// not shared between instances of a service.
+func NewMemoryIdempotencyStore() IdempotencyStore {
+	return &memoryIdempotencyStore{cache: newTTLCache[*IdempotencyRecord]()}
+}
+
+type IdempotencyConfig struct {
+	// Store defaults to an in-memory store.
+	Store IdempotencyStore
+	// Principal identifies the client of a request, such as a user ID, so clients cannot read each other's
+	// responses. Keys are shared by all clients when it is nil.
+	Principal func(ctx *gin.Context) string
+
+	// TTL is the time responses are kept for. Defaults to DefaultIdempotencyTTL.
+	TTL time.Duration
+	// LockTTL is the time a key stays locked by a request in flight, in case the instance serving it dies.
+	// Defaults to DefaultIdempotencyLockTTL.
+	LockTTL time.Duration
+	// MaxBodySize limits the body read to hash requests with an idempotency key. Larger requests are rejected with
+	// a 413 status. Defaults to DefaultIdempotencyMaxBodySize.
+	MaxBodySize int64
+}
+
+func idempotencyStoreKey(ctx *gin.Context, config *IdempotencyConfig, key string) string {
+	var principal string
+	if config.Principal != nil {
+		principal = config.Principal(ctx)
+	}
+
+	return fmt.Sprintf("%s %s\x00%s\x00%s", ctx.Request.Method, ctx.FullPath(), principal, key)
+}
+
+// hashRequestBody reads the request body to hash it, and replaces it with a copy.
+func hashRequestBody(ctx *gin.Context, limit int64) (string, error) {
+	if ctx.Request.Body == nil || ctx.Request.Body == http.NoBody {
+		sum := sha256.Sum256(nil)
+		return hex.EncodeToString(sum[:]), nil
+	}
+
+	data, err := readBodyWithLimit(ctx.Request, limit)
+	if err != nil {
+		return "", err
+	}
+
+	ctx.Request.Body = io.NopCloser(bytes.NewReader(data))
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// IdempotencyMiddleware makes POST and PATCH requests with an Idempotency-Key header safe to retry.
+//
+// The first completed response for a key is stored, and replayed to retries with the Idempotent-Replayed
+// header. Keys are scoped by route and principal. Retries are rejected with a 409 status while the original
+// request is in flight, and with a 422 status if their body differs from the original one.
+//
+// Server errors (5xx) are not stored, so the request can be retried.
+func IdempotencyMiddleware(config IdempotencyConfig) gin.HandlerFunc {
+	if config.Store == nil {
+		config.Store = NewMemoryIdempotencyStore()
+	}
+
+	if config.TTL <= 0 {
+		config.TTL = DefaultIdempotencyTTL
+	}
+
+	if config.LockTTL <= 0 {
+		config.LockTTL = DefaultIdempotencyLockTTL
+	}
+
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = DefaultIdempotencyMaxBodySize
+	}
+
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader(IdempotencyKeyHeader)
+		if key == "" || (ctx.Request.Method != http.MethodPost && ctx.Request.Method != http.MethodPatch) {
+			ctx.Next()
+			return
+		}
+
+		if len(key) > idempotencyMaxKeyLength {
+			HandleGRPCErrorProblem(ctx, status.Errorf(
+				codes.InvalidArgument, "%s exceeds %d characters", IdempotencyKeyHeader, idempotencyMaxKeyLength,
+			))
+
+			return
+		}
+
+		bodyHash, err := hashRequestBody(ctx, config.MaxBodySize)
+		if err != nil {
+			HandleGRPCErrorProblem(ctx, err)
+			return
+		}
+
+		storeKey := idempotencyStoreKey(ctx, &config, key)
+
+		existing, locked, err := config.Store.Lock(
+			ctx.Request.Context(), storeKey, &IdempotencyRecord{BodyHash: bodyHash}, config.LockTTL,
+		)
+		if err != nil {
+			// The error is reported, but its details are not sent to the client.
+			abortWithProblem(
+				ctx, newProblem(http.StatusServiceUnavailable, "idempotency store unavailable"),
+				fmt.Errorf("lock idempotency key: %w", err),
+			)
+
+			return
+		}
+
+		if !locked {
+			replayIdempotentResponse(ctx, existing, bodyHash)
+			return
+		}
+
+		saved := false
+
+		defer func() {
+			if !saved {
+				if err := config.Store.Unlock(context.WithoutCancel(ctx.Request.Context()), storeKey); err != nil {
+					_ = ctx.Error(fmt.Errorf("unlock idempotency key: %w", err))
+				}
+			}
+		}()
+
+		original := ctx.Writer
+		recorder := newResponseRecorder(original)
+		ctx.Writer = recorder
+
+		ctx.Next()
+
+		ctx.Writer = original
+
+		response := recorder.response()
+		if response.Status >= http.StatusInternalServerError {
+			return
+		}
+
+		record := &IdempotencyRecord{BodyHash: bodyHash, Response: response}
+
+		if err := config.Store.Save(context.WithoutCancel(ctx.Request.Context()), storeKey, record, config.TTL); err != nil {
+			_ = ctx.Error(fmt.Errorf("save idempotency key: %w", err))
+			return
+		}
+
+		saved = true
+	}
+}
+
+var (
+	errIdempotencyMismatch = errors.New("idempotency key was used with a different request body")
+	errIdempotencyInFlight = errors.New("a request with the same idempotency key is in progress")
+)
+
+func replayIdempotentResponse(ctx *gin.Context, record *IdempotencyRecord, bodyHash string) {
+	switch {
+	case record.BodyHash != bodyHash:
+		abortWithProblem(
+			ctx, newProblem(http.StatusUnprocessableEntity, errIdempotencyMismatch.Error()), errIdempotencyMismatch,
+		)
+	case record.Response == nil:
+		abortWithProblem(ctx, newProblem(http.StatusConflict, errIdempotencyInFlight.Error()), errIdempotencyInFlight)
+	default:
+		ctx.Header(IdempotentReplayedHeader, "true")
+		record.Response.write(ctx.Writer)
+		ctx.Abort()
+	}
+}
@@ -0,0 +1,323 @@
+package ahttp_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+type idempotentRequest struct {
+	method    string
+	key       string
+	principal string
+	body      string
+
+	expectCode     int
+	expectBody     string
+	expectReplayed bool
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		handlerStatus int
+		requests      []idempotentRequest
+	}{
+		{
+			name: "Replay",
+
+			handlerStatus: http.StatusCreated,
+			requests: []idempotentRequest{
+				{key: "a", body: "foo", expectCode: http.StatusCreated, expectBody: "call 1: foo"},
+				{key: "a", body: "foo", expectCode: http.StatusCreated, expectBody: "call 1: foo", expectReplayed: true},
+				{key: "b", body: "foo", expectCode: http.StatusCreated, expectBody: "call 2: foo"},
+			},
+		},
+		{
+			name: "ClientError",
+
+			handlerStatus: http.StatusNotFound,
+			requests: []idempotentRequest{
+				{key: "a", body: "foo", expectCode: http.StatusNotFound, expectBody: "call 1: foo"},
+				{key: "a", body: "foo", expectCode: http.StatusNotFound, expectBody: "call 1: foo", expectReplayed: true},
+			},
+		},
+		{
+			name: "ServerError",
+
+			handlerStatus: http.StatusServiceUnavailable,
+			requests: []idempotentRequest{
+				{key: "a", body: "foo", expectCode: http.StatusServiceUnavailable, expectBody: "call 1: foo"},
+				{key: "a", body: "foo", expectCode: http.StatusServiceUnavailable, expectBody: "call 2: foo"},
+			},
+		},
+		{
+			name: "BodyMismatch",
+
+			handlerStatus: http.StatusCreated,
+			requests: []idempotentRequest{
+				{key: "a", body: "foo", expectCode: http.StatusCreated, expectBody: "call 1: foo"},
+				{
+					key: "a", body: "bar",
+					expectCode: http.StatusUnprocessableEntity,
+					expectBody: `{"title":"Unprocessable Entity","status":422,` +
+						`"detail":"idempotency key was used with a different request body","code":"InvalidArgument"}`,
+				},
+			},
+		},
+		{
+			name: "Principal",
+
+			handlerStatus: http.StatusCreated,
+			requests: []idempotentRequest{
+				{key: "a", principal: "alice", body: "foo", expectCode: http.StatusCreated, expectBody: "call 1: foo"},
+				{key: "a", principal: "bob", body: "foo", expectCode: http.StatusCreated, expectBody: "call 2: foo"},
+			},
+		},
+		{
+			name: "NoKey",
+
+			handlerStatus: http.StatusCreated,
+			requests: []idempotentRequest{
+				{body: "foo", expectCode: http.StatusCreated, expectBody: "call 1: foo"},
+				{body: "foo", expectCode: http.StatusCreated, expectBody: "call 2: foo"},
+			},
+		},
+		{
+			name: "OtherMethod",
+
+			handlerStatus: http.StatusOK,
+			requests: []idempotentRequest{
+				{method: http.MethodPut, key: "a", body: "foo", expectCode: http.StatusOK, expectBody: "call 1: foo"},
+				{method: http.MethodPut, key: "a", body: "foo", expectCode: http.StatusOK, expectBody: "call 2: foo"},
+			},
+		},
+		{
+			name: "KeyTooLong",
+
+			handlerStatus: http.StatusCreated,
+			requests: []idempotentRequest{
+				{
+					key: strings.Repeat("a", 256), body: "foo",
+					expectCode: http.StatusUnprocessableEntity,
+					expectBody: `{"title":"Unprocessable Entity","status":422,` +
+						`"detail":"Idempotency-Key exceeds 255 characters","code":"InvalidArgument"}`,
+				},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			calls := 0
+
+			router := gin.New()
+			router.Use(ahttp.IdempotencyMiddleware(ahttp.IdempotencyConfig{
+				Principal: func(ctx *gin.Context) string {
+					return ctx.GetHeader("X-Principal")
+				},
+			}))
+			handler := func(ctx *gin.Context) {
+				calls++
+
+				data, err := io.ReadAll(ctx.Request.Body)
+				require.NoError(t, err)
+
+				ctx.Header("X-Call", fmt.Sprint(calls))
+				ctx.String(testCase.handlerStatus, "call %d: %s", calls, data)
+			}
+
+			router.POST("/foo", handler)
+			router.PUT("/foo", handler)
+
+			for i, request := range testCase.requests {
+				method := request.method
+				if method == "" {
+					method = http.MethodPost
+				}
+
+				req := httptest.NewRequest(method, "/foo", strings.NewReader(request.body))
+				if request.key != "" {
+					req.Header.Set(ahttp.IdempotencyKeyHeader, request.key)
+				}
+
+				req.Header.Set("X-Principal", request.principal)
+
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				require.Equal(t, request.expectCode, w.Code, "request %d", i)
+				require.Equal(t, request.expectBody, w.Body.String(), "request %d", i)
+
+				if request.expectReplayed {
+					require.Equal(t, "true", w.Header().Get(ahttp.IdempotentReplayedHeader), "request %d", i)
+					require.Equal(t, "1", w.Header().Get("X-Call"), "request %d", i)
+				} else {
+					require.Empty(t, w.Header().Get(ahttp.IdempotentReplayedHeader), "request %d", i)
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotencyMiddlewareInFlight(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	router := gin.New()
+	router.POST("/foo", ahttp.IdempotencyMiddleware(ahttp.IdempotencyConfig{}), func(ctx *gin.Context) {
+		close(started)
+		<-release
+		ctx.String(http.StatusCreated, "done")
+	})
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/foo", strings.NewReader("foo"))
+		req.Header.Set(ahttp.IdempotencyKeyHeader, "a")
+
+		return req
+	}
+
+	original := httptest.NewRecorder()
+	done := make(chan struct{})
+
+	go func() {
+		router.ServeHTTP(original, newRequest())
+		close(done)
+	}()
+
+	<-started
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newRequest())
+
+	require.Equal(t, http.StatusConflict, w.Code)
+	require.Equal(t, ahttp.ContentTypeProblem, w.Header().Get("Content-Type"))
+
+	close(release)
+	<-done
+
+	require.Equal(t, http.StatusCreated, original.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, newRequest())
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Equal(t, "done", w.Body.String())
+}
+
+func TestIdempotencyMiddlewareCompression(t *testing.T) {
+	body := strings.Repeat("hello world ", 200)
+
+	router := gin.New()
+	router.Use(
+		ahttp.CompressionMiddleware(ahttp.CompressionConfig{}),
+		ahttp.IdempotencyMiddleware(ahttp.IdempotencyConfig{}),
+	)
+	router.POST("/foo", func(ctx *gin.Context) {
+		ctx.String(http.StatusCreated, body)
+	})
+
+	for _, acceptEncoding := range []string{"gzip", ""} {
+		req := httptest.NewRequest(http.MethodPost, "/foo", nil)
+		req.Header.Set(ahttp.IdempotencyKeyHeader, "a")
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		// The stored response is not compressed, so it can be replayed with another encoding.
+		require.Equal(t, http.StatusCreated, w.Code)
+		require.Equal(t, acceptEncoding, w.Header().Get("Content-Encoding"))
+		require.Equal(t, body, decodeBody(t, acceptEncoding, w.Body.Bytes()))
+	}
+}
+
+type failingIdempotencyStore struct {
+	ahttp.IdempotencyStore
+}
+
+func (failingIdempotencyStore) Lock(
+	context.Context, string, *ahttp.IdempotencyRecord, time.Duration,
+) (*ahttp.IdempotencyRecord, bool, error) {
+	return nil, false, errors.New("dial tcp 10.0.0.12:6379: connection refused")
+}
+
+func TestIdempotencyMiddlewareErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		config ahttp.IdempotencyConfig
+		body   io.Reader
+
+		expectCode  int
+		expectError string
+	}{
+		{
+			name: "StoreUnavailable",
+
+			config: ahttp.IdempotencyConfig{Store: failingIdempotencyStore{}},
+			body:   strings.NewReader("foo"),
+
+			expectCode:  http.StatusServiceUnavailable,
+			expectError: "lock idempotency key: dial tcp 10.0.0.12:6379: connection refused",
+		},
+		{
+			name: "BodyTooLarge",
+
+			config: ahttp.IdempotencyConfig{MaxBodySize: 2},
+			body:   strings.NewReader("foo"),
+
+			expectCode:  http.StatusRequestEntityTooLarge,
+			expectError: "http: request body too large",
+		},
+		{
+			name: "BodyTooLarge/UnknownLength",
+
+			config: ahttp.IdempotencyConfig{MaxBodySize: 2},
+			body:   io.NopCloser(strings.NewReader("foo")),
+
+			expectCode:  http.StatusRequestEntityTooLarge,
+			expectError: "http: request body too large",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var handlerErrors []string
+
+			router := gin.New()
+			router.Use(func(ctx *gin.Context) {
+				ctx.Next()
+				handlerErrors = ctx.Errors.Errors()
+			})
+			router.POST("/foo", ahttp.IdempotencyMiddleware(testCase.config), func(ctx *gin.Context) {
+				ctx.Status(http.StatusCreated)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/foo", testCase.body)
+			req.Header.Set(ahttp.IdempotencyKeyHeader, "a")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, testCase.expectCode, w.Code)
+			require.Equal(t, ahttp.ContentTypeProblem, w.Header().Get("Content-Type"))
+			// Internal errors are reported, but not sent to the client.
+			require.Equal(t, []string{testCase.expectError}, handlerErrors)
+			require.NotContains(t, w.Body.String(), "10.0.0.12")
+		})
+	}
+}
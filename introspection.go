@@ -0,0 +1,292 @@
+package ahttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	DefaultIntrospectionMaxTTL      = 5 * time.Minute
+	DefaultIntrospectionNegativeTTL = 10 * time.Second
+)
+
+// maxIntrospectionSize limits the size of introspection responses.
+const maxIntrospectionSize = 1 << 20
+
+var (
+	ErrTokenInactive            = errors.New("token is not active")
+	ErrIntrospectionUnavailable = errors.New("introspection unavailable")
+)
+
+// IntrospectionResponse is the result of a token introspection, as described in RFC 7662.
+type IntrospectionResponse struct {
+	Active   bool
+	Subject  string
+	Scopes   []string
+	ClientID string
+	Issuer   string
+	Audience []string
+	// ExpiresAt is the zero time if the token does not expire.
+	ExpiresAt time.Time
+	// Claims are all the members of the response, including extensions.
+	Claims map[string]any
+}
+
+func introspectionResponseFromClaims(claims map[string]any) (*IntrospectionResponse, error) {
+	response := &IntrospectionResponse{Claims: claims, Audience: stringsClaim(claims, "aud")}
+	response.Active, _ = claims["active"].(bool)
+	response.Subject, _ = claims["sub"].(string)
+	response.ClientID, _ = claims["client_id"].(string)
+	response.Issuer, _ = claims["iss"].(string)
+
+	if scope, ok := claims["scope"].(string); ok {
+		response.Scopes = strings.Fields(scope)
+	}
+
+	expiresAt, ok, err := numericClaim(claims, "exp")
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		response.ExpiresAt = expiresAt
+	}
+
+	return response, nil
+}
+
+// Introspector validates opaque tokens. Errors are treated as the introspection service being unavailable,
+// except Unauthenticated statuses, which mark the token as inactive.
+type Introspector interface {
+	Introspect(ctx context.Context, token string) (*IntrospectionResponse, error)
+}
+
+// IntrospectorFunc adapts a function, such as a call to a gRPC auth service, to the Introspector interface.
+type IntrospectorFunc func(ctx context.Context, token string) (*IntrospectionResponse, error)
+
+func (introspector IntrospectorFunc) Introspect(ctx context.Context, token string) (*IntrospectionResponse, error) {
+	return introspector(ctx, token)
+}
+
+type HTTPIntrospectorConfig struct {
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+	// ClientID and ClientSecret authenticate the server to the introspection endpoint, with basic
+	// authentication.
+	ClientID     string
+	ClientSecret string
+}
+
+type httpIntrospector struct {
+	endpoint string
+	config   HTTPIntrospectorConfig
+}
+
+func (introspector *httpIntrospector) Introspect(ctx context.Context, token string) (*IntrospectionResponse, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, introspector.endpoint, strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if introspector.config.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(introspector.config.ClientID), url.QueryEscape(introspector.config.ClientSecret))
+	}
+
+	res, err := introspector.config.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("introspect token: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspect token: unexpected status %d", res.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxIntrospectionSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read introspection: %w", err)
+	}
+
+	if len(data) > maxIntrospectionSize {
+		return nil, fmt.Errorf("%w: introspection exceeds %d bytes", ErrIntrospectionUnavailable, maxIntrospectionSize)
+	}
+
+	var claims map[string]any
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("parse introspection: %w", err)
+	}
+
+	return introspectionResponseFromClaims(claims)
+}
+
+// NewHTTPIntrospector returns an Introspector that calls an RFC 7662 introspection endpoint.
+func NewHTTPIntrospector(endpoint string, config HTTPIntrospectorConfig) Introspector {
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+
+	return &httpIntrospector{endpoint: endpoint, config: config}
+}
+
+type TokenIntrospectorConfig struct {
+	Introspector Introspector
+	// Audience must be one of the audiences of the token, if set.
+	Audience string
+
+	// MaxTTL caps the time active tokens are cached for, so revocations are eventually seen. Active tokens are
+	// never cached past their expiration. Defaults to DefaultIntrospectionMaxTTL.
+	MaxTTL time.Duration
+	// NegativeTTL is the time inactive tokens are cached for. Defaults to DefaultIntrospectionNegativeTTL.
+	NegativeTTL time.Duration
+
+	// Realm is the realm of the WWW-Authenticate header.
+	Realm string
+	// Optional lets requests without an Authorization header through, without a principal.
+	Optional bool
+}
+
+// TokenIntrospector authenticates requests with opaque bearer tokens.
+type TokenIntrospector struct {
+	config TokenIntrospectorConfig
+	// cache holds the principal of active tokens, and nil for inactive ones.
+	cache *ttlCache[*Principal]
+}
+
+func NewTokenIntrospector(config TokenIntrospectorConfig) *TokenIntrospector {
+	if config.MaxTTL <= 0 {
+		config.MaxTTL = DefaultIntrospectionMaxTTL
+	}
+
+	if config.NegativeTTL <= 0 {
+		config.NegativeTTL = DefaultIntrospectionNegativeTTL
+	}
+
+	return &TokenIntrospector{config: config, cache: newTTLCache[*Principal]()}
+}
+
+func (introspector *TokenIntrospector) introspect(
+	ctx context.Context, token string, now time.Time,
+) (*Principal, time.Duration, error) {
+	response, err := introspector.config.Introspector.Introspect(ctx, token)
+	if grpcStatus, ok := statusFromError(err); ok && grpcStatus.Code() == codes.Unauthenticated {
+		response, err = &IntrospectionResponse{}, nil
+	}
+
+	if err != nil && !errors.Is(err, ErrIntrospectionUnavailable) {
+		err = fmt.Errorf("%w: %w", ErrIntrospectionUnavailable, err)
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if !response.Active || (!response.ExpiresAt.IsZero() && !now.Before(response.ExpiresAt)) ||
+		(introspector.config.Audience != "" && !slices.Contains(response.Audience, introspector.config.Audience)) {
+		return nil, introspector.config.NegativeTTL, nil
+	}
+
+	ttl := introspector.config.MaxTTL
+	if !response.ExpiresAt.IsZero() {
+		ttl = min(ttl, response.ExpiresAt.Sub(now))
+	}
+
+	principal := &Principal{Subject: response.Subject, Scopes: response.Scopes, Claims: response.Claims}
+
+	return principal, ttl, nil
+}
+
+// Introspect returns the principal of an active token. Inactive tokens return ErrTokenInactive, and failures of
+// the introspection service return ErrIntrospectionUnavailable. Results are cached.
+func (introspector *TokenIntrospector) Introspect(ctx context.Context, token string) (*Principal, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+	now := time.Now()
+
+	principal, ok := introspector.cache.get(key, now)
+	if !ok {
+		var (
+			ttl time.Duration
+			err error
+		)
+
+		principal, ttl, err = introspector.introspect(ctx, token, now)
+		if err != nil {
+			return nil, err
+		}
+
+		introspector.cache.update(key, now, func(_ *Principal, _ bool) (*Principal, time.Duration, bool) {
+			return principal, ttl, true
+		})
+	}
+
+	if principal == nil {
+		return nil, ErrTokenInactive
+	}
+
+	return principal, nil
+}
+
+// Middleware authenticates requests with the bearer token of their Authorization header, like the middleware
+// of JWTVerifier. A 503 status is returned when the introspection service is unavailable.
+func (introspector *TokenIntrospector) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token, present := bearerToken(ctx)
+		if !present && introspector.config.Optional {
+			ctx.Next()
+			return
+		}
+
+		if !present {
+			abortUnauthenticated(ctx, introspector.config.Realm, "", ErrMissingToken)
+			return
+		}
+
+		if token == "" {
+			abortUnauthenticated(ctx, introspector.config.Realm, AuthErrorInvalidRequest, ErrMalformedToken)
+			return
+		}
+
+		principal, err := introspector.Introspect(ctx.Request.Context(), token)
+		if errors.Is(err, ErrIntrospectionUnavailable) {
+			HandleGRPCErrorProblem(ctx, status.Error(codes.Unavailable, ErrIntrospectionUnavailable.Error()))
+			_ = ctx.Error(err)
+
+			return
+		}
+
+		if err != nil {
+			abortUnauthenticated(ctx, introspector.config.Realm, AuthErrorInvalidToken, err)
+			return
+		}
+
+		setPrincipal(ctx, principal)
+		ctx.Next()
+	}
+}
@@ -0,0 +1,309 @@
+package ahttp_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+func newIntrospectionServer(t *testing.T, responses map[string]map[string]any) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+
+	calls := new(atomic.Int64)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok || clientID != "api" || clientSecret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		require.Equal(t, http.MethodPost, r.Method)
+		require.NoError(t, r.ParseForm())
+
+		response, ok := responses[r.PostForm.Get("token")]
+		if !ok {
+			response = map[string]any{"active": false}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(response))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, calls
+}
+
+func TestTokenIntrospectorMiddleware(t *testing.T) {
+	now := time.Now()
+
+	server, _ := newIntrospectionServer(t, map[string]map[string]any{
+		"active": {
+			"active": true, "sub": "alice", "scope": "read write", "aud": []string{"api", "admin"},
+			"exp": now.Add(time.Hour).Unix(),
+		},
+		"expired":       {"active": true, "sub": "alice", "exp": now.Add(-time.Minute).Unix()},
+		"otherAudience": {"active": true, "sub": "alice", "aud": "other"},
+		"malformed":     {"active": true, "sub": "alice", "exp": "tomorrow"},
+	})
+
+	testCases := []struct {
+		name string
+
+		optional      bool
+		authorization string
+
+		expectCode      int
+		expectBody      string
+		expectChallenge string
+	}{
+		{
+			name: "Active",
+
+			authorization: "Bearer active",
+
+			expectCode: http.StatusOK,
+			expectBody: "alice [read write]",
+		},
+		{
+			name: "Inactive",
+
+			authorization: "Bearer foo",
+
+			expectCode:      http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api", error="invalid_token", error_description="token is not active"`,
+		},
+		{
+			name: "Expired",
+
+			authorization: "Bearer expired",
+
+			expectCode:      http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api", error="invalid_token", error_description="token is not active"`,
+		},
+		{
+			name: "OtherAudience",
+
+			authorization: "Bearer otherAudience",
+
+			expectCode:      http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api", error="invalid_token", error_description="token is not active"`,
+		},
+		{
+			name: "MalformedResponse",
+
+			authorization: "Bearer malformed",
+
+			expectCode: http.StatusServiceUnavailable,
+		},
+		{
+			name: "MissingToken",
+
+			expectCode:      http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api"`,
+		},
+		{
+			name: "EmptyToken",
+
+			authorization: "Bearer ",
+
+			expectCode:      http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api", error="invalid_request", error_description="malformed token"`,
+		},
+		{
+			name: "Optional",
+
+			optional: true,
+
+			expectCode: http.StatusOK,
+			expectBody: "anonymous",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			introspector := ahttp.NewTokenIntrospector(ahttp.TokenIntrospectorConfig{
+				Introspector: ahttp.NewHTTPIntrospector(server.URL, ahttp.HTTPIntrospectorConfig{
+					ClientID:     "api",
+					ClientSecret: "secret",
+				}),
+				Audience: "api",
+				Realm:    "api",
+				Optional: testCase.optional,
+			})
+
+			router := gin.New()
+			router.GET("/foo", introspector.Middleware(), func(ctx *gin.Context) {
+				principal, ok := ahttp.PrincipalFromContext(ctx.Request.Context())
+				if !ok {
+					ctx.String(http.StatusOK, "anonymous")
+					return
+				}
+
+				ctx.String(http.StatusOK, "%s %v", principal.Subject, principal.Scopes)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/foo", nil)
+			if testCase.authorization != "" {
+				req.Header.Set("Authorization", testCase.authorization)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, testCase.expectCode, w.Code)
+			require.Equal(t, testCase.expectChallenge, w.Header().Get("WWW-Authenticate"))
+
+			if testCase.expectBody != "" {
+				require.Equal(t, testCase.expectBody, w.Body.String())
+			} else {
+				require.Equal(t, ahttp.ContentTypeProblem, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestTokenIntrospectorCache(t *testing.T) {
+	// Introspection responses have a precision of a second, so the token expires in 1 to 2 seconds.
+	expiresAt := time.Unix(time.Now().Unix()+2, 0)
+
+	server, calls := newIntrospectionServer(t, map[string]map[string]any{
+		"active":   {"active": true, "sub": "alice"},
+		"expiring": {"active": true, "sub": "bob", "exp": expiresAt.Unix()},
+	})
+
+	introspector := ahttp.NewTokenIntrospector(ahttp.TokenIntrospectorConfig{
+		Introspector: ahttp.NewHTTPIntrospector(server.URL, ahttp.HTTPIntrospectorConfig{
+			ClientID:     "api",
+			ClientSecret: "secret",
+		}),
+		NegativeTTL: 50 * time.Millisecond,
+	})
+
+	// Active tokens are cached.
+	for range 3 {
+		principal, err := introspector.Introspect(context.Background(), "active")
+		require.NoError(t, err)
+		require.Equal(t, "alice", principal.Subject)
+		require.Equal(t, "alice", principal.Claims["sub"])
+	}
+
+	require.Equal(t, int64(1), calls.Load())
+
+	// Inactive tokens are cached briefly.
+	for range 3 {
+		_, err := introspector.Introspect(context.Background(), "foo")
+		require.ErrorIs(t, err, ahttp.ErrTokenInactive)
+	}
+
+	require.Equal(t, int64(2), calls.Load())
+
+	time.Sleep(60 * time.Millisecond)
+
+	_, err := introspector.Introspect(context.Background(), "foo")
+	require.ErrorIs(t, err, ahttp.ErrTokenInactive)
+	require.Equal(t, int64(3), calls.Load())
+
+	// Active tokens are not cached past their expiration.
+	principal, err := introspector.Introspect(context.Background(), "expiring")
+	require.NoError(t, err)
+	require.Equal(t, "bob", principal.Subject)
+
+	time.Sleep(time.Until(expiresAt))
+
+	_, err = introspector.Introspect(context.Background(), "expiring")
+	require.ErrorIs(t, err, ahttp.ErrTokenInactive)
+	require.Equal(t, int64(5), calls.Load())
+}
+
+func TestTokenIntrospectorUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	introspector := ahttp.NewTokenIntrospector(ahttp.TokenIntrospectorConfig{
+		Introspector: ahttp.NewHTTPIntrospector(server.URL, ahttp.HTTPIntrospectorConfig{}),
+	})
+
+	router := gin.New()
+	router.GET("/foo", introspector.Middleware(), func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/foo", nil)
+	req.Header.Set("Authorization", "Bearer foo")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Empty(t, w.Header().Get("WWW-Authenticate"))
+
+	// Failures are not cached.
+	_, err := introspector.Introspect(context.Background(), "foo")
+	require.ErrorIs(t, err, ahttp.ErrIntrospectionUnavailable)
+}
+
+func TestHTTPIntrospectorTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"active":true,"sub":"` + strings.Repeat("a", 1<<20) + `"}`))
+	}))
+	defer server.Close()
+
+	introspector := ahttp.NewHTTPIntrospector(server.URL, ahttp.HTTPIntrospectorConfig{})
+
+	_, err := introspector.Introspect(context.Background(), "foo")
+	require.ErrorIs(t, err, ahttp.ErrIntrospectionUnavailable)
+}
+
+func TestIntrospectorFunc(t *testing.T) {
+	var calls atomic.Int64
+
+	// Stands in for a gRPC auth client.
+	introspector := ahttp.NewTokenIntrospector(ahttp.TokenIntrospectorConfig{
+		Introspector: ahttp.IntrospectorFunc(
+			func(_ context.Context, token string) (*ahttp.IntrospectionResponse, error) {
+				calls.Add(1)
+
+				switch token {
+				case "active":
+					return &ahttp.IntrospectionResponse{Active: true, Subject: "alice", Scopes: []string{"read"}}, nil
+				case "revoked":
+					return nil, status.Error(codes.Unauthenticated, "token revoked")
+				default:
+					return nil, status.Error(codes.Unavailable, "auth service down")
+				}
+			},
+		),
+	})
+
+	principal, err := introspector.Introspect(context.Background(), "active")
+	require.NoError(t, err)
+	require.Equal(t, &ahttp.Principal{Subject: "alice", Scopes: []string{"read"}}, principal)
+
+	_, err = introspector.Introspect(context.Background(), "revoked")
+	require.ErrorIs(t, err, ahttp.ErrTokenInactive)
+
+	_, err = introspector.Introspect(context.Background(), "revoked")
+	require.ErrorIs(t, err, ahttp.ErrTokenInactive)
+	require.Equal(t, int64(2), calls.Load())
+
+	_, err = introspector.Introspect(context.Background(), "down")
+	require.ErrorIs(t, err, ahttp.ErrIntrospectionUnavailable)
+}
@@ -0,0 +1,363 @@
+package ahttp
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultJWKSRefreshInterval    = time.Hour
+	DefaultJWKSMinRefreshInterval = time.Minute
+	DefaultJWKSFetchTimeout       = 10 * time.Second
+)
+
+// maxJWKSSize limits the size of remote key sets.
+const maxJWKSSize = 1 << 20
+
+var (
+	ErrUnknownKey         = errors.New("unknown signing key")
+	ErrUnsupportedKeyType = errors.New("unsupported key type")
+	ErrJWKSUnavailable    = errors.New("jwks unavailable")
+)
+
+// JWK is a public key of a JSON Web Key Set.
+type JWK struct {
+	KeyID string
+	// Algorithm restricts the key to a signature algorithm, if set.
+	Algorithm string
+	// Key is an *rsa.PublicKey, an *ecdsa.PublicKey or an ed25519.PublicKey.
+	Key crypto.PublicKey
+}
+
+// JWKSource provides the keys that verify JWT signatures.
+type JWKSource interface {
+	// Key returns the key with the given ID. An empty ID selects the only key of the set, if there is one. Unknown
+	// keys return ErrUnknownKey.
+	Key(ctx context.Context, kid string) (*JWK, error)
+}
+
+// JWKS is a static JSON Web Key Set.
+type JWKS struct {
+	Keys []*JWK
+}
+
+func (jwks *JWKS) Key(_ context.Context, kid string) (*JWK, error) {
+	if kid == "" && len(jwks.Keys) == 1 {
+		return jwks.Keys[0], nil
+	}
+
+	for _, key := range jwks.Keys {
+		if key.KeyID == kid {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
+
+func (key *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch {
+	case key.Kty == "RSA":
+		n, err := decodeBigInt(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("decode modulus: %w", err)
+		}
+
+		e, err := decodeBigInt(key.E)
+		if err != nil {
+			return nil, fmt.Errorf("decode exponent: %w", err)
+		}
+
+		if !e.IsInt64() {
+			return nil, errors.New("exponent too large")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case key.Kty == "EC" && key.Crv == "P-256":
+		x, err := decodeBigInt(key.X)
+		if err != nil {
+			return nil, fmt.Errorf("decode x: %w", err)
+		}
+
+		y, err := decodeBigInt(key.Y)
+		if err != nil {
+			return nil, fmt.Errorf("decode y: %w", err)
+		}
+
+		publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if _, err := publicKey.ECDH(); err != nil {
+			return nil, fmt.Errorf("invalid point: %w", err)
+		}
+
+		return publicKey, nil
+	case key.Kty == "OKP" && key.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		if err != nil {
+			return nil, fmt.Errorf("decode x: %w", err)
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid key size %d", len(x))
+		}
+
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("%w: %s %s", ErrUnsupportedKeyType, key.Kty, key.Crv)
+	}
+}
+
+// ParseJWKS parses a JSON Web Key Set. Keys that are not meant for signatures are skipped, and so are keys of
+// unsupported types, so a set can be shared with other consumers.
+func ParseJWKS(data []byte) (*JWKS, error) {
+	var raw struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+
+	jwks := &JWKS{}
+
+	for _, key := range raw.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		publicKey, err := key.publicKey()
+		if errors.Is(err, ErrUnsupportedKeyType) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("parse key %q: %w", key.Kid, err)
+		}
+
+		jwks.Keys = append(jwks.Keys, &JWK{KeyID: key.Kid, Algorithm: key.Alg, Key: publicKey})
+	}
+
+	return jwks, nil
+}
+
+func LoadJWKSFile(path string) (*JWKS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read jwks: %w", err)
+	}
+
+	return ParseJWKS(data)
+}
+
+type RemoteJWKSConfig struct {
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+	// RefreshInterval is the time keys are cached for. Defaults to DefaultJWKSRefreshInterval.
+	RefreshInterval time.Duration
+	// MinRefreshInterval limits the refreshes caused by unknown key IDs, for example after a key rotation.
+	// Defaults to DefaultJWKSMinRefreshInterval.
+	MinRefreshInterval time.Duration
+	// FetchTimeout limits the time a fetch of the key set takes. Defaults to DefaultJWKSFetchTimeout.
+	FetchTimeout time.Duration
+}
+
+// jwksRefresh is a fetch of the key set in flight, shared by the requests that wait for it.
+type jwksRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+// RemoteJWKS is a JSON Web Key Set fetched from a URL. It is fetched on first use, then refreshed periodically,
+// or when a token references an unknown key. The last keys are kept when a refresh fails.
+//
+// Fetches run in the background, independently of the request that triggered them, and a single fetch is in
+// flight at a time. Expired keys keep being served while they are refreshed, so only requests that need a key
+// that is not known yet wait for the fetch.
+type RemoteJWKS struct {
+	url    string
+	config RemoteJWKSConfig
+
+	mu          sync.Mutex
+	jwks        *JWKS
+	fetchedAt   time.Time
+	lastAttempt time.Time
+	lastErr     error
+	refreshing  *jwksRefresh
+}
+
+func NewRemoteJWKS(url string, config RemoteJWKSConfig) *RemoteJWKS {
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = DefaultJWKSRefreshInterval
+	}
+
+	if config.MinRefreshInterval <= 0 {
+		config.MinRefreshInterval = DefaultJWKSMinRefreshInterval
+	}
+
+	if config.FetchTimeout <= 0 {
+		config.FetchTimeout = DefaultJWKSFetchTimeout
+	}
+
+	return &RemoteJWKS{url: url, config: config}
+}
+
+func (remote *RemoteJWKS) fetch(ctx context.Context) (*JWKS, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, remote.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	res, err := remote.config.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch jwks: unexpected status %d", res.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxJWKSSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read jwks: %w", err)
+	}
+
+	if len(data) > maxJWKSSize {
+		return nil, fmt.Errorf("read jwks: exceeds %d bytes", maxJWKSSize)
+	}
+
+	return ParseJWKS(data)
+}
+
+// startRefresh returns the refresh in flight, or starts a new one. It returns nil if the set was refreshed too
+// recently. It must be called with the lock held.
+func (remote *RemoteJWKS) startRefresh(now time.Time) *jwksRefresh {
+	if remote.refreshing != nil {
+		return remote.refreshing
+	}
+
+	if now.Sub(remote.lastAttempt) < remote.config.MinRefreshInterval {
+		return nil
+	}
+
+	refresh := &jwksRefresh{done: make(chan struct{})}
+	remote.refreshing, remote.lastAttempt = refresh, now
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), remote.config.FetchTimeout)
+		jwks, err := remote.fetch(ctx)
+		cancel()
+
+		remote.mu.Lock()
+
+		if err == nil {
+			remote.jwks, remote.fetchedAt = jwks, now
+		}
+
+		remote.lastErr, refresh.err = err, err
+		remote.refreshing = nil
+
+		remote.mu.Unlock()
+
+		close(refresh.done)
+	}()
+
+	return refresh
+}
+
+// wait waits for a refresh, and returns the keys that result from it.
+func (remote *RemoteJWKS) wait(ctx context.Context, refresh *jwksRefresh) (*JWKS, error) {
+	select {
+	case <-refresh.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	remote.mu.Lock()
+	defer remote.mu.Unlock()
+
+	return remote.jwks, refresh.err
+}
+
+func (remote *RemoteJWKS) Key(ctx context.Context, kid string) (*JWK, error) {
+	remote.mu.Lock()
+
+	jwks, lastErr := remote.jwks, remote.lastErr
+
+	var refresh *jwksRefresh
+	if now := time.Now(); jwks == nil || now.Sub(remote.fetchedAt) >= remote.config.RefreshInterval {
+		refresh = remote.startRefresh(now)
+	}
+
+	remote.mu.Unlock()
+
+	if jwks == nil {
+		if refresh == nil {
+			return nil, errors.Join(ErrJWKSUnavailable, lastErr)
+		}
+
+		var err error
+		if jwks, err = remote.wait(ctx, refresh); jwks == nil {
+			return nil, errors.Join(ErrJWKSUnavailable, err)
+		}
+	}
+
+	key, err := jwks.Key(ctx, kid)
+	if !errors.Is(err, ErrUnknownKey) {
+		return key, err
+	}
+
+	// The key may come from a rotation.
+	remote.mu.Lock()
+	refresh = remote.startRefresh(time.Now())
+	remote.mu.Unlock()
+
+	if refresh == nil {
+		return nil, err
+	}
+
+	if refreshed, refreshErr := remote.wait(ctx, refresh); refreshErr == nil {
+		return refreshed.Key(ctx, kid)
+	}
+
+	return nil, err
+}
@@ -0,0 +1,302 @@
+package ahttp_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+func encodeJWK(kid string, key any) map[string]string {
+	encode := base64.RawURLEncoding.EncodeToString
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA", "kid": kid, "n": encode(key.N.Bytes()), "e": encode(big.NewInt(int64(key.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		return map[string]string{
+			"kty": "EC", "kid": kid, "crv": "P-256", "x": encode(key.X.FillBytes(make([]byte, 32))),
+			"y": encode(key.Y.FillBytes(make([]byte, 32))),
+		}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "kid": kid, "crv": "Ed25519", "x": encode(key)}
+	default:
+		return nil
+	}
+}
+
+func encodeJWKS(t *testing.T, keys ...map[string]string) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	require.NoError(t, err)
+
+	return data
+}
+
+func TestParseJWKS(t *testing.T) {
+	keys := newJWTTestKeys(t)
+
+	t.Run("Keys", func(t *testing.T) {
+		encryptionKey := encodeJWK("enc", &keys.rsa.PublicKey)
+		encryptionKey["use"] = "enc"
+
+		signingKey := encodeJWK("ed25519", keys.ed25519.Public())
+		signingKey["alg"] = ahttp.JWTAlgorithmEdDSA
+		signingKey["use"] = "sig"
+
+		jwks, err := ahttp.ParseJWKS(encodeJWKS(
+			t,
+			encodeJWK("rsa", &keys.rsa.PublicKey),
+			encodeJWK("ecdsa", &keys.ecdsa.PublicKey),
+			signingKey,
+			encryptionKey,
+			map[string]string{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+		))
+		require.NoError(t, err)
+
+		require.Len(t, jwks.Keys, 3)
+		require.True(t, keys.rsa.PublicKey.Equal(jwks.Keys[0].Key))
+		require.True(t, keys.ecdsa.PublicKey.Equal(jwks.Keys[1].Key))
+		require.True(t, keys.ed25519.Public().(ed25519.PublicKey).Equal(jwks.Keys[2].Key))
+		require.Equal(t, ahttp.JWTAlgorithmEdDSA, jwks.Keys[2].Algorithm)
+
+		key, err := jwks.Key(context.Background(), "ecdsa")
+		require.NoError(t, err)
+		require.Equal(t, "ecdsa", key.KeyID)
+
+		_, err = jwks.Key(context.Background(), "enc")
+		require.ErrorIs(t, err, ahttp.ErrUnknownKey)
+
+		// Tokens without a key ID are only accepted by sets of one key.
+		_, err = jwks.Key(context.Background(), "")
+		require.ErrorIs(t, err, ahttp.ErrUnknownKey)
+	})
+
+	t.Run("SingleKey", func(t *testing.T) {
+		jwks, err := ahttp.ParseJWKS(encodeJWKS(t, encodeJWK("rsa", &keys.rsa.PublicKey)))
+		require.NoError(t, err)
+
+		key, err := jwks.Key(context.Background(), "")
+		require.NoError(t, err)
+		require.Equal(t, "rsa", key.KeyID)
+	})
+
+	t.Run("InvalidPoint", func(t *testing.T) {
+		key := encodeJWK("ecdsa", &keys.ecdsa.PublicKey)
+		key["y"] = key["x"]
+
+		_, err := ahttp.ParseJWKS(encodeJWKS(t, key))
+		require.Error(t, err)
+	})
+
+	t.Run("InvalidJSON", func(t *testing.T) {
+		_, err := ahttp.ParseJWKS([]byte("foo"))
+		require.Error(t, err)
+	})
+
+	t.Run("File", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "jwks.json")
+		require.NoError(t, os.WriteFile(path, encodeJWKS(t, encodeJWK("rsa", &keys.rsa.PublicKey)), 0o600))
+
+		jwks, err := ahttp.LoadJWKSFile(path)
+		require.NoError(t, err)
+		require.Len(t, jwks.Keys, 1)
+	})
+}
+
+func TestRemoteJWKS(t *testing.T) {
+	keys := newJWTTestKeys(t)
+
+	var (
+		fetches atomic.Int64
+		// Serves the RSA key first, then both keys after a rotation.
+		rotated atomic.Bool
+		down    atomic.Bool
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fetches.Add(1)
+
+		if down.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		jwks := []map[string]string{encodeJWK("rsa", &keys.rsa.PublicKey)}
+		if rotated.Load() {
+			jwks = append(jwks, encodeJWK("ecdsa", &keys.ecdsa.PublicKey))
+		}
+
+		_, _ = w.Write(encodeJWKS(t, jwks...))
+	}))
+	defer server.Close()
+
+	remote := ahttp.NewRemoteJWKS(server.URL, ahttp.RemoteJWKSConfig{
+		RefreshInterval:    time.Hour,
+		MinRefreshInterval: 50 * time.Millisecond,
+	})
+
+	// Fetched on first use, then cached.
+	_, err := remote.Key(context.Background(), "rsa")
+	require.NoError(t, err)
+	_, err = remote.Key(context.Background(), "rsa")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), fetches.Load())
+
+	// Unknown keys do not refresh the set too often.
+	_, err = remote.Key(context.Background(), "ecdsa")
+	require.ErrorIs(t, err, ahttp.ErrUnknownKey)
+	require.Equal(t, int64(1), fetches.Load())
+
+	rotated.Store(true)
+	time.Sleep(60 * time.Millisecond)
+
+	key, err := remote.Key(context.Background(), "ecdsa")
+	require.NoError(t, err)
+	require.Equal(t, "ecdsa", key.KeyID)
+	require.Equal(t, int64(2), fetches.Load())
+
+	// The last keys are kept when a refresh fails.
+	down.Store(true)
+	time.Sleep(60 * time.Millisecond)
+
+	_, err = remote.Key(context.Background(), "foo")
+	require.ErrorIs(t, err, ahttp.ErrUnknownKey)
+	require.Equal(t, int64(3), fetches.Load())
+
+	_, err = remote.Key(context.Background(), "rsa")
+	require.NoError(t, err)
+}
+
+func TestRemoteJWKSSlowFetch(t *testing.T) {
+	keys := newJWTTestKeys(t)
+
+	var blocked atomic.Bool
+
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if blocked.Load() {
+			<-release
+		}
+
+		_, _ = w.Write(encodeJWKS(t, encodeJWK("rsa", &keys.rsa.PublicKey)))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	remote := ahttp.NewRemoteJWKS(server.URL, ahttp.RemoteJWKSConfig{
+		RefreshInterval:    50 * time.Millisecond,
+		MinRefreshInterval: 50 * time.Millisecond,
+	})
+
+	// A request that gives up does not prevent the next ones from getting the keys.
+	blocked.Store(true)
+
+	canceledCtx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := remote.Key(canceledCtx, "rsa")
+	require.ErrorIs(t, err, ahttp.ErrJWKSUnavailable)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	blocked.Store(false)
+	release <- struct{}{}
+
+	key, err := remote.Key(context.Background(), "rsa")
+	require.NoError(t, err)
+	require.Equal(t, "rsa", key.KeyID)
+
+	// Expired keys are served while a slow refresh is in flight.
+	blocked.Store(true)
+	time.Sleep(60 * time.Millisecond)
+
+	for range 3 {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+
+		key, err = remote.Key(ctx, "rsa")
+		require.NoError(t, err)
+		require.Equal(t, "rsa", key.KeyID)
+
+		cancel()
+	}
+}
+
+func TestRemoteJWKSTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"keys":[],"padding":"`))
+		_, _ = w.Write(bytes.Repeat([]byte("a"), 2<<20))
+		_, _ = w.Write([]byte(`"}`))
+	}))
+	defer server.Close()
+
+	_, err := ahttp.NewRemoteJWKS(server.URL, ahttp.RemoteJWKSConfig{}).Key(context.Background(), "rsa")
+	require.ErrorIs(t, err, ahttp.ErrJWKSUnavailable)
+	require.ErrorContains(t, err, "exceeds")
+}
+
+func TestRemoteJWKSUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	keys := newJWTTestKeys(t)
+	verifier := ahttp.NewJWTVerifier(ahttp.JWTConfig{Keys: ahttp.NewRemoteJWKS(server.URL, ahttp.RemoteJWKSConfig{})})
+
+	var handlerErrors []error
+
+	router := gin.New()
+	router.Use(func(ctx *gin.Context) {
+		ctx.Next()
+
+		for _, err := range ctx.Errors {
+			handlerErrors = append(handlerErrors, err.Err)
+		}
+	})
+	router.GET("/foo", verifier.Middleware(), func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	token := signJWT(t, ahttp.JWTAlgorithmRS256, "rsa", keys.rsa, map[string]any{
+		"sub": "alice",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/foo", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Empty(t, w.Header().Get("WWW-Authenticate"))
+
+	// The fetch error is reported, but not sent to the client.
+	require.JSONEq(
+		t, `{"title":"Service Unavailable","status":503,"detail":"jwks unavailable","code":"Unavailable"}`,
+		w.Body.String(),
+	)
+	require.Len(t, handlerErrors, 2)
+	require.ErrorIs(t, handlerErrors[1], ahttp.ErrJWKSUnavailable)
+	require.ErrorContains(t, handlerErrors[1], "unexpected status 500")
+}
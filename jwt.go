@@ -0,0 +1,309 @@
+package ahttp
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Signature algorithms supported by JWTVerifier.
+const (
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmES256 = "ES256"
+	JWTAlgorithmEdDSA = "EdDSA"
+)
+
+const DefaultJWTClockSkew = time.Minute
+
+var (
+	ErrMissingToken         = errors.New("missing bearer token")
+	ErrMalformedToken       = errors.New("malformed token")
+	ErrUnsupportedAlgorithm = errors.New("unsupported algorithm")
+	ErrInvalidSignature     = errors.New("invalid signature")
+	ErrTokenExpired         = errors.New("token expired")
+	ErrTokenNotYetValid     = errors.New("token not yet valid")
+	ErrInvalidIssuer        = errors.New("invalid issuer")
+	ErrInvalidAudience      = errors.New("invalid audience")
+)
+
+type JWTConfig struct {
+	// Keys verify the signatures of tokens. See JWKS and RemoteJWKS.
+	Keys JWKSource
+	// Algorithms are the accepted signature algorithms. Defaults to RS256, ES256 and EdDSA.
+	Algorithms []string
+
+	// Issuer is the expected "iss" claim, if set.
+	Issuer string
+	// Audience must be one of the "aud" claims, if set.
+	Audience string
+	// ClockSkew tolerates differences between the clocks of the issuer and of the server, when checking the
+	// "exp" and "nbf" claims. Defaults to DefaultJWTClockSkew.
+	ClockSkew time.Duration
+
+	// Realm is the realm of the WWW-Authenticate header.
+	Realm string
+	// Optional lets requests without an Authorization header through, without a principal.
+	Optional bool
+}
+
+// JWTVerifier authenticates requests with JWT bearer tokens.
+type JWTVerifier struct {
+	config JWTConfig
+}
+
+func NewJWTVerifier(config JWTConfig) *JWTVerifier {
+	if config.Algorithms == nil {
+		config.Algorithms = []string{JWTAlgorithmRS256, JWTAlgorithmES256, JWTAlgorithmEdDSA}
+	}
+
+	if config.ClockSkew <= 0 {
+		config.ClockSkew = DefaultJWTClockSkew
+	}
+
+	return &JWTVerifier{config: config}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+func decodeJWTSegment(segment string, dst any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	return decoder.Decode(dst)
+}
+
+func verifySignature(algorithm string, key crypto.PublicKey, signed, signature []byte) bool {
+	digest := sha256.Sum256(signed)
+
+	switch algorithm {
+	case JWTAlgorithmRS256:
+		publicKey, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) == nil
+	case JWTAlgorithmES256:
+		publicKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || publicKey.Curve != elliptic.P256() || len(signature) != 64 {
+			return false
+		}
+
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+
+		return ecdsa.Verify(publicKey, digest[:], r, s)
+	case JWTAlgorithmEdDSA:
+		publicKey, ok := key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(publicKey, signed, signature)
+	default:
+		return false
+	}
+}
+
+// maxNumericDate is the last second of year 9999, as a NumericDate.
+const maxNumericDate = 253402300799
+
+// numericClaim returns a NumericDate claim, and whether it is set.
+func numericClaim(claims map[string]any, name string) (time.Time, bool, error) {
+	value, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+
+	number, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("%w: %s is not a number", ErrMalformedToken, name)
+	}
+
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("%w: %s: %w", ErrMalformedToken, name, err)
+	}
+
+	// Also rejects NaN, and dates that time.Time cannot compare reliably.
+	if !(seconds >= -maxNumericDate && seconds <= maxNumericDate) {
+		return time.Time{}, false, fmt.Errorf("%w: %s is out of range", ErrMalformedToken, name)
+	}
+
+	whole, fraction := math.Modf(seconds)
+
+	return time.Unix(int64(whole), int64(fraction*float64(time.Second))), true, nil
+}
+
+// stringsClaim returns a claim that is either a string or an array of strings.
+func stringsClaim(claims map[string]any, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []any:
+		values := make([]string, 0, len(value))
+
+		for _, item := range value {
+			if str, ok := item.(string); ok {
+				values = append(values, str)
+			}
+		}
+
+		return values
+	default:
+		return nil
+	}
+}
+
+// principalFromClaims reads the scopes of the "scope" claim, or of the "scp" claim used by some issuers.
+func principalFromClaims(claims map[string]any) *Principal {
+	principal := &Principal{Claims: claims}
+	principal.Subject, _ = claims["sub"].(string)
+
+	if scope, ok := claims["scope"].(string); ok {
+		principal.Scopes = strings.Fields(scope)
+	} else {
+		principal.Scopes = stringsClaim(claims, "scp")
+	}
+
+	return principal
+}
+
+func (verifier *JWTVerifier) checkClaims(claims map[string]any, now time.Time) error {
+	expiresAt, ok, err := numericClaim(claims, "exp")
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return fmt.Errorf("%w: missing exp", ErrMalformedToken)
+	}
+
+	if now.After(expiresAt.Add(verifier.config.ClockSkew)) {
+		return ErrTokenExpired
+	}
+
+	notBefore, ok, err := numericClaim(claims, "nbf")
+	if err != nil {
+		return err
+	}
+
+	if ok && now.Before(notBefore.Add(-verifier.config.ClockSkew)) {
+		return ErrTokenNotYetValid
+	}
+
+	if issuer := verifier.config.Issuer; issuer != "" && claims["iss"] != issuer {
+		return ErrInvalidIssuer
+	}
+
+	if audience := verifier.config.Audience; audience != "" && !slices.Contains(stringsClaim(claims, "aud"), audience) {
+		return ErrInvalidAudience
+	}
+
+	return nil
+}
+
+// Verify checks the signature and the claims of a token, and returns its principal. Errors fetching the keys
+// are returned as is, other errors wrap one of the Err* variables of the package.
+func (verifier *JWTVerifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	var header jwtHeader
+	if err := decodeJWTSegment(segments[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %w", ErrMalformedToken, err)
+	}
+
+	if !slices.Contains(verifier.config.Algorithms, header.Alg) {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, header.Alg)
+	}
+
+	key, err := verifier.config.Keys.Key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.Algorithm != "" && key.Algorithm != header.Alg {
+		return nil, fmt.Errorf("%w: key %q is restricted to %s", ErrUnsupportedAlgorithm, key.KeyID, key.Algorithm)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(segments[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %w", ErrMalformedToken, err)
+	}
+
+	if !verifySignature(header.Alg, key.Key, []byte(segments[0]+"."+segments[1]), signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	var claims map[string]any
+	if err := decodeJWTSegment(segments[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %w", ErrMalformedToken, err)
+	}
+
+	if err := verifier.checkClaims(claims, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return principalFromClaims(claims), nil
+}
+
+// Middleware authenticates requests with the bearer token of their Authorization header. The principal of the
+// token is stored in gin, under PrincipalKey, and in the request context (see PrincipalFromContext).
+//
+// Invalid tokens are rejected with a 401 status, and a WWW-Authenticate header that describes the error. A
+// 503 status is returned when the keys cannot be fetched.
+func (verifier *JWTVerifier) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token, present := bearerToken(ctx)
+		if !present && verifier.config.Optional {
+			ctx.Next()
+			return
+		}
+
+		if !present {
+			abortUnauthenticated(ctx, verifier.config.Realm, "", ErrMissingToken)
+			return
+		}
+
+		if token == "" {
+			abortUnauthenticated(ctx, verifier.config.Realm, AuthErrorInvalidRequest, ErrMalformedToken)
+			return
+		}
+
+		principal, err := verifier.Verify(ctx.Request.Context(), token)
+		if errors.Is(err, ErrJWKSUnavailable) {
+			HandleGRPCErrorProblem(ctx, status.Error(codes.Unavailable, ErrJWKSUnavailable.Error()))
+			_ = ctx.Error(err)
+
+			return
+		}
+
+		if err != nil {
+			abortUnauthenticated(ctx, verifier.config.Realm, AuthErrorInvalidToken, err)
+			return
+		}
+
+		setPrincipal(ctx, principal)
+		ctx.Next()
+	}
+}
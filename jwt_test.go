@@ -0,0 +1,398 @@
+package ahttp_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a-novel-kit/quicklog"
+	quicklogmocks "github.com/a-novel-kit/quicklog/mocks"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+type jwtTestKeys struct {
+	rsa     *rsa.PrivateKey
+	ecdsa   *ecdsa.PrivateKey
+	ed25519 ed25519.PrivateKey
+}
+
+func newJWTTestKeys(t *testing.T) *jwtTestKeys {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	return &jwtTestKeys{rsa: rsaKey, ecdsa: ecdsaKey, ed25519: ed25519Key}
+}
+
+func (keys *jwtTestKeys) jwks() *ahttp.JWKS {
+	return &ahttp.JWKS{Keys: []*ahttp.JWK{
+		{KeyID: "rsa", Key: &keys.rsa.PublicKey},
+		{KeyID: "ecdsa", Key: &keys.ecdsa.PublicKey},
+		{KeyID: "ed25519", Algorithm: ahttp.JWTAlgorithmEdDSA, Key: keys.ed25519.Public()},
+	}}
+}
+
+func signJWT(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	t.Helper()
+
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		require.NoError(t, err)
+
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, []byte(signed))
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTVerifierMiddleware(t *testing.T) {
+	keys := newJWTTestKeys(t)
+	otherKeys := newJWTTestKeys(t)
+
+	now := time.Now()
+
+	validClaims := func(overrides map[string]any) map[string]any {
+		claims := map[string]any{
+			"sub":   "alice",
+			"iss":   "https://issuer.example",
+			"aud":   "api",
+			"exp":   now.Add(time.Hour).Unix(),
+			"scope": "read write",
+		}
+
+		for key, value := range overrides {
+			if value == nil {
+				delete(claims, key)
+			} else {
+				claims[key] = value
+			}
+		}
+
+		return claims
+	}
+
+	testCases := []struct {
+		name string
+
+		config        ahttp.JWTConfig
+		authorization string
+
+		expectCode      int
+		expectBody      string
+		expectChallenge string
+	}{
+		{
+			name: "RS256",
+
+			authorization: "Bearer " + signJWT(t, ahttp.JWTAlgorithmRS256, "rsa", keys.rsa, validClaims(nil)),
+
+			expectCode: http.StatusOK,
+			expectBody: "alice [read write]",
+		},
+		{
+			name: "ES256",
+
+			authorization: "Bearer " + signJWT(t, ahttp.JWTAlgorithmES256, "ecdsa", keys.ecdsa, validClaims(nil)),
+
+			expectCode: http.StatusOK,
+			expectBody: "alice [read write]",
+		},
+		{
+			name: "EdDSA",
+
+			authorization: "Bearer " + signJWT(t, ahttp.JWTAlgorithmEdDSA, "ed25519", keys.ed25519, validClaims(nil)),
+
+			expectCode: http.StatusOK,
+			expectBody: "alice [read write]",
+		},
+		{
+			name: "AudienceArray",
+
+			authorization: "Bearer " + signJWT(t, ahttp.JWTAlgorithmRS256, "rsa", keys.rsa, validClaims(map[string]any{
+				"aud": []string{"other", "api"},
+				"scp": []string{"read"},
+				// "scope" takes precedence over "scp".
+				"scope": nil,
+			})),
+
+			expectCode: http.StatusOK,
+			expectBody: "alice [read]",
+		},
+		{
+			name: "ExpiredWithinSkew",
+
+			authorization: "Bearer " + signJWT(t, ahttp.JWTAlgorithmRS256, "rsa", keys.rsa, validClaims(map[string]any{
+				"exp": now.Add(-30 * time.Second).Unix(),
+			})),
+
+			expectCode: http.StatusOK,
+			expectBody: "alice [read write]",
+		},
+		{
+			name: "Optional",
+
+			config: ahttp.JWTConfig{Optional: true},
+
+			expectCode: http.StatusOK,
+			expectBody: "anonymous",
+		},
+		{
+			name: "MissingToken",
+
+			expectCode:      http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api"`,
+		},
+		{
+			name: "OtherScheme",
+
+			authorization: "Basic Zm9vOmJhcg==",
+
+			expectCode:      http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api", error="invalid_request", error_description="malformed token"`,
+		},
+		{
+			name: "Expired",
+
+			authorization: "Bearer " + signJWT(t, ahttp.JWTAlgorithmRS256, "rsa", keys.rsa, validClaims(map[string]any{
+				"exp": now.Add(-2 * time.Minute).Unix(),
+			})),
+
+			expectCode:      http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api", error="invalid_token", error_description="token expired"`,
+		},
+		{
+			name: "MissingExpiration",
+
+			authorization: "Bearer " + signJWT(t, ahttp.JWTAlgorithmRS256, "rsa", keys.rsa, validClaims(map[string]any{
+				"exp": nil,
+			})),
+
+			expectCode:      http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api", error="invalid_token", error_description="malformed token: missing exp"`,
+		},
+		{
+			name: "NotYetValid",
+
+			authorization: "Bearer " + signJWT(t, ahttp.JWTAlgorithmRS256, "rsa", keys.rsa, validClaims(map[string]any{
+				"nbf": now.Add(2 * time.Minute).Unix(),
+			})),
+
+			expectCode:      http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api", error="invalid_token", error_description="token not yet valid"`,
+		},
+		{
+			name: "NotYetValid/Overflow",
+
+			authorization: "Bearer " + signJWT(t, ahttp.JWTAlgorithmRS256, "rsa", keys.rsa, validClaims(map[string]any{
+				"nbf": 1e13,
+			})),
+
+			expectCode: http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api", error="invalid_token", ` +
+				`error_description="malformed token: nbf is out of range"`,
+		},
+		{
+			name: "Expired/Overflow",
+
+			authorization: "Bearer " + signJWT(t, ahttp.JWTAlgorithmRS256, "rsa", keys.rsa, validClaims(map[string]any{
+				"exp": -1e300,
+			})),
+
+			expectCode: http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api", error="invalid_token", ` +
+				`error_description="malformed token: exp is out of range"`,
+		},
+		{
+			name: "WrongIssuer",
+
+			authorization: "Bearer " + signJWT(t, ahttp.JWTAlgorithmRS256, "rsa", keys.rsa, validClaims(map[string]any{
+				"iss": "https://evil.example",
+			})),
+
+			expectCode:      http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api", error="invalid_token", error_description="invalid issuer"`,
+		},
+		{
+			name: "WrongAudience",
+
+			authorization: "Bearer " + signJWT(t, ahttp.JWTAlgorithmRS256, "rsa", keys.rsa, validClaims(map[string]any{
+				"aud": "other",
+			})),
+
+			expectCode:      http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api", error="invalid_token", error_description="invalid audience"`,
+		},
+		{
+			name: "WrongKey",
+
+			authorization: "Bearer " + signJWT(t, ahttp.JWTAlgorithmRS256, "rsa", otherKeys.rsa, validClaims(nil)),
+
+			expectCode:      http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api", error="invalid_token", error_description="invalid signature"`,
+		},
+		{
+			name: "KeyTypeMismatch",
+
+			authorization: "Bearer " + signJWT(t, ahttp.JWTAlgorithmES256, "rsa", keys.ecdsa, validClaims(nil)),
+
+			expectCode:      http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api", error="invalid_token", error_description="invalid signature"`,
+		},
+		{
+			name: "KeyAlgorithmMismatch",
+
+			authorization: "Bearer " + signJWT(t, ahttp.JWTAlgorithmES256, "ed25519", keys.ecdsa, validClaims(nil)),
+
+			expectCode: http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api", error="invalid_token", ` +
+				`error_description="unsupported algorithm: key \"ed25519\" is restricted to EdDSA"`,
+		},
+		{
+			name: "UnknownKey",
+
+			authorization: "Bearer " + signJWT(t, ahttp.JWTAlgorithmRS256, "foo", keys.rsa, validClaims(nil)),
+
+			expectCode:      http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api", error="invalid_token", error_description="unknown signing key: \"foo\""`,
+		},
+		{
+			name: "AlgorithmNone",
+
+			authorization: "Bearer " + base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." +
+				base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"alice"}`)) + ".",
+
+			expectCode:      http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api", error="invalid_token", error_description="unsupported algorithm: \"none\""`,
+		},
+		{
+			name: "AlgorithmNotAllowed",
+
+			config:        ahttp.JWTConfig{Algorithms: []string{ahttp.JWTAlgorithmEdDSA}},
+			authorization: "Bearer " + signJWT(t, ahttp.JWTAlgorithmRS256, "rsa", keys.rsa, validClaims(nil)),
+
+			expectCode:      http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api", error="invalid_token", error_description="unsupported algorithm: \"RS256\""`,
+		},
+		{
+			name: "Malformed",
+
+			authorization: "Bearer foo.bar",
+
+			expectCode:      http.StatusUnauthorized,
+			expectChallenge: `Bearer realm="api", error="invalid_token", error_description="malformed token"`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			config := testCase.config
+			config.Keys = keys.jwks()
+			config.Issuer = "https://issuer.example"
+			config.Audience = "api"
+			config.Realm = "api"
+
+			router := gin.New()
+			router.GET("/foo", ahttp.NewJWTVerifier(config).Middleware(), func(ctx *gin.Context) {
+				principal, ok := ahttp.PrincipalFromContext(ctx.Request.Context())
+				if !ok {
+					ctx.String(http.StatusOK, "anonymous")
+					return
+				}
+
+				require.Equal(t, principal, ctx.MustGet(ahttp.PrincipalKey))
+				ctx.String(http.StatusOK, "%s %v", principal.Subject, principal.Scopes)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/foo", nil)
+			if testCase.authorization != "" {
+				req.Header.Set("Authorization", testCase.authorization)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, testCase.expectCode, w.Code)
+			require.Equal(t, testCase.expectChallenge, w.Header().Get("WWW-Authenticate"))
+
+			if testCase.expectBody != "" {
+				require.Equal(t, testCase.expectBody, w.Body.String())
+			} else {
+				require.Equal(t, ahttp.ContentTypeProblem, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestJWTVerifierMiddlewareReport(t *testing.T) {
+	keys := newJWTTestKeys(t)
+
+	logger := quicklogmocks.NewMockLogger(t)
+	logger.
+		On("Log", quicklog.LevelInfo, mock.Anything).
+		Run(func(args mock.Arguments) {
+			report := args.Get(1).(quicklog.Message).RenderJSON()
+			require.Equal(t, "alice", report["subject"])
+		}).
+		Once()
+
+	router := gin.New()
+	router.Use(ahttp.ReportMiddleware(logger, ""))
+	router.GET("/foo", ahttp.NewJWTVerifier(ahttp.JWTConfig{Keys: keys.jwks()}).Middleware(), func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	token := signJWT(t, ahttp.JWTAlgorithmEdDSA, "ed25519", keys.ed25519, map[string]any{
+		"sub": "alice",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/foo", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	logger.AssertExpectations(t)
+}
@@ -0,0 +1,62 @@
+package ahttp
+
+import (
+	"container/list"
+	"sync"
+)
+
+type lruEntry[V any] struct {
+	key   string
+	value V
+}
+
+// lruCache is an in-memory map that evicts its least recently used entries once it is full.
+type lruCache[V any] struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+}
+
+func newLRUCache[V any](maxEntries int) *lruCache[V] {
+	return &lruCache[V]{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (cache *lruCache[V]) get(key string) (V, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	element, ok := cache.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+
+	cache.order.MoveToFront(element)
+
+	return element.Value.(*lruEntry[V]).value, true
+}
+
+func (cache *lruCache[V]) set(key string, value V) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if element, ok := cache.entries[key]; ok {
+		element.Value.(*lruEntry[V]).value = value
+		cache.order.MoveToFront(element)
+
+		return
+	}
+
+	cache.entries[key] = cache.order.PushFront(&lruEntry[V]{key: key, value: value})
+
+	for cache.order.Len() > cache.maxEntries {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*lruEntry[V]).key)
+	}
+}
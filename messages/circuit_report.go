@@ -0,0 +1,106 @@
+package ahttpmessages
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/a-novel-kit/quicklog"
+)
+
+// States of a circuit breaker, as reported in transitions.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+type CircuitTransition struct {
+	// Key identifies the circuit, usually an upstream or a method.
+	Key  string
+	From string
+	To   string
+
+	// Requests and Failures are the counts that led to the transition.
+	Requests int
+	Failures int
+	// Cooldown is the time the circuit stays open. It is only set when the circuit opens.
+	Cooldown time.Duration
+}
+
+type circuitTransitionMessage struct {
+	transition *CircuitTransition
+
+	quicklog.Message
+}
+
+func (report *circuitTransitionMessage) RenderTerminal() string {
+	color := lipgloss.Color("33")
+	prefix := "🟢 "
+
+	switch report.transition.To {
+	case CircuitOpen:
+		color = "9"
+		prefix = "🔴 "
+	case CircuitHalfOpen:
+		color = "220"
+		prefix = "🟡 "
+	}
+
+	detailsMessage := ""
+	if report.transition.Requests > 0 {
+		detailsMessage += fmt.Sprintf(" · %d/%d failed", report.transition.Failures, report.transition.Requests)
+	}
+
+	if report.transition.Cooldown > 0 {
+		detailsMessage += fmt.Sprintf(" · cooldown %s", report.transition.Cooldown)
+	}
+
+	return lipgloss.NewStyle().
+		Foreground(color).
+		Bold(true).
+		Render(prefix+"circuit "+report.transition.To) +
+		lipgloss.NewStyle().
+			Foreground(color).
+			Render(fmt.Sprintf(" [%s]", report.transition.Key)) +
+		lipgloss.NewStyle().Faint(true).Render(fmt.Sprintf(" (from %s)", report.transition.From)) +
+		lipgloss.NewStyle().Foreground(lipgloss.Color("220")).Render(detailsMessage) +
+		"\n\n"
+}
+
+func (report *circuitTransitionMessage) RenderJSON() map[string]interface{} {
+	circuit := map[string]interface{}{
+		"key":      report.transition.Key,
+		"from":     report.transition.From,
+		"to":       report.transition.To,
+		"requests": report.transition.Requests,
+		"failures": report.transition.Failures,
+	}
+
+	if report.transition.Cooldown > 0 {
+		circuit["cooldown"] = report.transition.Cooldown.String()
+	}
+
+	return map[string]interface{}{
+		"circuitBreaker": circuit,
+		"severity":       string(CircuitTransitionLevel(report.transition)),
+	}
+}
+
+// CircuitTransitionLevel returns the level a circuit transition should be logged with. Opening a circuit is
+// reported as an error, since requests to the upstream are rejected until it recovers.
+func CircuitTransitionLevel(transition *CircuitTransition) quicklog.Level {
+	switch transition.To {
+	case CircuitOpen:
+		return quicklog.LevelError
+	case CircuitHalfOpen:
+		return quicklog.LevelWarning
+	default:
+		return quicklog.LevelInfo
+	}
+}
+
+func NewCircuitTransition(transition *CircuitTransition) quicklog.Message {
+	return &circuitTransitionMessage{transition: transition}
+}
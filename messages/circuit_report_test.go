@@ -0,0 +1,105 @@
+package ahttpmessages_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/a-novel-kit/quicklog"
+
+	ahttpmessages "github.com/a-novel-kit/ahttp/messages"
+)
+
+func TestCircuitTransition(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		transition *ahttpmessages.CircuitTransition
+
+		expect      string
+		expectJSON  map[string]interface{}
+		expectLevel quicklog.Level
+	}{
+		{
+			name: "Open",
+
+			transition: &ahttpmessages.CircuitTransition{
+				Key:      "api.example.com",
+				From:     ahttpmessages.CircuitClosed,
+				To:       ahttpmessages.CircuitOpen,
+				Requests: 10,
+				Failures: 6,
+				Cooldown: 30 * time.Second,
+			},
+
+			expect: "🔴 circuit open [api.example.com] (from closed) · 6/10 failed · cooldown 30s\n\n",
+			expectJSON: map[string]interface{}{
+				"circuitBreaker": map[string]interface{}{
+					"key":      "api.example.com",
+					"from":     "closed",
+					"to":       "open",
+					"requests": 10,
+					"failures": 6,
+					"cooldown": "30s",
+				},
+				"severity": "ERROR",
+			},
+			expectLevel: quicklog.LevelError,
+		},
+		{
+			name: "HalfOpen",
+
+			transition: &ahttpmessages.CircuitTransition{
+				Key:  "api.example.com",
+				From: ahttpmessages.CircuitOpen,
+				To:   ahttpmessages.CircuitHalfOpen,
+			},
+
+			expect: "🟡 circuit half-open [api.example.com] (from open)\n\n",
+			expectJSON: map[string]interface{}{
+				"circuitBreaker": map[string]interface{}{
+					"key":      "api.example.com",
+					"from":     "open",
+					"to":       "half-open",
+					"requests": 0,
+					"failures": 0,
+				},
+				"severity": "WARNING",
+			},
+			expectLevel: quicklog.LevelWarning,
+		},
+		{
+			name: "Closed",
+
+			transition: &ahttpmessages.CircuitTransition{
+				Key:      "/foo.Bar/Baz",
+				From:     ahttpmessages.CircuitHalfOpen,
+				To:       ahttpmessages.CircuitClosed,
+				Requests: 1,
+			},
+
+			expect: "🟢 circuit closed [/foo.Bar/Baz] (from half-open) · 0/1 failed\n\n",
+			expectJSON: map[string]interface{}{
+				"circuitBreaker": map[string]interface{}{
+					"key":      "/foo.Bar/Baz",
+					"from":     "half-open",
+					"to":       "closed",
+					"requests": 1,
+					"failures": 0,
+				},
+				"severity": "INFO",
+			},
+			expectLevel: quicklog.LevelInfo,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			report := ahttpmessages.NewCircuitTransition(testCase.transition)
+			require.Equal(t, testCase.expect, report.RenderTerminal())
+			require.Equal(t, testCase.expectJSON, report.RenderJSON())
+			require.Equal(t, testCase.expectLevel, ahttpmessages.CircuitTransitionLevel(testCase.transition))
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package ahttpmessages
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/a-novel-kit/quicklog"
+)
+
+type GRPCMetrics struct {
+	Latency   time.Duration
+	StartedAt time.Time
+
+	// RequestSize and ResponseSize are the total sizes of the messages received and sent, in bytes.
+	RequestSize  int64
+	ResponseSize int64
+
+	// Stream is set for streaming calls.
+	Stream *GRPCStreamMetrics
+}
+
+type GRPCStreamMetrics struct {
+	MessagesIn  int64
+	MessagesOut int64
+}
+
+type GRPCRequest struct {
+	Method string
+	// Peer is the address of the client.
+	Peer     string
+	Metadata metadata.MD
+
+	Code codes.Code
+	// HTTPStatus is the HTTP equivalent of Code. It drives the severity of the report, so gRPC and HTTP reports
+	// share the same level policy.
+	HTTPStatus int
+	Err        error
+}
+
+type grpcReportMessage struct {
+	metrics   *GRPCMetrics
+	projectID string
+	request   *GRPCRequest
+
+	quicklog.Message
+}
+
+func (report *grpcReportMessage) getMetadata(key string) string {
+	if values := report.request.Metadata.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+func (report *grpcReportMessage) tags() []string {
+	if report.metrics == nil {
+		return nil
+	}
+
+	tags := []string{
+		fmt.Sprintf("%d B in", report.metrics.RequestSize),
+		fmt.Sprintf("%d B out", report.metrics.ResponseSize),
+	}
+
+	if stream := report.metrics.Stream; stream != nil {
+		tags = append(
+			tags,
+			fmt.Sprintf("%d msgs in", stream.MessagesIn),
+			fmt.Sprintf("%d msgs out", stream.MessagesOut),
+		)
+	}
+
+	return tags
+}
+
+func (report *grpcReportMessage) RenderTerminal() string {
+	errorMessage := ""
+	if report.request.Err != nil {
+		errorMessage = "\n" + lipgloss.NewStyle().
+			MarginLeft(2).
+			Foreground(lipgloss.Color("9")).
+			Render("- "+report.request.Err.Error())
+	}
+
+	latencyMessage := ""
+	if report.metrics != nil {
+		latencyMessage = lipgloss.NewStyle().Faint(true).Render(fmt.Sprintf(" (%s)", report.metrics.Latency))
+	}
+
+	tagsMessage := ""
+	for _, tag := range report.tags() {
+		tagsMessage += lipgloss.NewStyle().Foreground(lipgloss.Color("220")).Render(" · " + tag)
+	}
+
+	color := lipgloss.Color("33")
+	prefix := "✅ "
+
+	if report.request.HTTPStatus > 499 {
+		color = "9"
+		prefix = "👶🔪🩸 "
+	} else if report.request.HTTPStatus > 399 {
+		color = "202"
+		prefix = "⚠ "
+	}
+
+	return lipgloss.NewStyle().
+		Foreground(color).
+		Bold(true).
+		Render(prefix+report.request.Code.String()) +
+		lipgloss.NewStyle().
+			Foreground(color).
+			Render(fmt.Sprintf(" [%s]", report.request.Method)) +
+		latencyMessage +
+		tagsMessage +
+		errorMessage +
+		"\n\n"
+}
+
+func (report *grpcReportMessage) RenderJSON() map[string]interface{} {
+	remoteIP := report.request.Peer
+	if host, _, err := net.SplitHostPort(remoteIP); err == nil {
+		remoteIP = host
+	}
+
+	// gRPC calls are reported as HTTP requests, so they show up next to HTTP reports in Cloud Logging.
+	httpRequest := map[string]interface{}{
+		"requestMethod": "POST",
+		"requestUrl":    report.request.Method,
+		"status":        report.request.HTTPStatus,
+		"userAgent":     report.getMetadata("user-agent"),
+		"remoteIp":      remoteIP,
+		"protocol":      "gRPC",
+	}
+
+	grpcRequest := map[string]interface{}{
+		"method": report.request.Method,
+		"code":   report.request.Code.String(),
+		"peer":   report.request.Peer,
+	}
+
+	var errs []string
+	if report.request.Err != nil {
+		errs = []string{report.request.Err.Error()}
+	}
+
+	output := map[string]interface{}{
+		"httpRequest": httpRequest,
+		"grpc":        grpcRequest,
+		"severity":    string(LevelFromStatus(report.request.HTTPStatus)),
+		"ip":          remoteIP,
+		"errors":      errs,
+	}
+
+	if report.metrics != nil {
+		output["start"] = report.metrics.StartedAt
+		httpRequest["latency"] = report.metrics.Latency.String()
+		// Cloud Logging expects sizes as strings.
+		httpRequest["requestSize"] = strconv.FormatInt(report.metrics.RequestSize, 10)
+		httpRequest["responseSize"] = strconv.FormatInt(report.metrics.ResponseSize, 10)
+
+		if stream := report.metrics.Stream; stream != nil {
+			grpcRequest["messagesIn"] = stream.MessagesIn
+			grpcRequest["messagesOut"] = stream.MessagesOut
+		}
+	}
+
+	if trace := traceField(report.projectID, report.getMetadata); trace != "" {
+		output["logging.googleapis.com/trace"] = trace
+	}
+
+	return output
+}
+
+func NewGRPCReport(metrics *GRPCMetrics, projectID string, request *GRPCRequest) quicklog.Message {
+	return &grpcReportMessage{
+		metrics:   metrics,
+		projectID: projectID,
+		request:   request,
+	}
+}
@@ -0,0 +1,206 @@
+package ahttpmessages_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	ahttpmessages "github.com/a-novel-kit/ahttp/messages"
+)
+
+func TestGRPCReport(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		metrics   *ahttpmessages.GRPCMetrics
+		projectID string
+		request   *ahttpmessages.GRPCRequest
+
+		expect     string
+		expectJSON map[string]interface{}
+	}{
+		{
+			name: "SimpleRequest",
+
+			request: &ahttpmessages.GRPCRequest{
+				Method:     "/foo.Bar/Baz",
+				Peer:       "127.0.0.1:1234",
+				Metadata:   metadata.Pairs("user-agent", "grpc-go"),
+				Code:       codes.OK,
+				HTTPStatus: 200,
+			},
+
+			expect: "✅ OK [/foo.Bar/Baz]\n\n",
+			expectJSON: map[string]interface{}{
+				"errors": []string(nil),
+				"grpc": map[string]interface{}{
+					"code":   "OK",
+					"method": "/foo.Bar/Baz",
+					"peer":   "127.0.0.1:1234",
+				},
+				"httpRequest": map[string]interface{}{
+					"protocol":      "gRPC",
+					"remoteIp":      "127.0.0.1",
+					"requestMethod": "POST",
+					"requestUrl":    "/foo.Bar/Baz",
+					"status":        200,
+					"userAgent":     "grpc-go",
+				},
+				"ip":       "127.0.0.1",
+				"severity": "INFO",
+			},
+		},
+		{
+			name: "ClientError",
+
+			request: &ahttpmessages.GRPCRequest{
+				Method:     "/foo.Bar/Baz",
+				Peer:       "127.0.0.1:1234",
+				Code:       codes.NotFound,
+				HTTPStatus: 404,
+				Err:        errors.New("not found"),
+			},
+
+			expect: "⚠ NotFound [/foo.Bar/Baz]\n  - not found\n\n",
+			expectJSON: map[string]interface{}{
+				"errors": []string{"not found"},
+				"grpc": map[string]interface{}{
+					"code":   "NotFound",
+					"method": "/foo.Bar/Baz",
+					"peer":   "127.0.0.1:1234",
+				},
+				"httpRequest": map[string]interface{}{
+					"protocol":      "gRPC",
+					"remoteIp":      "127.0.0.1",
+					"requestMethod": "POST",
+					"requestUrl":    "/foo.Bar/Baz",
+					"status":        404,
+					"userAgent":     "",
+				},
+				"ip":       "127.0.0.1",
+				"severity": "WARNING",
+			},
+		},
+		{
+			name: "ServerError",
+
+			request: &ahttpmessages.GRPCRequest{
+				Method:     "/foo.Bar/Baz",
+				Peer:       "127.0.0.1:1234",
+				Code:       codes.Internal,
+				HTTPStatus: 500,
+			},
+
+			expect: "👶🔪🩸 Internal [/foo.Bar/Baz]\n\n",
+			expectJSON: map[string]interface{}{
+				"errors": []string(nil),
+				"grpc": map[string]interface{}{
+					"code":   "Internal",
+					"method": "/foo.Bar/Baz",
+					"peer":   "127.0.0.1:1234",
+				},
+				"httpRequest": map[string]interface{}{
+					"protocol":      "gRPC",
+					"remoteIp":      "127.0.0.1",
+					"requestMethod": "POST",
+					"requestUrl":    "/foo.Bar/Baz",
+					"status":        500,
+					"userAgent":     "",
+				},
+				"ip":       "127.0.0.1",
+				"severity": "ERROR",
+			},
+		},
+		{
+			name: "WithMetrics",
+
+			metrics: &ahttpmessages.GRPCMetrics{
+				StartedAt:    time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				Latency:      time.Second,
+				RequestSize:  12,
+				ResponseSize: 34,
+				Stream: &ahttpmessages.GRPCStreamMetrics{
+					MessagesIn:  2,
+					MessagesOut: 3,
+				},
+			},
+			request: &ahttpmessages.GRPCRequest{
+				Method:     "/foo.Bar/Baz",
+				Peer:       "127.0.0.1:1234",
+				Code:       codes.OK,
+				HTTPStatus: 200,
+			},
+
+			expect: "✅ OK [/foo.Bar/Baz] (1s) · 12 B in · 34 B out · 2 msgs in · 3 msgs out\n\n",
+			expectJSON: map[string]interface{}{
+				"errors": []string(nil),
+				"grpc": map[string]interface{}{
+					"code":        "OK",
+					"method":      "/foo.Bar/Baz",
+					"peer":        "127.0.0.1:1234",
+					"messagesIn":  int64(2),
+					"messagesOut": int64(3),
+				},
+				"httpRequest": map[string]interface{}{
+					"protocol":      "gRPC",
+					"remoteIp":      "127.0.0.1",
+					"requestMethod": "POST",
+					"requestUrl":    "/foo.Bar/Baz",
+					"status":        200,
+					"userAgent":     "",
+					"latency":       "1s",
+					"requestSize":   "12",
+					"responseSize":  "34",
+				},
+				"ip":       "127.0.0.1",
+				"severity": "INFO",
+				"start":    time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "WithTrace",
+
+			projectID: "cd",
+			request: &ahttpmessages.GRPCRequest{
+				Method:     "/foo.Bar/Baz",
+				Peer:       "127.0.0.1:1234",
+				Metadata:   metadata.Pairs("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"),
+				Code:       codes.OK,
+				HTTPStatus: 200,
+			},
+
+			expect: "✅ OK [/foo.Bar/Baz]\n\n",
+			expectJSON: map[string]interface{}{
+				"errors": []string(nil),
+				"grpc": map[string]interface{}{
+					"code":   "OK",
+					"method": "/foo.Bar/Baz",
+					"peer":   "127.0.0.1:1234",
+				},
+				"httpRequest": map[string]interface{}{
+					"protocol":      "gRPC",
+					"remoteIp":      "127.0.0.1",
+					"requestMethod": "POST",
+					"requestUrl":    "/foo.Bar/Baz",
+					"status":        200,
+					"userAgent":     "",
+				},
+				"ip":                           "127.0.0.1",
+				"severity":                     "INFO",
+				"logging.googleapis.com/trace": "projects/cd/traces/4bf92f3577b34da6a3ce929d0e0e4736",
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			report := ahttpmessages.NewGRPCReport(testCase.metrics, testCase.projectID, testCase.request)
+			require.Equal(t, testCase.expect, report.RenderTerminal())
+			require.Equal(t, testCase.expectJSON, report.RenderJSON())
+		})
+	}
+}
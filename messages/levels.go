@@ -0,0 +1,50 @@
+package ahttpmessages
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/a-novel-kit/quicklog"
+)
+
+// LevelFromStatus returns the level of a report, based on its HTTP status code. gRPC reports use the HTTP
+// equivalent of their code, so both share the same policy.
+func LevelFromStatus(status int) quicklog.Level {
+	if status > 499 {
+		return quicklog.LevelError
+	} else if status > 399 {
+		return quicklog.LevelWarning
+	}
+
+	return quicklog.LevelInfo
+}
+
+// traceID extracts the trace ID of a request, from either the X-Cloud-Trace-Context or the W3C traceparent
+// header.
+func traceID(getHeader func(key string) string) string {
+	if traceParts := strings.Split(getHeader("X-Cloud-Trace-Context"), "/"); len(traceParts[0]) > 0 {
+		return traceParts[0]
+	}
+
+	// version-traceid-parentid-flags
+	if traceParts := strings.Split(getHeader("Traceparent"), "-"); len(traceParts) == 4 {
+		return traceParts[1]
+	}
+
+	return ""
+}
+
+// traceField returns the value of the Cloud Logging trace field of a request, or an empty string if the
+// request is not traced.
+func traceField(projectID string, getHeader func(key string) string) string {
+	if projectID == "" {
+		return ""
+	}
+
+	trace := traceID(getHeader)
+	if trace == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("projects/%s/traces/%s", projectID, trace)
+}
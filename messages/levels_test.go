@@ -0,0 +1,48 @@
+package ahttpmessages_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/a-novel-kit/quicklog"
+
+	ahttpmessages "github.com/a-novel-kit/ahttp/messages"
+)
+
+func TestLevelFromStatus(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		status int
+
+		expect quicklog.Level
+	}{
+		{
+			name:   "Success",
+			status: 200,
+			expect: quicklog.LevelInfo,
+		},
+		{
+			name:   "Redirect",
+			status: 302,
+			expect: quicklog.LevelInfo,
+		},
+		{
+			name:   "ClientError",
+			status: 404,
+			expect: quicklog.LevelWarning,
+		},
+		{
+			name:   "ServerError",
+			status: 503,
+			expect: quicklog.LevelError,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.expect, ahttpmessages.LevelFromStatus(testCase.status))
+		})
+	}
+}
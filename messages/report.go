@@ -2,21 +2,104 @@ package ahttpmessages
 
 import (
 	"fmt"
+	"net/http"
+	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/lipgloss/table"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"github.com/samber/lo"
 
 	"github.com/a-novel-kit/quicklog"
 )
 
+// StatusClientClosedRequest is the status of requests whose client went away. It is not registered, but it is
+// commonly used for this purpose.
+const StatusClientClosedRequest = 499
+
+// Outcomes of a cache lookup.
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+	// CacheStale is set when an expired response was served, because the handler failed.
+	CacheStale = "stale"
+)
+
+// RedactedValue replaces the values of sensitive query parameters in reports.
+const RedactedValue = "REDACTED"
+
 type Metrics struct {
 	Latency   time.Duration
 	StartedAt time.Time
+
+	// HandlerDuration is the time the handler took to return, when it differs from the latency of the response.
+	HandlerDuration time.Duration
+
+	// TimedOut is set when the request deadline fired before the handler completed.
+	TimedOut bool
+	// Throttled is set when the request was rejected by a rate limiter.
+	Throttled bool
+	// BodyLimit is set to the limit of the request body, in bytes, when the request exceeded it.
+	BodyLimit int64
+
+	// ClientClosed is set when the client went away before the request completed. The request is then reported
+	// with a 499 status, regardless of the status written by the handler.
+	ClientClosed bool
+
+	// Shed is set when the request was rejected because the server was overloaded.
+	Shed bool
+	// CORSRejected is the reason a CORS preflight request was rejected, if it was.
+	CORSRejected string
+
+	// WebSocket is set when the request was upgraded to a WebSocket connection.
+	WebSocket *WebSocketMetrics
+
+	// Subject is the authenticated client of the request, if any.
+	Subject string
+	// Authorization is the decision of the authorization policy of the route, if any.
+	Authorization *AuthorizationMetrics
+
+	// Cache is the outcome of the cache lookup, if any.
+	Cache string
+	// Coalesced is set when the request shared the response of an identical request in flight.
+	Coalesced bool
+
+	// Compression is set when the request or the response body was compressed.
+	Compression *CompressionMetrics
+
+	// RedactedQuery are the query parameters whose values are replaced with RedactedValue, such as credentials.
+	RedactedQuery []string
+}
+
+type AuthorizationMetrics struct {
+	Allowed bool
+	// Reason is the reason of a denial.
+	Reason string
+	// MissingScopes are the scopes required by the policy that the principal was not granted.
+	MissingScopes []string
+}
+
+type WebSocketMetrics struct {
+	MessagesIn  int64
+	MessagesOut int64
+	CloseCode   int
+}
+
+// CompressionMetrics holds the sizes of compressed bodies, in bytes. The fields of a direction are empty when
+// its body was not compressed.
+type CompressionMetrics struct {
+	RequestEncoding         string
+	RequestSize             int64
+	UncompressedRequestSize int64
+
+	ResponseEncoding         string
+	ResponseSize             int64
+	UncompressedResponseSize int64
 }
 
 type reportMessage struct {
@@ -27,6 +110,141 @@ type reportMessage struct {
 	quicklog.Message
 }
 
+// status returns the status of the request. The status of a hijacked connection is not tracked by gin, so it
+// is derived from the metrics instead.
+func (report *reportMessage) status() int {
+	if report.metrics != nil && report.metrics.WebSocket != nil {
+		return http.StatusSwitchingProtocols
+	}
+
+	if report.metrics != nil && report.metrics.ClientClosed {
+		return StatusClientClosedRequest
+	}
+
+	return report.ginC.Writer.Status()
+}
+
+func (report *reportMessage) level() quicklog.Level {
+	if report.metrics != nil && report.metrics.WebSocket != nil {
+		switch report.metrics.WebSocket.CloseCode {
+		case websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived:
+			return quicklog.LevelInfo
+		case websocket.CloseInternalServerErr, websocket.CloseServiceRestart, websocket.CloseTryAgainLater:
+			return quicklog.LevelError
+		default:
+			return quicklog.LevelWarning
+		}
+	}
+
+	// Clients going away is not a failure of the server, so it is never reported as an error.
+	if report.metrics != nil && report.metrics.ClientClosed {
+		if report.ginC.Writer.Status() > 399 {
+			return quicklog.LevelWarning
+		}
+
+		return quicklog.LevelInfo
+	}
+
+	return LevelFromStatus(report.status())
+}
+
+// query returns the query of the request, with sensitive values redacted.
+func (report *reportMessage) query() url.Values {
+	query := report.ginC.Request.URL.Query()
+
+	if report.metrics == nil {
+		return query
+	}
+
+	for _, name := range report.metrics.RedactedQuery {
+		if values, ok := query[name]; ok {
+			query[name] = lo.Map(values, func(string, int) string { return RedactedValue })
+		}
+	}
+
+	return query
+}
+
+// tags returns the notable events that occurred while processing the request.
+func (report *reportMessage) tags() []string {
+	if report.metrics == nil {
+		return nil
+	}
+
+	var tags []string
+
+	if report.metrics.TimedOut {
+		tags = append(tags, "timed out")
+	}
+
+	if report.metrics.HandlerDuration > 0 {
+		tags = append(tags, "handler "+report.metrics.HandlerDuration.String())
+	}
+
+	if report.metrics.Throttled {
+		tags = append(tags, "throttled")
+	}
+
+	if report.metrics.Shed {
+		tags = append(tags, "shed")
+	}
+
+	if report.metrics.CORSRejected != "" {
+		tags = append(tags, "cors rejected: "+report.metrics.CORSRejected)
+	}
+
+	if report.metrics.BodyLimit > 0 {
+		tags = append(tags, fmt.Sprintf("body over %d B", report.metrics.BodyLimit))
+	}
+
+	if report.metrics.Subject != "" {
+		tags = append(tags, "sub "+report.metrics.Subject)
+	}
+
+	if authorization := report.metrics.Authorization; authorization != nil {
+		if authorization.Allowed {
+			tags = append(tags, "allowed")
+		} else {
+			tags = append(tags, "denied "+authorization.Reason)
+		}
+	}
+
+	if report.metrics.Cache != "" {
+		tags = append(tags, "cache "+report.metrics.Cache)
+	}
+
+	if report.metrics.Coalesced {
+		tags = append(tags, "coalesced")
+	}
+
+	if compression := report.metrics.Compression; compression != nil {
+		if compression.RequestEncoding != "" {
+			tags = append(tags, fmt.Sprintf(
+				"%s in %d→%d B",
+				compression.RequestEncoding, compression.RequestSize, compression.UncompressedRequestSize,
+			))
+		}
+
+		if compression.ResponseEncoding != "" {
+			tags = append(tags, fmt.Sprintf(
+				"%s out %d→%d B",
+				compression.ResponseEncoding, compression.UncompressedResponseSize, compression.ResponseSize,
+			))
+		}
+	}
+
+	if ws := report.metrics.WebSocket; ws != nil {
+		tags = append(
+			tags,
+			fmt.Sprintf("%d in", ws.MessagesIn),
+			fmt.Sprintf("%d out", ws.MessagesOut),
+			fmt.Sprintf("closed %d", ws.CloseCode),
+		)
+	}
+
+	return tags
+}
+
 func (report *reportMessage) RenderTerminal() string {
 	errorMessage := ""
 	for _, err := range report.ginC.Errors.Errors() {
@@ -38,7 +256,12 @@ func (report *reportMessage) RenderTerminal() string {
 		latencyMessage = lipgloss.NewStyle().Faint(true).Render(fmt.Sprintf(" (%s)", report.metrics.Latency))
 	}
 
-	query := report.ginC.Request.URL.Query()
+	tagsMessage := ""
+	for _, tag := range report.tags() {
+		tagsMessage += lipgloss.NewStyle().Foreground(lipgloss.Color("220")).Render(" · " + tag)
+	}
+
+	query := report.query()
 	queryMessage := ""
 	if len(query) > 0 {
 		queryTable := table.New().
@@ -65,14 +288,22 @@ func (report *reportMessage) RenderTerminal() string {
 		queryMessage = "\n" + queryTable.Render()
 	}
 
-	statusCode := report.ginC.Writer.Status()
+	statusCode := report.status()
 	color := lipgloss.Color("33")
 	prefix := "✅ "
 
-	if statusCode > 499 {
+	if statusCode == http.StatusSwitchingProtocols {
+		prefix = "🔌 "
+	}
+
+	switch {
+	case report.metrics != nil && report.metrics.ClientClosed:
+		color = "245"
+		prefix = "👋 "
+	case statusCode > 499:
 		color = "9"
 		prefix = "👶🔪🩸 "
-	} else if statusCode > 399 {
+	case statusCode > 399:
 		color = "202"
 		prefix = "⚠ "
 	}
@@ -85,20 +316,14 @@ func (report *reportMessage) RenderTerminal() string {
 			Foreground(color).
 			Render(fmt.Sprintf(" [%s %s]", report.ginC.Request.Method, report.ginC.FullPath())) +
 		latencyMessage +
+		tagsMessage +
 		queryMessage +
 		errorMessage +
 		"\n\n"
 }
 
 func (report *reportMessage) RenderJSON() map[string]interface{} {
-	statusCode := report.ginC.Writer.Status()
-
-	severity := "INFO"
-	if statusCode > 499 {
-		severity = "ERROR"
-	} else if statusCode > 399 {
-		severity = "WARNING"
-	}
+	statusCode := report.status()
 
 	httpRequest := map[string]interface{}{
 		"requestMethod": report.ginC.Request.Method,
@@ -111,33 +336,129 @@ func (report *reportMessage) RenderJSON() map[string]interface{} {
 
 	output := map[string]interface{}{
 		"httpRequest": httpRequest,
-		"severity":    severity,
+		"severity":    string(report.level()),
 		"ip":          report.ginC.ClientIP(),
 		"contentType": report.ginC.ContentType(),
 		"errors":      report.ginC.Errors.Errors(),
-		"query":       report.ginC.Request.URL.Query(),
+		"query":       report.query(),
 	}
 
 	if report.metrics != nil {
 		output["start"] = report.metrics.StartedAt
 		httpRequest["latency"] = report.metrics.Latency.String()
+
+		if report.metrics.TimedOut {
+			output["timedOut"] = true
+		}
+
+		if report.metrics.ClientClosed {
+			output["clientClosed"] = true
+			output["handlerStatus"] = report.ginC.Writer.Status()
+		}
+
+		if report.metrics.HandlerDuration > 0 {
+			output["handlerLatency"] = report.metrics.HandlerDuration.String()
+		}
+
+		if report.metrics.Throttled {
+			output["throttled"] = true
+		}
+
+		if report.metrics.Shed {
+			output["shed"] = true
+		}
+
+		if report.metrics.CORSRejected != "" {
+			output["corsRejected"] = report.metrics.CORSRejected
+		}
+
+		if report.metrics.BodyLimit > 0 {
+			output["bodyLimit"] = report.metrics.BodyLimit
+		}
+
+		if report.metrics.Subject != "" {
+			output["subject"] = report.metrics.Subject
+		}
+
+		if authorization := report.metrics.Authorization; authorization != nil {
+			output["authorization"] = authorizationField(authorization)
+		}
+
+		if report.metrics.Cache != "" {
+			httpRequest["cacheLookup"] = true
+			httpRequest["cacheHit"] = report.metrics.Cache != CacheMiss
+			output["cache"] = report.metrics.Cache
+		}
+
+		if report.metrics.Coalesced {
+			output["coalesced"] = true
+		}
+
+		if compression := report.metrics.Compression; compression != nil {
+			output["compression"] = compressionField(compression, httpRequest)
+		}
+
+		if ws := report.metrics.WebSocket; ws != nil {
+			output["websocket"] = map[string]interface{}{
+				"messagesIn":  ws.MessagesIn,
+				"messagesOut": ws.MessagesOut,
+				"closeCode":   ws.CloseCode,
+			}
+		}
+	}
+
+	if trace := traceField(report.projectID, report.ginC.GetHeader); trace != "" {
+		output["logging.googleapis.com/trace"] = trace
 	}
 
-	if report.projectID != "" {
-		traceHeader := report.ginC.GetHeader("X-Cloud-Trace-Context")
-		traceParts := strings.Split(traceHeader, "/")
+	return output
+}
+
+func authorizationField(authorization *AuthorizationMetrics) map[string]interface{} {
+	output := map[string]interface{}{"allowed": authorization.Allowed}
+
+	if authorization.Reason != "" {
+		output["reason"] = authorization.Reason
+	}
+
+	if len(authorization.MissingScopes) > 0 {
+		output["missingScopes"] = authorization.MissingScopes
+	}
+
+	return output
+}
+
+// compressionField renders the compression metrics, and sets the sizes sent over the wire on the httpRequest
+// field.
+func compressionField(compression *CompressionMetrics, httpRequest map[string]interface{}) map[string]interface{} {
+	output := make(map[string]interface{})
+
+	if compression.RequestEncoding != "" {
+		httpRequest["requestSize"] = strconv.FormatInt(compression.RequestSize, 10)
+		output["request"] = map[string]interface{}{
+			"encoding":         compression.RequestEncoding,
+			"size":             compression.RequestSize,
+			"uncompressedSize": compression.UncompressedRequestSize,
+		}
+	}
 
-		if len(traceParts) > 0 && len(traceParts[0]) > 0 {
-			output["logging.googleapis.com/trace"] = fmt.Sprintf(
-				"projects/%s/traces/%s",
-				report.projectID, traceParts[0],
-			)
+	if compression.ResponseEncoding != "" {
+		httpRequest["responseSize"] = strconv.FormatInt(compression.ResponseSize, 10)
+		output["response"] = map[string]interface{}{
+			"encoding":         compression.ResponseEncoding,
+			"size":             compression.ResponseSize,
+			"uncompressedSize": compression.UncompressedResponseSize,
 		}
 	}
 
 	return output
 }
 
+// ReportLevel returns the level a report should be logged with.
+func ReportLevel(metrics *Metrics, ginC *gin.Context) quicklog.Level {
+	return (&reportMessage{metrics: metrics, ginC: ginC}).level()
+}
+
 func NewReport(metrics *Metrics, projectID string, ginC *gin.Context) quicklog.Message {
 	return &reportMessage{
 		metrics:   metrics,
@@ -180,6 +180,620 @@ func TestReport(t *testing.T) {
 				"start":    time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
 			},
 		},
+		{
+			name: "TimedOut",
+
+			metrics: &ahttpmessages.Metrics{
+				StartedAt: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				Latency:   time.Second,
+				TimedOut:  true,
+			},
+			projectID: "",
+			ginC: func() *gin.Context {
+				w := httptest.NewRecorder()
+				ctx, _ := gin.CreateTestContext(w)
+
+				ctx.Request = httptest.NewRequest(http.MethodGet, "/foo", nil)
+				ctx.Request.Header.Set("User-Agent", "Netscape")
+				ctx.Request.Header.Set("X-Real-IP", "127.0.0.1")
+				ctx.Request.Header.Set("Content-Type", "application/json")
+				ctx.Writer.WriteHeader(http.StatusGatewayTimeout)
+
+				_ = testutils.AssignPrivateField[gin.Context, string](ctx, "fullPath", "/foo")
+
+				return ctx
+			},
+
+			expect: "👶🔪🩸 504 [GET /foo] (1s) · timed out\n\n",
+			expectJSON: map[string]interface{}{
+				"contentType": "application/json",
+				"errors":      []string(nil),
+				"httpRequest": map[string]interface{}{
+					"protocol":      "HTTP/1.1",
+					"remoteIp":      "127.0.0.1",
+					"requestMethod": "GET",
+					"requestUrl":    "/foo",
+					"status":        504,
+					"userAgent":     "Netscape",
+					"latency":       "1s",
+				},
+				"ip":       "127.0.0.1",
+				"query":    url.Values{},
+				"severity": "ERROR",
+				"start":    time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				"timedOut": true,
+			},
+		},
+		{
+			name: "TimedOut/HandlerDuration",
+
+			metrics: &ahttpmessages.Metrics{
+				StartedAt: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				Latency:   time.Second,
+				TimedOut:  true,
+
+				HandlerDuration: 3 * time.Second,
+			},
+			projectID: "",
+			ginC: func() *gin.Context {
+				w := httptest.NewRecorder()
+				ctx, _ := gin.CreateTestContext(w)
+
+				ctx.Request = httptest.NewRequest(http.MethodGet, "/foo", nil)
+				ctx.Request.Header.Set("User-Agent", "Netscape")
+				ctx.Request.Header.Set("X-Real-IP", "127.0.0.1")
+				ctx.Request.Header.Set("Content-Type", "application/json")
+				ctx.Writer.WriteHeader(http.StatusGatewayTimeout)
+
+				_ = testutils.AssignPrivateField[gin.Context, string](ctx, "fullPath", "/foo")
+
+				return ctx
+			},
+
+			expect: "👶🔪🩸 504 [GET /foo] (1s) · timed out · handler 3s\n\n",
+			expectJSON: map[string]interface{}{
+				"contentType": "application/json",
+				"errors":      []string(nil),
+				"httpRequest": map[string]interface{}{
+					"protocol":      "HTTP/1.1",
+					"remoteIp":      "127.0.0.1",
+					"requestMethod": "GET",
+					"requestUrl":    "/foo",
+					"status":        504,
+					"userAgent":     "Netscape",
+					"latency":       "1s",
+				},
+				"ip":       "127.0.0.1",
+				"query":    url.Values{},
+				"severity": "ERROR",
+				"start":    time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				"timedOut": true,
+
+				"handlerLatency": "3s",
+			},
+		},
+		{
+			name: "Throttled",
+
+			metrics: &ahttpmessages.Metrics{
+				StartedAt: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				Latency:   time.Second,
+				Throttled: true,
+			},
+			projectID: "",
+			ginC: func() *gin.Context {
+				w := httptest.NewRecorder()
+				ctx, _ := gin.CreateTestContext(w)
+
+				ctx.Request = httptest.NewRequest(http.MethodGet, "/foo", nil)
+				ctx.Request.Header.Set("User-Agent", "Netscape")
+				ctx.Request.Header.Set("X-Real-IP", "127.0.0.1")
+				ctx.Request.Header.Set("Content-Type", "application/json")
+				ctx.Writer.WriteHeader(http.StatusTooManyRequests)
+
+				_ = testutils.AssignPrivateField[gin.Context, string](ctx, "fullPath", "/foo")
+
+				return ctx
+			},
+
+			expect: "⚠ 429 [GET /foo] (1s) · throttled\n\n",
+			expectJSON: map[string]interface{}{
+				"contentType": "application/json",
+				"errors":      []string(nil),
+				"httpRequest": map[string]interface{}{
+					"protocol":      "HTTP/1.1",
+					"remoteIp":      "127.0.0.1",
+					"requestMethod": "GET",
+					"requestUrl":    "/foo",
+					"status":        429,
+					"userAgent":     "Netscape",
+					"latency":       "1s",
+				},
+				"ip":        "127.0.0.1",
+				"query":     url.Values{},
+				"severity":  "WARNING",
+				"start":     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				"throttled": true,
+			},
+		},
+		{
+			name: "Shed",
+
+			metrics: &ahttpmessages.Metrics{
+				StartedAt: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				Latency:   time.Second,
+				Shed:      true,
+			},
+			projectID: "",
+			ginC: func() *gin.Context {
+				w := httptest.NewRecorder()
+				ctx, _ := gin.CreateTestContext(w)
+
+				ctx.Request = httptest.NewRequest(http.MethodGet, "/foo", nil)
+				ctx.Request.Header.Set("User-Agent", "Netscape")
+				ctx.Request.Header.Set("X-Real-IP", "127.0.0.1")
+				ctx.Request.Header.Set("Content-Type", "application/json")
+				ctx.Writer.WriteHeader(http.StatusServiceUnavailable)
+
+				_ = testutils.AssignPrivateField[gin.Context, string](ctx, "fullPath", "/foo")
+
+				return ctx
+			},
+
+			expect: "👶🔪🩸 503 [GET /foo] (1s) · shed\n\n",
+			expectJSON: map[string]interface{}{
+				"contentType": "application/json",
+				"errors":      []string(nil),
+				"httpRequest": map[string]interface{}{
+					"protocol":      "HTTP/1.1",
+					"remoteIp":      "127.0.0.1",
+					"requestMethod": "GET",
+					"requestUrl":    "/foo",
+					"status":        503,
+					"userAgent":     "Netscape",
+					"latency":       "1s",
+				},
+				"ip":       "127.0.0.1",
+				"query":    url.Values{},
+				"severity": "ERROR",
+				"start":    time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				"shed":     true,
+			},
+		},
+		{
+			name: "CORSRejected",
+
+			metrics: &ahttpmessages.Metrics{
+				StartedAt:    time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				Latency:      time.Second,
+				CORSRejected: "origin https://evil.example not allowed",
+			},
+			projectID: "",
+			ginC: func() *gin.Context {
+				w := httptest.NewRecorder()
+				ctx, _ := gin.CreateTestContext(w)
+
+				ctx.Request = httptest.NewRequest(http.MethodOptions, "/foo", nil)
+				ctx.Request.Header.Set("User-Agent", "Netscape")
+				ctx.Request.Header.Set("X-Real-IP", "127.0.0.1")
+				ctx.Request.Header.Set("Content-Type", "application/json")
+				ctx.Writer.WriteHeader(http.StatusForbidden)
+
+				_ = testutils.AssignPrivateField[gin.Context, string](ctx, "fullPath", "/foo")
+
+				return ctx
+			},
+
+			expect: "⚠ 403 [OPTIONS /foo] (1s) · cors rejected: origin https://evil.example not allowed\n\n",
+			expectJSON: map[string]interface{}{
+				"contentType": "application/json",
+				"errors":      []string(nil),
+				"httpRequest": map[string]interface{}{
+					"protocol":      "HTTP/1.1",
+					"remoteIp":      "127.0.0.1",
+					"requestMethod": "OPTIONS",
+					"requestUrl":    "/foo",
+					"status":        403,
+					"userAgent":     "Netscape",
+					"latency":       "1s",
+				},
+				"ip":           "127.0.0.1",
+				"query":        url.Values{},
+				"severity":     "WARNING",
+				"start":        time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				"corsRejected": "origin https://evil.example not allowed",
+			},
+		},
+		{
+			name: "Coalesced",
+
+			metrics: &ahttpmessages.Metrics{
+				StartedAt: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				Latency:   time.Second,
+				Coalesced: true,
+			},
+			projectID: "",
+			ginC: func() *gin.Context {
+				w := httptest.NewRecorder()
+				ctx, _ := gin.CreateTestContext(w)
+
+				ctx.Request = httptest.NewRequest(http.MethodGet, "/foo", nil)
+				ctx.Request.Header.Set("User-Agent", "Netscape")
+				ctx.Request.Header.Set("X-Real-IP", "127.0.0.1")
+				ctx.Request.Header.Set("Content-Type", "application/json")
+				ctx.Writer.WriteHeader(http.StatusServiceUnavailable)
+
+				_ = testutils.AssignPrivateField[gin.Context, string](ctx, "fullPath", "/foo")
+
+				return ctx
+			},
+
+			expect: "👶🔪🩸 503 [GET /foo] (1s) · coalesced\n\n",
+			expectJSON: map[string]interface{}{
+				"contentType": "application/json",
+				"errors":      []string(nil),
+				"httpRequest": map[string]interface{}{
+					"protocol":      "HTTP/1.1",
+					"remoteIp":      "127.0.0.1",
+					"requestMethod": "GET",
+					"requestUrl":    "/foo",
+					"status":        503,
+					"userAgent":     "Netscape",
+					"latency":       "1s",
+				},
+				"ip":        "127.0.0.1",
+				"query":     url.Values{},
+				"severity":  "ERROR",
+				"start":     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				"coalesced": true,
+			},
+		},
+		{
+			name: "Subject",
+
+			metrics: &ahttpmessages.Metrics{
+				StartedAt: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				Latency:   time.Second,
+				Subject:   "alice",
+			},
+			projectID: "",
+			ginC: func() *gin.Context {
+				w := httptest.NewRecorder()
+				ctx, _ := gin.CreateTestContext(w)
+
+				ctx.Request = httptest.NewRequest(http.MethodGet, "/foo", nil)
+				ctx.Request.Header.Set("User-Agent", "Netscape")
+				ctx.Request.Header.Set("X-Real-IP", "127.0.0.1")
+				ctx.Request.Header.Set("Content-Type", "application/json")
+				ctx.Writer.WriteHeader(http.StatusServiceUnavailable)
+
+				_ = testutils.AssignPrivateField[gin.Context, string](ctx, "fullPath", "/foo")
+
+				return ctx
+			},
+
+			expect: "👶🔪🩸 503 [GET /foo] (1s) · sub alice\n\n",
+			expectJSON: map[string]interface{}{
+				"contentType": "application/json",
+				"errors":      []string(nil),
+				"httpRequest": map[string]interface{}{
+					"protocol":      "HTTP/1.1",
+					"remoteIp":      "127.0.0.1",
+					"requestMethod": "GET",
+					"requestUrl":    "/foo",
+					"status":        503,
+					"userAgent":     "Netscape",
+					"latency":       "1s",
+				},
+				"ip":       "127.0.0.1",
+				"query":    url.Values{},
+				"severity": "ERROR",
+				"start":    time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				"subject":  "alice",
+			},
+		},
+		{
+			name: "Authorization",
+
+			metrics: &ahttpmessages.Metrics{
+				StartedAt: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				Latency:   time.Second,
+				Subject:   "alice",
+				Authorization: &ahttpmessages.AuthorizationMetrics{
+					Reason:        "MISSING_SCOPES",
+					MissingScopes: []string{"write"},
+				},
+			},
+			projectID: "",
+			ginC: func() *gin.Context {
+				w := httptest.NewRecorder()
+				ctx, _ := gin.CreateTestContext(w)
+
+				ctx.Request = httptest.NewRequest(http.MethodGet, "/foo", nil)
+				ctx.Request.Header.Set("User-Agent", "Netscape")
+				ctx.Request.Header.Set("X-Real-IP", "127.0.0.1")
+				ctx.Request.Header.Set("Content-Type", "application/json")
+				ctx.Writer.WriteHeader(http.StatusForbidden)
+
+				_ = testutils.AssignPrivateField[gin.Context, string](ctx, "fullPath", "/foo")
+
+				return ctx
+			},
+
+			expect: "⚠ 403 [GET /foo] (1s) · sub alice · denied MISSING_SCOPES\n\n",
+			expectJSON: map[string]interface{}{
+				"contentType": "application/json",
+				"errors":      []string(nil),
+				"httpRequest": map[string]interface{}{
+					"protocol":      "HTTP/1.1",
+					"remoteIp":      "127.0.0.1",
+					"requestMethod": "GET",
+					"requestUrl":    "/foo",
+					"status":        403,
+					"userAgent":     "Netscape",
+					"latency":       "1s",
+				},
+				"ip":       "127.0.0.1",
+				"query":    url.Values{},
+				"severity": "WARNING",
+				"start":    time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				"subject":  "alice",
+				"authorization": map[string]interface{}{
+					"allowed":       false,
+					"reason":        "MISSING_SCOPES",
+					"missingScopes": []string{"write"},
+				},
+			},
+		},
+		{
+			name: "BodyLimit",
+
+			metrics: &ahttpmessages.Metrics{
+				StartedAt: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				Latency:   time.Second,
+				BodyLimit: 1024,
+			},
+			projectID: "",
+			ginC: func() *gin.Context {
+				w := httptest.NewRecorder()
+				ctx, _ := gin.CreateTestContext(w)
+
+				ctx.Request = httptest.NewRequest(http.MethodGet, "/foo", nil)
+				ctx.Request.Header.Set("User-Agent", "Netscape")
+				ctx.Request.Header.Set("X-Real-IP", "127.0.0.1")
+				ctx.Request.Header.Set("Content-Type", "application/json")
+				ctx.Writer.WriteHeader(http.StatusRequestEntityTooLarge)
+
+				_ = testutils.AssignPrivateField[gin.Context, string](ctx, "fullPath", "/foo")
+
+				return ctx
+			},
+
+			expect: "⚠ 413 [GET /foo] (1s) · body over 1024 B\n\n",
+			expectJSON: map[string]interface{}{
+				"contentType": "application/json",
+				"errors":      []string(nil),
+				"httpRequest": map[string]interface{}{
+					"protocol":      "HTTP/1.1",
+					"remoteIp":      "127.0.0.1",
+					"requestMethod": "GET",
+					"requestUrl":    "/foo",
+					"status":        413,
+					"userAgent":     "Netscape",
+					"latency":       "1s",
+				},
+				"ip":        "127.0.0.1",
+				"query":     url.Values{},
+				"severity":  "WARNING",
+				"start":     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				"bodyLimit": int64(1024),
+			},
+		},
+		{
+			name: "Cache",
+
+			metrics: &ahttpmessages.Metrics{
+				StartedAt: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				Latency:   time.Second,
+				Cache:     ahttpmessages.CacheStale,
+			},
+			projectID: "",
+			ginC: func() *gin.Context {
+				w := httptest.NewRecorder()
+				ctx, _ := gin.CreateTestContext(w)
+
+				ctx.Request = httptest.NewRequest(http.MethodGet, "/foo", nil)
+				ctx.Request.Header.Set("User-Agent", "Netscape")
+				ctx.Request.Header.Set("X-Real-IP", "127.0.0.1")
+				ctx.Request.Header.Set("Content-Type", "application/json")
+				ctx.Writer.WriteHeader(http.StatusOK)
+
+				_ = testutils.AssignPrivateField[gin.Context, string](ctx, "fullPath", "/foo")
+
+				return ctx
+			},
+
+			expect: "✅ 200 [GET /foo] (1s) · cache stale\n\n",
+			expectJSON: map[string]interface{}{
+				"contentType": "application/json",
+				"errors":      []string(nil),
+				"httpRequest": map[string]interface{}{
+					"protocol":      "HTTP/1.1",
+					"remoteIp":      "127.0.0.1",
+					"requestMethod": "GET",
+					"requestUrl":    "/foo",
+					"status":        200,
+					"userAgent":     "Netscape",
+					"latency":       "1s",
+					"cacheLookup":   true,
+					"cacheHit":      true,
+				},
+				"ip":       "127.0.0.1",
+				"query":    url.Values{},
+				"severity": "INFO",
+				"start":    time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				"cache":    "stale",
+			},
+		},
+		{
+			name: "Compression",
+
+			metrics: &ahttpmessages.Metrics{
+				StartedAt: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				Latency:   time.Second,
+				Compression: &ahttpmessages.CompressionMetrics{
+					RequestEncoding:          "gzip",
+					RequestSize:              300,
+					UncompressedRequestSize:  2048,
+					ResponseEncoding:         "deflate",
+					ResponseSize:             400,
+					UncompressedResponseSize: 4096,
+				},
+			},
+			projectID: "",
+			ginC: func() *gin.Context {
+				w := httptest.NewRecorder()
+				ctx, _ := gin.CreateTestContext(w)
+
+				ctx.Request = httptest.NewRequest(http.MethodPost, "/foo", nil)
+				ctx.Request.Header.Set("User-Agent", "Netscape")
+				ctx.Request.Header.Set("X-Real-IP", "127.0.0.1")
+				ctx.Request.Header.Set("Content-Type", "application/json")
+				ctx.Writer.WriteHeader(http.StatusOK)
+
+				_ = testutils.AssignPrivateField[gin.Context, string](ctx, "fullPath", "/foo")
+
+				return ctx
+			},
+
+			expect: "✅ 200 [POST /foo] (1s) · gzip in 300→2048 B · deflate out 4096→400 B\n\n",
+			expectJSON: map[string]interface{}{
+				"contentType": "application/json",
+				"errors":      []string(nil),
+				"httpRequest": map[string]interface{}{
+					"protocol":      "HTTP/1.1",
+					"remoteIp":      "127.0.0.1",
+					"requestMethod": "POST",
+					"requestUrl":    "/foo",
+					"status":        200,
+					"userAgent":     "Netscape",
+					"latency":       "1s",
+					"requestSize":   "300",
+					"responseSize":  "400",
+				},
+				"ip":       "127.0.0.1",
+				"query":    url.Values{},
+				"severity": "INFO",
+				"start":    time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				"compression": map[string]interface{}{
+					"request": map[string]interface{}{
+						"encoding":         "gzip",
+						"size":             int64(300),
+						"uncompressedSize": int64(2048),
+					},
+					"response": map[string]interface{}{
+						"encoding":         "deflate",
+						"size":             int64(400),
+						"uncompressedSize": int64(4096),
+					},
+				},
+			},
+		},
+		{
+			name: "ClientClosed",
+
+			metrics: &ahttpmessages.Metrics{
+				StartedAt:    time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				Latency:      time.Second,
+				ClientClosed: true,
+			},
+			projectID: "",
+			ginC: func() *gin.Context {
+				w := httptest.NewRecorder()
+				ctx, _ := gin.CreateTestContext(w)
+
+				ctx.Request = httptest.NewRequest(http.MethodGet, "/foo", nil)
+				ctx.Request.Header.Set("User-Agent", "Netscape")
+				ctx.Request.Header.Set("X-Real-IP", "127.0.0.1")
+				ctx.Request.Header.Set("Content-Type", "application/json")
+				ctx.Writer.WriteHeader(http.StatusOK)
+
+				_ = testutils.AssignPrivateField[gin.Context, string](ctx, "fullPath", "/foo")
+
+				return ctx
+			},
+
+			expect: "👋 499 [GET /foo] (1s)\n\n",
+			expectJSON: map[string]interface{}{
+				"contentType": "application/json",
+				"errors":      []string(nil),
+				"httpRequest": map[string]interface{}{
+					"protocol":      "HTTP/1.1",
+					"remoteIp":      "127.0.0.1",
+					"requestMethod": "GET",
+					"requestUrl":    "/foo",
+					"status":        499,
+					"userAgent":     "Netscape",
+					"latency":       "1s",
+				},
+				"ip":            "127.0.0.1",
+				"query":         url.Values{},
+				"severity":      "INFO",
+				"start":         time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				"clientClosed":  true,
+				"handlerStatus": 200,
+			},
+		},
+		{
+			name: "WebSocket",
+
+			metrics: &ahttpmessages.Metrics{
+				StartedAt: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				Latency:   time.Second,
+				WebSocket: &ahttpmessages.WebSocketMetrics{
+					MessagesIn:  3,
+					MessagesOut: 5,
+					CloseCode:   1000,
+				},
+			},
+			projectID: "",
+			ginC: func() *gin.Context {
+				w := httptest.NewRecorder()
+				ctx, _ := gin.CreateTestContext(w)
+
+				ctx.Request = httptest.NewRequest(http.MethodGet, "/foo", nil)
+				ctx.Request.Header.Set("User-Agent", "Netscape")
+				ctx.Request.Header.Set("X-Real-IP", "127.0.0.1")
+
+				_ = testutils.AssignPrivateField[gin.Context, string](ctx, "fullPath", "/foo")
+
+				return ctx
+			},
+
+			expect: "🔌 101 [GET /foo] (1s) · 3 in · 5 out · closed 1000\n\n",
+			expectJSON: map[string]interface{}{
+				"contentType": "",
+				"errors":      []string(nil),
+				"httpRequest": map[string]interface{}{
+					"protocol":      "HTTP/1.1",
+					"remoteIp":      "127.0.0.1",
+					"requestMethod": "GET",
+					"requestUrl":    "/foo",
+					"status":        101,
+					"userAgent":     "Netscape",
+					"latency":       "1s",
+				},
+				"ip":       "127.0.0.1",
+				"query":    url.Values{},
+				"severity": "INFO",
+				"start":    time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				"websocket": map[string]interface{}{
+					"messagesIn":  int64(3),
+					"messagesOut": int64(5),
+					"closeCode":   1000,
+				},
+			},
+		},
 		{
 			name: "WithQuery",
 
@@ -265,6 +879,57 @@ func TestReport(t *testing.T) {
 				"severity": "INFO",
 			},
 		},
+		{
+			name: "WithRedactedQuery",
+
+			metrics: &ahttpmessages.Metrics{
+				StartedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				Latency:       time.Second,
+				RedactedQuery: []string{"foo", "missing"},
+			},
+			projectID: "",
+			ginC: func() *gin.Context {
+				w := httptest.NewRecorder()
+				ctx, _ := gin.CreateTestContext(w)
+
+				ctx.Request = httptest.NewRequest(http.MethodGet, "/foo?foo=bar&bar=baz&foo=qux", nil)
+				ctx.Request.Header.Set("User-Agent", "Netscape")
+				ctx.Request.Header.Set("X-Real-IP", "127.0.0.1")
+				ctx.Request.Header.Set("Content-Type", "application/json")
+				ctx.Writer.WriteHeader(http.StatusOK)
+
+				_ = testutils.AssignPrivateField[gin.Context, string](ctx, "fullPath", "/foo")
+
+				return ctx
+			},
+
+			expect: "✅ 200 [GET /foo] (1s)\n" +
+				"┌────────────────────────────────────┬─────────────────────────────────────────┐\n" +
+				"│  bar                               │  baz                                    │\n" +
+				"│  foo                               │  REDACTED                               │\n" +
+				"│                                    │  REDACTED                               │\n" +
+				"└────────────────────────────────────┴─────────────────────────────────────────┘\n\n",
+			expectJSON: map[string]interface{}{
+				"contentType": "application/json",
+				"errors":      []string(nil),
+				"httpRequest": map[string]interface{}{
+					"protocol":      "HTTP/1.1",
+					"remoteIp":      "127.0.0.1",
+					"requestMethod": "GET",
+					"requestUrl":    "/foo",
+					"status":        200,
+					"userAgent":     "Netscape",
+					"latency":       "1s",
+				},
+				"ip": "127.0.0.1",
+				"query": url.Values{
+					"bar": []string{"baz"},
+					"foo": []string{ahttpmessages.RedactedValue, ahttpmessages.RedactedValue},
+				},
+				"severity": "INFO",
+				"start":    time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
 		{
 			name: "WithErrors",
 
@@ -0,0 +1,176 @@
+package ahttpmessages
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/a-novel-kit/quicklog"
+)
+
+type TransportMetrics struct {
+	Latency   time.Duration
+	StartedAt time.Time
+
+	// RetryCount is the number of attempts that preceded this one.
+	RetryCount int
+}
+
+type OutgoingRequest struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+
+	// Status is the status of the response. It is zero if no response was received.
+	Status int
+	Err    error
+}
+
+type transportReportMessage struct {
+	metrics   *TransportMetrics
+	projectID string
+	request   *OutgoingRequest
+
+	quicklog.Message
+}
+
+func (report *transportReportMessage) level() quicklog.Level {
+	if report.request.Err != nil {
+		return quicklog.LevelError
+	}
+
+	return LevelFromStatus(report.request.Status)
+}
+
+// redactedURL omits the query and the user info of a URL: third-party APIs commonly take credentials there.
+func redactedURL(requestURL *url.URL) string {
+	return (&url.URL{Scheme: requestURL.Scheme, Host: requestURL.Host, Path: requestURL.Path}).String()
+}
+
+// errorMessage returns the message of the request error, with its URLs redacted. Errors from http.Client are
+// *url.Error, whose message contains the full URL of the request.
+func (report *transportReportMessage) errorMessage() string {
+	message := report.request.Err.Error()
+
+	var urlErr *url.Error
+	if errors.As(report.request.Err, &urlErr) {
+		if errURL, err := url.Parse(urlErr.URL); err == nil {
+			message = strings.ReplaceAll(message, urlErr.URL, redactedURL(errURL))
+		}
+	}
+
+	if report.request.URL != nil {
+		message = strings.ReplaceAll(message, report.request.URL.String(), redactedURL(report.request.URL))
+	}
+
+	return message
+}
+
+func (report *transportReportMessage) RenderTerminal() string {
+	errorMessage := ""
+	if report.request.Err != nil {
+		errorMessage = "\n" + lipgloss.NewStyle().
+			MarginLeft(2).
+			Foreground(lipgloss.Color("9")).
+			Render("- "+report.errorMessage())
+	}
+
+	latencyMessage := ""
+	retryMessage := ""
+
+	if report.metrics != nil {
+		latencyMessage = lipgloss.NewStyle().Faint(true).Render(fmt.Sprintf(" (%s)", report.metrics.Latency))
+
+		if report.metrics.RetryCount > 0 {
+			retryMessage = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("220")).
+				Render(fmt.Sprintf(" · retry %d", report.metrics.RetryCount))
+		}
+	}
+
+	color := lipgloss.Color("33")
+	prefix := "✅ "
+
+	switch report.level() {
+	case quicklog.LevelError:
+		color = "9"
+		prefix = "👶🔪🩸 "
+	case quicklog.LevelWarning:
+		color = "202"
+		prefix = "⚠ "
+	default:
+	}
+
+	statusMessage := "ERR"
+	if report.request.Status != 0 {
+		statusMessage = fmt.Sprintf("%d", report.request.Status)
+	}
+
+	return lipgloss.NewStyle().
+		Foreground(color).
+		Bold(true).
+		Render(prefix+statusMessage) +
+		lipgloss.NewStyle().
+			Foreground(color).
+			Render(fmt.Sprintf(" ↗ [%s %s%s]", report.request.Method, report.request.URL.Host, report.request.URL.Path)) +
+		latencyMessage +
+		retryMessage +
+		errorMessage +
+		"\n\n"
+}
+
+func (report *transportReportMessage) RenderJSON() map[string]interface{} {
+	httpRequest := map[string]interface{}{
+		"requestMethod": report.request.Method,
+		"requestUrl":    redactedURL(report.request.URL),
+		"status":        report.request.Status,
+	}
+
+	var errs []string
+	if report.request.Err != nil {
+		errs = []string{report.errorMessage()}
+	}
+
+	output := map[string]interface{}{
+		"httpRequest": httpRequest,
+		"severity":    string(report.level()),
+		"direction":   "outbound",
+		"host":        report.request.URL.Host,
+		"path":        report.request.URL.Path,
+		"errors":      errs,
+	}
+
+	if report.metrics != nil {
+		output["start"] = report.metrics.StartedAt
+		output["retryCount"] = report.metrics.RetryCount
+		httpRequest["latency"] = report.metrics.Latency.String()
+	}
+
+	if requestID := report.request.Header.Get("X-Request-Id"); requestID != "" {
+		output["requestId"] = requestID
+	}
+
+	if trace := traceField(report.projectID, report.request.Header.Get); trace != "" {
+		output["logging.googleapis.com/trace"] = trace
+	}
+
+	return output
+}
+
+// TransportReportLevel returns the level an outgoing request report should be logged with.
+func TransportReportLevel(request *OutgoingRequest) quicklog.Level {
+	return (&transportReportMessage{request: request}).level()
+}
+
+func NewTransportReport(metrics *TransportMetrics, projectID string, request *OutgoingRequest) quicklog.Message {
+	return &transportReportMessage{
+		metrics:   metrics,
+		projectID: projectID,
+		request:   request,
+	}
+}
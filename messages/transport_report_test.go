@@ -0,0 +1,178 @@
+package ahttpmessages_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	ahttpmessages "github.com/a-novel-kit/ahttp/messages"
+)
+
+func TestTransportReport(t *testing.T) {
+	requestURL, err := url.Parse("https://api.example.com/v1/charges?key=secret")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name string
+
+		metrics   *ahttpmessages.TransportMetrics
+		projectID string
+		request   *ahttpmessages.OutgoingRequest
+
+		expect     string
+		expectJSON map[string]interface{}
+	}{
+		{
+			name: "SimpleRequest",
+
+			request: &ahttpmessages.OutgoingRequest{
+				Method: http.MethodGet,
+				URL:    requestURL,
+				Header: http.Header{},
+				Status: http.StatusOK,
+			},
+
+			expect: "✅ 200 ↗ [GET api.example.com/v1/charges]\n\n",
+			expectJSON: map[string]interface{}{
+				"direction": "outbound",
+				"errors":    []string(nil),
+				"host":      "api.example.com",
+				"httpRequest": map[string]interface{}{
+					"requestMethod": "GET",
+					"requestUrl":    "https://api.example.com/v1/charges",
+					"status":        200,
+				},
+				"path":     "/v1/charges",
+				"severity": "INFO",
+			},
+		},
+		{
+			name: "ClientError",
+
+			request: &ahttpmessages.OutgoingRequest{
+				Method: http.MethodGet,
+				URL:    requestURL,
+				Header: http.Header{},
+				Status: http.StatusTooManyRequests,
+			},
+
+			expect: "⚠ 429 ↗ [GET api.example.com/v1/charges]\n\n",
+			expectJSON: map[string]interface{}{
+				"direction": "outbound",
+				"errors":    []string(nil),
+				"host":      "api.example.com",
+				"httpRequest": map[string]interface{}{
+					"requestMethod": "GET",
+					"requestUrl":    "https://api.example.com/v1/charges",
+					"status":        429,
+				},
+				"path":     "/v1/charges",
+				"severity": "WARNING",
+			},
+		},
+		{
+			name: "TransportError",
+
+			request: &ahttpmessages.OutgoingRequest{
+				Method: http.MethodPost,
+				URL:    requestURL,
+				Header: http.Header{},
+				Err:    errors.New("connection refused"),
+			},
+
+			expect: "👶🔪🩸 ERR ↗ [POST api.example.com/v1/charges]\n  - connection refused\n\n",
+			expectJSON: map[string]interface{}{
+				"direction": "outbound",
+				"errors":    []string{"connection refused"},
+				"host":      "api.example.com",
+				"httpRequest": map[string]interface{}{
+					"requestMethod": "POST",
+					"requestUrl":    "https://api.example.com/v1/charges",
+					"status":        0,
+				},
+				"path":     "/v1/charges",
+				"severity": "ERROR",
+			},
+		},
+		{
+			name: "TransportErrorWithQuery",
+
+			request: &ahttpmessages.OutgoingRequest{
+				Method: http.MethodPost,
+				URL:    requestURL,
+				Header: http.Header{},
+				Err: fmt.Errorf("call charges: %w", &url.Error{
+					Op:  "Post",
+					URL: requestURL.String(),
+					Err: errors.New("connection refused"),
+				}),
+			},
+
+			expect: "👶🔪🩸 ERR ↗ [POST api.example.com/v1/charges]\n" +
+				"  - call charges: Post \"https://api.example.com/v1/charges\": connection refused\n\n",
+			expectJSON: map[string]interface{}{
+				"direction": "outbound",
+				"errors":    []string{`call charges: Post "https://api.example.com/v1/charges": connection refused`},
+				"host":      "api.example.com",
+				"httpRequest": map[string]interface{}{
+					"requestMethod": "POST",
+					"requestUrl":    "https://api.example.com/v1/charges",
+					"status":        0,
+				},
+				"path":     "/v1/charges",
+				"severity": "ERROR",
+			},
+		},
+		{
+			name: "WithMetricsAndTrace",
+
+			metrics: &ahttpmessages.TransportMetrics{
+				StartedAt:  time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				Latency:    time.Second,
+				RetryCount: 2,
+			},
+			projectID: "cd",
+			request: &ahttpmessages.OutgoingRequest{
+				Method: http.MethodGet,
+				URL:    requestURL,
+				Header: http.Header{
+					"X-Request-Id":          []string{"abc"},
+					"X-Cloud-Trace-Context": []string{"abcdefg/hijklmnop"},
+				},
+				Status: http.StatusOK,
+			},
+
+			expect: "✅ 200 ↗ [GET api.example.com/v1/charges] (1s) · retry 2\n\n",
+			expectJSON: map[string]interface{}{
+				"direction": "outbound",
+				"errors":    []string(nil),
+				"host":      "api.example.com",
+				"httpRequest": map[string]interface{}{
+					"requestMethod": "GET",
+					"requestUrl":    "https://api.example.com/v1/charges",
+					"status":        200,
+					"latency":       "1s",
+				},
+				"path":                         "/v1/charges",
+				"severity":                     "INFO",
+				"start":                        time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				"retryCount":                   2,
+				"requestId":                    "abc",
+				"logging.googleapis.com/trace": "projects/cd/traces/abcdefg",
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			report := ahttpmessages.NewTransportReport(testCase.metrics, testCase.projectID, testCase.request)
+			require.Equal(t, testCase.expect, report.RenderTerminal())
+			require.Equal(t, testCase.expectJSON, report.RenderJSON())
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package ahttp
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PrincipalKey is the gin key of the Principal of an authenticated request.
+const PrincipalKey = "ahttp.principal"
+
+// Error codes of the WWW-Authenticate header, as described in RFC 6750.
+const (
+	AuthErrorInvalidRequest    = "invalid_request"
+	AuthErrorInvalidToken      = "invalid_token"
+	AuthErrorInsufficientScope = "insufficient_scope"
+)
+
+// Principal is the authenticated client of a request.
+type Principal struct {
+	Subject string
+	// Scopes are the OAuth scopes granted to the client.
+	Scopes []string
+	// Claims are the claims of the credentials, including custom ones. JSON numbers are decoded as json.Number.
+	Claims map[string]any
+}
+
+func (principal *Principal) HasScope(scope string) bool {
+	return slices.Contains(principal.Scopes, scope)
+}
+
+// Roles returns the roles of the "roles" claim, which is either a string or an array of strings.
+func (principal *Principal) Roles() []string {
+	return stringsClaim(principal.Claims, "roles")
+}
+
+func (principal *Principal) HasRole(role string) bool {
+	return slices.Contains(principal.Roles(), role)
+}
+
+type principalContextKey struct{}
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return principal, ok
+}
+
+// setPrincipal stores the principal both in gin and in the request context.
+func setPrincipal(ctx *gin.Context, principal *Principal) {
+	ctx.Set(PrincipalKey, principal)
+	ctx.Request = ctx.Request.WithContext(WithPrincipal(ctx.Request.Context(), principal))
+}
+
+// bearerToken returns the token of the Authorization header, and whether the header is present at all.
+func bearerToken(ctx *gin.Context) (string, bool) {
+	header := ctx.GetHeader("Authorization")
+	if header == "" {
+		return "", false
+	}
+
+	scheme, token, _ := strings.Cut(header, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", true
+	}
+
+	return strings.TrimSpace(token), true
+}
+
+// bearerChallenge formats a WWW-Authenticate header of the Bearer scheme, from pairs of parameter names and
+// values. Parameters with an empty value are omitted.
+func bearerChallenge(params ...string) string {
+	formatted := make([]string, 0, len(params)/2)
+
+	for i := 0; i+1 < len(params); i += 2 {
+		if params[i+1] != "" {
+			formatted = append(formatted, fmt.Sprintf("%s=%q", params[i], params[i+1]))
+		}
+	}
+
+	if len(formatted) == 0 {
+		return "Bearer"
+	}
+
+	return "Bearer " + strings.Join(formatted, ", ")
+}
+
+// abortUnauthenticated responds with the WWW-Authenticate header of the Bearer scheme. The error code is
+// omitted when the request has no credentials.
+func abortUnauthenticated(ctx *gin.Context, realm, errorCode string, err error) {
+	description := ""
+	if errorCode != "" {
+		description = err.Error()
+	}
+
+	code := codes.Unauthenticated
+	if errorCode == AuthErrorInsufficientScope {
+		code = codes.PermissionDenied
+	}
+
+	ctx.Header("WWW-Authenticate", bearerChallenge(
+		"realm", realm, "error", errorCode, "error_description", description,
+	))
+	HandleGRPCErrorProblem(ctx, status.Error(code, err.Error()))
+}
@@ -0,0 +1,84 @@
+package ahttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const ContentTypeProblem = "application/problem+json"
+
+// Problem is the body of error responses, as described in RFC 9457.
+type Problem struct {
+	// Type is a URI that identifies the problem type. It is omitted for problems that are fully described by
+	// their status.
+	Type   string `json:"type,omitempty"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+
+	// Code is the name of the gRPC code of the error, if any.
+	Code string `json:"code,omitempty"`
+	// Details are the details of the gRPC status, in their protojson representation.
+	Details []json.RawMessage `json:"details,omitempty"`
+}
+
+func newProblem(httpStatus int, detail string) *Problem {
+	problem := &Problem{
+		Title:  http.StatusText(httpStatus),
+		Status: httpStatus,
+		Detail: detail,
+	}
+
+	if code := HTTPToGRPCCode(httpStatus); code != codes.OK && code != codes.Unknown {
+		problem.Code = code.String()
+	}
+
+	return problem
+}
+
+func problemFromStatus(grpcStatus *status.Status) *Problem {
+	problem := newProblem(GRPCToHTTPCode(grpcStatus.Code()), grpcStatus.Message())
+	problem.Code = grpcStatus.Code().String()
+
+	for _, detail := range grpcStatus.Proto().GetDetails() {
+		if data, err := protojson.Marshal(detail); err == nil {
+			problem.Details = append(problem.Details, data)
+		}
+	}
+
+	return problem
+}
+
+// writeProblem writes a problem to a response that was not committed yet. The response has a Content-Length, so
+// it is complete once written, even if the handler keeps running.
+func writeProblem(w http.ResponseWriter, problem *Problem) {
+	data, err := json.Marshal(problem)
+	if err != nil {
+		w.WriteHeader(problem.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentTypeProblem)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(problem.Status)
+	_, _ = w.Write(data)
+}
+
+// abortWithProblem aborts the request with a problem response, and attaches err to the context. If a response
+// was already written, only the error is recorded.
+func abortWithProblem(ctx *gin.Context, problem *Problem, err error) {
+	_ = ctx.Error(err)
+	ctx.Abort()
+
+	if ctx.Writer.Written() {
+		return
+	}
+
+	writeProblem(ctx.Writer, problem)
+}
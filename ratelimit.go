@@ -0,0 +1,218 @@
+package ahttp
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	RateLimitLimitHeader     = "RateLimit-Limit"
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	RateLimitResetHeader     = "RateLimit-Reset"
+	RateLimitPolicyHeader    = "RateLimit-Policy"
+)
+
+// Number of times a request retries to update its key, when it races with concurrent requests.
+const rateLimitMaxSwaps = 10
+
+// RateLimit allows Requests per Period, with bursts of up to Burst requests.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+	// Burst is the number of requests that can be sent at once, after a period of inactivity. Defaults to
+	// Requests.
+	Burst int
+}
+
+// interval is the time between two requests. It is at least a nanosecond, even for limits of more than one
+// request per nanosecond.
+func (limit RateLimit) interval() time.Duration {
+	return max(limit.Period/time.Duration(limit.Requests), time.Nanosecond)
+}
+
+func (limit RateLimit) burst() int {
+	if limit.Burst > 0 {
+		return limit.Burst
+	}
+
+	return limit.Requests
+}
+
+// RateLimitStore persists the state of the rate limiter. The limiter uses the generic cell rate algorithm
+// (GCRA), so the state of a key is a single timestamp: its theoretical arrival time (TAT).
+type RateLimitStore interface {
+	// Get returns the TAT of key, or the zero time if the key is unknown.
+	Get(ctx context.Context, key string) (time.Time, error)
+	// CompareAndSwap sets the TAT of key to next, if its current value is old, and reports whether it did. An
+	// unknown key has the zero time as its current value. The key can be forgotten after ttl.
+	CompareAndSwap(ctx context.Context, key string, old, next time.Time, ttl time.Duration) (bool, error)
+}
+
+type memoryRateLimitStore struct {
+	cache *ttlCache[time.Time]
+}
+
+func (store *memoryRateLimitStore) Get(_ context.Context, key string) (time.Time, error) {
+	tat, _ := store.cache.get(key, time.Now())
+	return tat, nil
+}
+
+func (store *memoryRateLimitStore) CompareAndSwap(
+	_ context.Context, key string, old, next time.Time, ttl time.Duration,
+) (bool, error) {
+	return store.cache.update(key, time.Now(), func(current time.Time, _ bool) (time.Time, time.Duration, bool) {
+		return next, ttl, current.Equal(old)
+	}), nil
+}
+
+// NewMemoryRateLimitStore returns a RateLimitStore that keeps keys in memory, until they expire. It is not
+// shared between instances of a service.
+func NewMemoryRateLimitStore() RateLimitStore {
+	return &memoryRateLimitStore{cache: newTTLCache[time.Time]()}
+}
+
+// RateLimitKeyFunc identifies the client of a request. Requests with an empty key are not limited.
+type RateLimitKeyFunc func(ctx *gin.Context) string
+
+// RateLimitByClientIP limits requests per client IP.
+func RateLimitByClientIP(ctx *gin.Context) string {
+	return ctx.ClientIP()
+}
+
+// RateLimitByHeader limits requests per value of a header, such as an API key.
+func RateLimitByHeader(name string) RateLimitKeyFunc {
+	return func(ctx *gin.Context) string {
+		return ctx.GetHeader(name)
+	}
+}
+
+// RateLimitByContextKey limits requests per value of a gin context key, such as a user ID set by an
+// authentication middleware.
+func RateLimitByContextKey(key string) RateLimitKeyFunc {
+	return func(ctx *gin.Context) string {
+		return ctx.GetString(key)
+	}
+}
+
+// RateLimitByRoute limits requests per route, regardless of the client.
+func RateLimitByRoute(ctx *gin.Context) string {
+	return ctx.FullPath()
+}
+
+type RateLimitConfig struct {
+	// Store defaults to an in-memory store.
+	Store RateLimitStore
+	// Key defaults to RateLimitByClientIP.
+	Key RateLimitKeyFunc
+
+	// Limit applies to every route that has no limit of its own.
+	Limit RateLimit
+	// Routes overrides Limit for some routes, by full path (see gin.Context.FullPath). Each of those routes has
+	// its own budget.
+	Routes map[string]RateLimit
+}
+
+type rateLimitResult struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+func takeRateLimit(ctx context.Context, store RateLimitStore, key string, limit RateLimit) (*rateLimitResult, error) {
+	interval := limit.interval()
+	tolerance := interval * time.Duration(limit.burst())
+
+	for range rateLimitMaxSwaps {
+		now := time.Now()
+
+		stored, err := store.Get(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("get rate limit: %w", err)
+		}
+
+		tat := stored
+		if tat.Before(now) {
+			tat = now
+		}
+
+		next := tat.Add(interval)
+
+		if allowAt := next.Add(-tolerance); now.Before(allowAt) {
+			return &rateLimitResult{
+				reset:      tat.Sub(now),
+				retryAfter: allowAt.Sub(now),
+			}, nil
+		}
+
+		swapped, err := store.CompareAndSwap(ctx, key, stored, next, next.Sub(now))
+		if err != nil {
+			return nil, fmt.Errorf("update rate limit: %w", err)
+		}
+
+		if swapped {
+			return &rateLimitResult{
+				allowed:   true,
+				remaining: int((tolerance - next.Sub(now)) / interval),
+				reset:     next.Sub(now),
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("update rate limit: too much contention on key %q", key)
+}
+
+// RateLimitMiddleware limits the rate of requests per client. Requests over the limit are rejected with a 429
+// status, and a Retry-After header.
+//
+// The RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy headers are set on every limited
+// response. If the store fails, the request is let through, and the error is added to the context.
+func RateLimitMiddleware(config RateLimitConfig) gin.HandlerFunc {
+	if config.Store == nil {
+		config.Store = NewMemoryRateLimitStore()
+	}
+
+	if config.Key == nil {
+		config.Key = RateLimitByClientIP
+	}
+
+	return func(ctx *gin.Context) {
+		limit, route := config.Limit, ""
+		if routeLimit, ok := config.Routes[ctx.FullPath()]; ok {
+			limit, route = routeLimit, ctx.FullPath()
+		}
+
+		key := config.Key(ctx)
+		if key == "" || limit.Requests <= 0 || limit.Period <= 0 {
+			ctx.Next()
+			return
+		}
+
+		result, err := takeRateLimit(ctx.Request.Context(), config.Store, route+":"+key, limit)
+		if err != nil {
+			_ = ctx.Error(err)
+			ctx.Next()
+
+			return
+		}
+
+		ctx.Header(RateLimitLimitHeader, strconv.Itoa(limit.Requests))
+		ctx.Header(RateLimitRemainingHeader, strconv.Itoa(result.remaining))
+		ctx.Header(RateLimitResetHeader, formatSeconds(result.reset))
+		ctx.Header(RateLimitPolicyHeader, fmt.Sprintf("%d;w=%s", limit.Requests, formatSeconds(limit.Period)))
+
+		if !result.allowed {
+			ctx.Set(reportThrottledKey, true)
+			HandleGRPCErrorProblem(ctx, statusWithRetryDelay(codes.ResourceExhausted, "rate limit exceeded", result.retryAfter))
+
+			return
+		}
+
+		ctx.Next()
+	}
+}
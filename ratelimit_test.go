@@ -0,0 +1,254 @@
+package ahttp_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a-novel-kit/quicklog"
+	quicklogmocks "github.com/a-novel-kit/quicklog/mocks"
+	testutils "github.com/a-novel-kit/test-utils"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Get(context.Context, string) (time.Time, error) {
+	return time.Time{}, testutils.ErrDummy
+}
+
+func (failingRateLimitStore) CompareAndSwap(
+	context.Context, string, time.Time, time.Time, time.Duration,
+) (bool, error) {
+	return false, testutils.ErrDummy
+}
+
+type rateLimitRequest struct {
+	path   string
+	ip     string
+	apiKey string
+
+	expectCode       int
+	expectRemaining  string
+	expectRetryAfter string
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		config   ahttp.RateLimitConfig
+		requests []rateLimitRequest
+	}{
+		{
+			name: "UnderLimit",
+
+			config: ahttp.RateLimitConfig{Limit: ahttp.RateLimit{Requests: 2, Period: time.Minute}},
+			requests: []rateLimitRequest{
+				{path: "/foo", ip: "1.1.1.1", expectCode: http.StatusOK, expectRemaining: "1"},
+				{path: "/foo", ip: "1.1.1.1", expectCode: http.StatusOK, expectRemaining: "0"},
+			},
+		},
+		{
+			name: "OverLimit",
+
+			config: ahttp.RateLimitConfig{Limit: ahttp.RateLimit{Requests: 2, Period: time.Minute}},
+			requests: []rateLimitRequest{
+				{path: "/foo", ip: "1.1.1.1", expectCode: http.StatusOK, expectRemaining: "1"},
+				{path: "/foo", ip: "1.1.1.1", expectCode: http.StatusOK, expectRemaining: "0"},
+				{
+					path: "/foo", ip: "1.1.1.1",
+					expectCode: http.StatusTooManyRequests, expectRemaining: "0", expectRetryAfter: "30",
+				},
+			},
+		},
+		{
+			name: "PerClient",
+
+			config: ahttp.RateLimitConfig{Limit: ahttp.RateLimit{Requests: 1, Period: time.Minute}},
+			requests: []rateLimitRequest{
+				{path: "/foo", ip: "1.1.1.1", expectCode: http.StatusOK, expectRemaining: "0"},
+				{path: "/foo", ip: "2.2.2.2", expectCode: http.StatusOK, expectRemaining: "0"},
+				{
+					path: "/foo", ip: "1.1.1.1",
+					expectCode: http.StatusTooManyRequests, expectRemaining: "0", expectRetryAfter: "60",
+				},
+			},
+		},
+		{
+			name: "PerRoute",
+
+			config: ahttp.RateLimitConfig{
+				Limit:  ahttp.RateLimit{Requests: 2, Period: time.Minute},
+				Routes: map[string]ahttp.RateLimit{"/bar": {Requests: 1, Period: time.Second}},
+			},
+			requests: []rateLimitRequest{
+				{path: "/bar", ip: "1.1.1.1", expectCode: http.StatusOK, expectRemaining: "0"},
+				{
+					path: "/bar", ip: "1.1.1.1",
+					expectCode: http.StatusTooManyRequests, expectRemaining: "0", expectRetryAfter: "1",
+				},
+				// The budget of /bar is separate.
+				{path: "/foo", ip: "1.1.1.1", expectCode: http.StatusOK, expectRemaining: "1"},
+			},
+		},
+		{
+			name: "Burst",
+
+			config: ahttp.RateLimitConfig{Limit: ahttp.RateLimit{Requests: 1, Period: time.Minute, Burst: 3}},
+			requests: []rateLimitRequest{
+				{path: "/foo", ip: "1.1.1.1", expectCode: http.StatusOK, expectRemaining: "2"},
+				{path: "/foo", ip: "1.1.1.1", expectCode: http.StatusOK, expectRemaining: "1"},
+				{path: "/foo", ip: "1.1.1.1", expectCode: http.StatusOK, expectRemaining: "0"},
+				{
+					path: "/foo", ip: "1.1.1.1",
+					expectCode: http.StatusTooManyRequests, expectRemaining: "0", expectRetryAfter: "60",
+				},
+			},
+		},
+		{
+			name: "SubNanosecondInterval",
+
+			config: ahttp.RateLimitConfig{Limit: ahttp.RateLimit{Requests: 2_000_000_000, Period: time.Second}},
+			requests: []rateLimitRequest{
+				{path: "/foo", ip: "1.1.1.1", expectCode: http.StatusOK, expectRemaining: "1999999999"},
+			},
+		},
+		{
+			name: "ByHeader",
+
+			config: ahttp.RateLimitConfig{
+				Key:   ahttp.RateLimitByHeader("X-Api-Key"),
+				Limit: ahttp.RateLimit{Requests: 1, Period: time.Minute},
+			},
+			requests: []rateLimitRequest{
+				{path: "/foo", ip: "1.1.1.1", apiKey: "abc", expectCode: http.StatusOK, expectRemaining: "0"},
+				{
+					path: "/foo", ip: "2.2.2.2", apiKey: "abc",
+					expectCode: http.StatusTooManyRequests, expectRemaining: "0", expectRetryAfter: "60",
+				},
+				// Requests without a key are not limited.
+				{path: "/foo", ip: "1.1.1.1", expectCode: http.StatusOK},
+			},
+		},
+		{
+			name: "StoreError",
+
+			config: ahttp.RateLimitConfig{
+				Store: failingRateLimitStore{},
+				Limit: ahttp.RateLimit{Requests: 1, Period: time.Minute},
+			},
+			requests: []rateLimitRequest{
+				{path: "/foo", ip: "1.1.1.1", expectCode: http.StatusOK},
+				{path: "/foo", ip: "1.1.1.1", expectCode: http.StatusOK},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(ahttp.RateLimitMiddleware(testCase.config))
+			router.GET("/foo", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+			router.GET("/bar", func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+
+			for _, request := range testCase.requests {
+				req := httptest.NewRequest(http.MethodGet, request.path, nil)
+				req.RemoteAddr = request.ip + ":1234"
+
+				if request.apiKey != "" {
+					req.Header.Set("X-Api-Key", request.apiKey)
+				}
+
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				require.Equal(t, request.expectCode, w.Code)
+				require.Equal(t, request.expectRemaining, w.Header().Get(ahttp.RateLimitRemainingHeader))
+				require.Equal(t, request.expectRetryAfter, w.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddlewareHeaders(t *testing.T) {
+	logger := quicklogmocks.NewMockLogger(t)
+	logger.On("Log", quicklog.LevelInfo, mock.Anything).Once()
+	logger.
+		On("Log", quicklog.LevelWarning, mock.Anything).
+		Run(func(args mock.Arguments) {
+			report := args.Get(1).(quicklog.Message).RenderJSON()
+			require.Equal(t, true, report["throttled"])
+		}).
+		Once()
+
+	router := gin.New()
+	router.Use(ahttp.ReportMiddleware(logger, ""))
+	router.Use(ahttp.RateLimitMiddleware(ahttp.RateLimitConfig{
+		Limit: ahttp.RateLimit{Requests: 10, Period: time.Minute, Burst: 1},
+	}))
+	router.GET("/foo", func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/foo", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "10", w.Header().Get(ahttp.RateLimitLimitHeader))
+	require.Equal(t, "0", w.Header().Get(ahttp.RateLimitRemainingHeader))
+	require.Equal(t, "6", w.Header().Get(ahttp.RateLimitResetHeader))
+	require.Equal(t, "10;w=60", w.Header().Get(ahttp.RateLimitPolicyHeader))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/foo", nil))
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "6", w.Header().Get("Retry-After"))
+
+	logger.AssertExpectations(t)
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	store := ahttp.NewMemoryRateLimitStore()
+	ctx := context.Background()
+
+	tat, err := store.Get(ctx, "foo")
+	require.NoError(t, err)
+	require.True(t, tat.IsZero())
+
+	first := time.Now().Add(time.Second)
+
+	swapped, err := store.CompareAndSwap(ctx, "foo", time.Time{}, first, time.Minute)
+	require.NoError(t, err)
+	require.True(t, swapped)
+
+	// The key was updated concurrently.
+	swapped, err = store.CompareAndSwap(ctx, "foo", time.Time{}, first.Add(time.Second), time.Minute)
+	require.NoError(t, err)
+	require.False(t, swapped)
+
+	tat, err = store.Get(ctx, "foo")
+	require.NoError(t, err)
+	require.True(t, first.Equal(tat))
+
+	// Expired keys are forgotten.
+	swapped, err = store.CompareAndSwap(ctx, "bar", time.Time{}, first, time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, swapped)
+
+	time.Sleep(5 * time.Millisecond)
+
+	tat, err = store.Get(ctx, "bar")
+	require.NoError(t, err)
+	require.True(t, tat.IsZero())
+}
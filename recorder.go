@@ -0,0 +1,74 @@
+package ahttp
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StoredResponse is a response recorded to be served again later.
+type StoredResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// write sends the stored response to w.
+func (response *StoredResponse) write(w http.ResponseWriter) {
+	header := w.Header()
+	for key, values := range response.Header {
+		header[key] = append([]string(nil), values...)
+	}
+
+	w.WriteHeader(response.Status)
+	_, _ = w.Write(response.Body)
+}
+
+// responseRecorder copies the response written through it. The headers are captured when the response is
+// committed, so headers added afterward by outer middlewares, such as Content-Encoding, are not recorded.
+type responseRecorder struct {
+	gin.ResponseWriter
+
+	header http.Header
+	body   bytes.Buffer
+}
+
+func newResponseRecorder(w gin.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w}
+}
+
+func (recorder *responseRecorder) commit() {
+	if recorder.header == nil {
+		recorder.header = recorder.Header().Clone()
+	}
+}
+
+func (recorder *responseRecorder) Write(data []byte) (int, error) {
+	recorder.commit()
+
+	n, err := recorder.ResponseWriter.Write(data)
+	recorder.body.Write(data[:n])
+
+	return n, err
+}
+
+func (recorder *responseRecorder) WriteString(data string) (int, error) {
+	return recorder.Write([]byte(data))
+}
+
+func (recorder *responseRecorder) WriteHeaderNow() {
+	recorder.commit()
+	recorder.ResponseWriter.WriteHeaderNow()
+}
+
+// response returns the recorded response.
+func (recorder *responseRecorder) response() *StoredResponse {
+	recorder.commit()
+
+	return &StoredResponse{
+		Status: recorder.Status(),
+		Header: recorder.header,
+		Body:   bytes.Clone(recorder.body.Bytes()),
+	}
+}
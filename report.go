@@ -1,6 +1,8 @@
 package ahttp
 
 import (
+	"context"
+	"errors"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -10,25 +12,84 @@ import (
 	ahttpmessages "github.com/a-novel-kit/ahttp/messages"
 )
 
+// Keys used by other middlewares to annotate the report of the current request.
+const (
+	reportTimedOutKey  = "ahttp.report.timedOut"
+	reportWebSocketKey = "ahttp.report.webSocket"
+	reportThrottledKey = "ahttp.report.throttled"
+	reportShedKey      = "ahttp.report.shed"
+	reportBodyLimitKey = "ahttp.report.bodyLimit"
+	reportCORSKey      = "ahttp.report.cors"
+
+	reportCompressionKey = "ahttp.report.compression"
+	reportCacheKey       = "ahttp.report.cache"
+	reportCoalescedKey   = "ahttp.report.coalesced"
+
+	reportAuthorizationKey = "ahttp.report.authorization"
+	reportRedactedQueryKey = "ahttp.report.redactedQuery"
+
+	reportHandlerDurationKey = "ahttp.report.handlerDuration"
+	reportRespondedAtKey     = "ahttp.report.respondedAt"
+)
+
 func ReportMiddleware(logger quicklog.Logger, projectID string) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		start := time.Now()
+
+		// Middlewares may replace the request context, so the one of the client is captured before.
+		clientCtx := ctx.Request.Context()
+
+		// Lets ReportTransport correlate outgoing requests with this one.
+		ctx.Request = ctx.Request.WithContext(newReportContext(ctx.Request.Context(), projectID, ctx.Request.Header))
+
 		ctx.Next()
 
-		level := quicklog.LevelInfo
-		if ctx.Writer.Status() >= 500 {
-			level = quicklog.LevelError
-		} else if ctx.Writer.Status() >= 400 {
-			level = quicklog.LevelWarning
-		}
-
-		logger.Log(level, ahttpmessages.NewReport(
-			&ahttpmessages.Metrics{
-				Latency:   time.Since(start),
-				StartedAt: start,
-			},
-			projectID,
-			ctx,
-		))
+		metrics := &ahttpmessages.Metrics{
+			Latency:   time.Since(start),
+			StartedAt: start,
+			TimedOut:  ctx.GetBool(reportTimedOutKey),
+			Throttled: ctx.GetBool(reportThrottledKey),
+			Shed:      ctx.GetBool(reportShedKey),
+			Cache:     ctx.GetString(reportCacheKey),
+			Coalesced: ctx.GetBool(reportCoalescedKey),
+
+			CORSRejected:  ctx.GetString(reportCORSKey),
+			RedactedQuery: ctx.GetStringSlice(reportRedactedQueryKey),
+		}
+
+		// The response may have been sent before the handler returned, for example after a timeout.
+		if respondedAt, ok := ctx.Get(reportRespondedAtKey); ok {
+			metrics.Latency = respondedAt.(time.Time).Sub(start)
+		}
+
+		if handlerDuration, ok := ctx.Get(reportHandlerDurationKey); ok {
+			metrics.HandlerDuration = handlerDuration.(time.Duration)
+		}
+
+		if bodyLimit, ok := ctx.Get(reportBodyLimitKey); ok {
+			metrics.BodyLimit = bodyLimit.(int64)
+		}
+
+		if principal, ok := ctx.Get(PrincipalKey); ok {
+			metrics.Subject = principal.(*Principal).Subject
+		}
+
+		if authorization, ok := ctx.Get(reportAuthorizationKey); ok {
+			metrics.Authorization = authorization.(*ahttpmessages.AuthorizationMetrics)
+		}
+
+		if compression, ok := ctx.Get(reportCompressionKey); ok {
+			metrics.Compression = compression.(*ahttpmessages.CompressionMetrics)
+		}
+
+		if webSocket, ok := ctx.Get(reportWebSocketKey); ok {
+			metrics.WebSocket = webSocket.(*ahttpmessages.WebSocketMetrics)
+		}
+
+		// The server cancels the request context when the client disconnects. Otherwise, it is only canceled once
+		// the handler returns, which did not happen yet. WebSocket connections report their own close code.
+		metrics.ClientClosed = metrics.WebSocket == nil && errors.Is(clientCtx.Err(), context.Canceled)
+
+		logger.Log(ahttpmessages.ReportLevel(metrics, ctx), ahttpmessages.NewReport(metrics, projectID, ctx))
 	}
 }
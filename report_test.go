@@ -1,12 +1,14 @@
 package ahttp_test
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
 	"github.com/a-novel-kit/quicklog"
 	quicklogmocks "github.com/a-novel-kit/quicklog/mocks"
@@ -18,7 +20,8 @@ func TestReport(t *testing.T) {
 	testCases := []struct {
 		name string
 
-		status int
+		status       int
+		clientClosed bool
 
 		expectLevel quicklog.Level
 	}{
@@ -43,6 +46,22 @@ func TestReport(t *testing.T) {
 
 			expectLevel: quicklog.LevelError,
 		},
+		{
+			name: "ClientClosed",
+
+			status:       http.StatusOK,
+			clientClosed: true,
+
+			expectLevel: quicklog.LevelInfo,
+		},
+		{
+			name: "ClientClosed/ServerError",
+
+			status:       http.StatusInternalServerError,
+			clientClosed: true,
+
+			expectLevel: quicklog.LevelWarning,
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -52,8 +71,29 @@ func TestReport(t *testing.T) {
 			ctx.Request = httptest.NewRequest(http.MethodGet, "/foo", nil)
 			ctx.Writer.WriteHeader(testCase.status)
 
+			if testCase.clientClosed {
+				reqCtx, cancel := context.WithCancel(ctx.Request.Context())
+				cancel()
+
+				ctx.Request = ctx.Request.WithContext(reqCtx)
+			}
+
 			logger := quicklogmocks.NewMockLogger(t)
-			logger.On("Log", testCase.expectLevel, mock.Anything).Once()
+			logger.
+				On("Log", testCase.expectLevel, mock.Anything).
+				Run(func(args mock.Arguments) {
+					report := args.Get(1).(quicklog.Message).RenderJSON()
+
+					if !testCase.clientClosed {
+						require.NotContains(t, report, "clientClosed")
+						return
+					}
+
+					require.Equal(t, true, report["clientClosed"])
+					require.Equal(t, testCase.status, report["handlerStatus"])
+					require.Equal(t, 499, report["httpRequest"].(map[string]interface{})["status"])
+				}).
+				Once()
 
 			middleware := ahttp.ReportMiddleware(logger, "hello-world")
 			middleware(ctx)
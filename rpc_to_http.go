@@ -1,11 +1,18 @@
 package ahttp
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 var rpcToHTTPCodes = map[codes.Code]int{
@@ -34,19 +41,191 @@ func GRPCToHTTPCode(code codes.Code) int {
 	return http.StatusInternalServerError
 }
 
+// Reverse of rpcToHTTPCodes. Statuses shared by several codes map to the most common one.
+var httpToRPCCodes = map[int]codes.Code{
+	http.StatusOK:                  codes.OK,
+	499:                            codes.Canceled,
+	http.StatusBadRequest:          codes.FailedPrecondition,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusRequestTimeout:      codes.DeadlineExceeded,
+	http.StatusConflict:            codes.AlreadyExists,
+	http.StatusUnprocessableEntity: codes.InvalidArgument,
+	http.StatusTooManyRequests:     codes.ResourceExhausted,
+	http.StatusInternalServerError: codes.Internal,
+	http.StatusNotImplemented:      codes.Unimplemented,
+	http.StatusBadGateway:          codes.Unavailable,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusGatewayTimeout:      codes.DeadlineExceeded,
+}
+
+// HTTPToGRPCCode is the reverse of GRPCToHTTPCode. Any successful status maps to codes.OK.
+func HTTPToGRPCCode(status int) codes.Code {
+	if c, ok := httpToRPCCodes[status]; ok {
+		return c
+	}
+
+	if status >= 200 && status < 400 {
+		return codes.OK
+	}
+
+	return codes.Unknown
+}
+
+// statusFromError converts an error to a gRPC status. Context errors are not status errors, but they still map
+// to a meaningful code.
+func statusFromError(err error) (*status.Status, bool) {
+	if grpcStatus, ok := status.FromError(err); ok {
+		return grpcStatus, true
+	}
+
+	grpcStatus := status.FromContextError(err)
+
+	return grpcStatus, grpcStatus.Code() != codes.Unknown
+}
+
+// statusWithRetryDelay returns a status error that tells the client when to retry.
+func statusWithRetryDelay(code codes.Code, message string, delay time.Duration) error {
+	grpcStatus, err := status.New(code, message).WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)})
+	if err != nil {
+		return status.Error(code, message)
+	}
+
+	return grpcStatus.Err()
+}
+
+// formatSeconds formats a duration as a number of seconds, rounded up, for use in headers such as Retry-After.
+func formatSeconds(duration time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(max(duration, 0).Seconds())))
+}
+
+// retryDelay returns the delay of the RetryInfo details of a status, if any.
+func retryDelay(grpcStatus *status.Status) (time.Duration, bool) {
+	for _, detail := range grpcStatus.Details() {
+		if retryInfo, ok := detail.(*errdetails.RetryInfo); ok && retryInfo.GetRetryDelay() != nil {
+			return retryInfo.GetRetryDelay().AsDuration(), true
+		}
+	}
+
+	return 0, false
+}
+
+// errorMappersKey is the gin key of the mappers set by ErrorMappersMiddleware.
+const errorMappersKey = "ahttp.errorMappers"
+
 // HandleGRPCError handles errors returned by a GRPC service. It returns a boolean indicating
 // whether the context was terminated.
+//
+// It only sets the status of the response, and leaves the body to the caller. Use HandleGRPCErrorProblem to
+// respond with a problem body. Behind CacheMiddleware, Unavailable and DeadlineExceeded errors may be answered
+// with a stale response instead.
 func HandleGRPCError(ctx *gin.Context, err error) bool {
 	if err == nil {
 		return false
 	}
 
-	grpcCode, ok := status.FromError(err)
+	grpcCode, ok := statusFromError(err)
 	if !ok {
 		_ = ctx.AbortWithError(http.StatusInternalServerError, err)
 		return true
 	}
 
+	// A cached response is better than an error, when the failure is transient.
+	if serveStaleResponse(ctx, grpcCode.Code()) {
+		_ = ctx.Error(grpcCode.Err())
+		ctx.Abort()
+
+		return true
+	}
+
+	// Statuses carrying RetryInfo details, such as those of an open circuit, tell the client when to retry.
+	if delay, ok := retryDelay(grpcCode); ok {
+		ctx.Header("Retry-After", formatSeconds(delay))
+	}
+
 	_ = ctx.AbortWithError(GRPCToHTTPCode(grpcCode.Code()), grpcCode.Err())
+
+	return true
+}
+
+// ErrorMapper customizes the response of HandleGRPCErrorProblem to an error. It may update the problem built from
+// the error, including its status, and set response headers. It may also write a response of its own, and report
+// it, in which case the problem is not written.
+type ErrorMapper func(ctx *gin.Context, err error, problem *Problem) (responded bool)
+
+// ErrorMappersMiddleware sets the mappers run by HandleGRPCErrorProblem, in order, on the routes it is attached to.
+// Mappers set on a group run after those of its parents.
+func ErrorMappersMiddleware(mappers ...ErrorMapper) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		value, _ := ctx.Get(errorMappersKey)
+		parentMappers, _ := value.([]ErrorMapper)
+
+		ctx.Set(errorMappersKey, append(slices.Clip(parentMappers), mappers...))
+		ctx.Next()
+	}
+}
+
+// HandleGRPCErrorProblem handles errors returned by a GRPC service, and responds with a Problem body, with the
+// message and details of the status. It returns a boolean indicating whether the context was terminated.
+//
+// Errors that are not statuses respond with a bare 500 problem, so internal messages are not leaked. Request
+// bodies over their limit (see http.MaxBytesError) respond with a 413. Behind CacheMiddleware, Unavailable and
+// DeadlineExceeded errors may be answered with a stale response instead. Etag mismatches (see IsETagMismatch)
+// respond with a 412. The problem is then customized by the mappers of ErrorMappersMiddleware.
+func HandleGRPCErrorProblem(ctx *gin.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var (
+		problem     *Problem
+		reportedErr = err
+		maxBytesErr *http.MaxBytesError
+	)
+
+	grpcCode, ok := statusFromError(err)
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		problem = newBodyLimitProblem(maxBytesErr.Limit)
+	case !ok:
+		problem = newProblem(http.StatusInternalServerError, "")
+	default:
+		reportedErr = grpcCode.Err()
+
+		// A cached response is better than an error, when the failure is transient.
+		if serveStaleResponse(ctx, grpcCode.Code()) {
+			_ = ctx.Error(reportedErr)
+			ctx.Abort()
+
+			return true
+		}
+
+		// Statuses carrying RetryInfo details, such as those of an open circuit, tell the client when to retry.
+		if delay, ok := retryDelay(grpcCode); ok {
+			ctx.Header("Retry-After", formatSeconds(delay))
+		}
+
+		problem = problemFromStatus(grpcCode)
+		if IsETagMismatch(err) {
+			problem = etagMismatchProblem(grpcCode)
+		}
+	}
+
+	value, _ := ctx.Get(errorMappersKey)
+	mappers, _ := value.([]ErrorMapper)
+
+	for _, mapper := range mappers {
+		if mapper(ctx, err, problem) {
+			_ = ctx.Error(reportedErr)
+			ctx.Abort()
+
+			return true
+		}
+	}
+
+	abortWithProblem(ctx, problem, reportedErr)
+
 	return true
 }
@@ -1,14 +1,20 @@
 package ahttp_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 
 	testutils "github.com/a-novel-kit/test-utils"
 
@@ -104,14 +110,50 @@ func TestGRPCToHTTPCode(t *testing.T) {
 	}
 }
 
+func TestHTTPToGRPCCode(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		in int
+
+		expect codes.Code
+	}{
+		{name: "OK", in: 200, expect: codes.OK},
+		{name: "Created", in: 201, expect: codes.OK},
+		{name: "Redirect", in: 302, expect: codes.OK},
+		{name: "Canceled", in: 499, expect: codes.Canceled},
+		{name: "BadRequest", in: 400, expect: codes.FailedPrecondition},
+		{name: "Unauthorized", in: 401, expect: codes.Unauthenticated},
+		{name: "Forbidden", in: 403, expect: codes.PermissionDenied},
+		{name: "NotFound", in: 404, expect: codes.NotFound},
+		{name: "RequestTimeout", in: 408, expect: codes.DeadlineExceeded},
+		{name: "Conflict", in: 409, expect: codes.AlreadyExists},
+		{name: "UnprocessableEntity", in: 422, expect: codes.InvalidArgument},
+		{name: "TooManyRequests", in: 429, expect: codes.ResourceExhausted},
+		{name: "InternalServerError", in: 500, expect: codes.Internal},
+		{name: "NotImplemented", in: 501, expect: codes.Unimplemented},
+		{name: "BadGateway", in: 502, expect: codes.Unavailable},
+		{name: "ServiceUnavailable", in: 503, expect: codes.Unavailable},
+		{name: "GatewayTimeout", in: 504, expect: codes.DeadlineExceeded},
+		{name: "Default", in: 418, expect: codes.Unknown},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.expect, ahttp.HTTPToGRPCCode(testCase.in))
+		})
+	}
+}
+
 func TestHandleGRPCError(t *testing.T) {
 	testCases := []struct {
 		name string
 
 		err error
 
-		expect     bool
-		expectCode int
+		expect           bool
+		expectCode       int
+		expectRetryAfter string
 	}{
 		{
 			name: "NilError",
@@ -135,6 +177,55 @@ func TestHandleGRPCError(t *testing.T) {
 			expect:     true,
 			expectCode: http.StatusNotFound,
 		},
+		{
+			name: "ContextError",
+
+			err: fmt.Errorf("call backend: %w", context.DeadlineExceeded),
+
+			expect:     true,
+			expectCode: http.StatusGatewayTimeout,
+		},
+		{
+			name: "RetryInfo",
+
+			err: func() error {
+				grpcStatus, err := status.New(codes.Unavailable, "foo").WithDetails(&errdetails.RetryInfo{
+					RetryDelay: durationpb.New(1500 * time.Millisecond),
+				})
+				require.NoError(t, err)
+
+				return grpcStatus.Err()
+			}(),
+
+			expect:           true,
+			expectCode:       http.StatusServiceUnavailable,
+			expectRetryAfter: "2",
+		},
+		{
+			name: "MaxBytesError",
+
+			err: fmt.Errorf("read body: %w", &http.MaxBytesError{Limit: 1024}),
+
+			expect: true,
+			// Only HandleGRPCErrorProblem knows about body limits.
+			expectCode: http.StatusInternalServerError,
+		},
+		{
+			name: "ETagMismatch",
+
+			err: func() error {
+				grpcStatus, err := status.New(codes.Aborted, "etag mismatch").WithDetails(&errdetails.ErrorInfo{
+					Reason: ahttp.ETagMismatchReason,
+				})
+				require.NoError(t, err)
+
+				return grpcStatus.Err()
+			}(),
+
+			expect: true,
+			// Only HandleGRPCErrorProblem maps etag mismatches.
+			expectCode: http.StatusInternalServerError,
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -146,6 +237,245 @@ func TestHandleGRPCError(t *testing.T) {
 			ok := ahttp.HandleGRPCError(ctx, testCase.err)
 			require.Equal(t, testCase.expect, ok)
 			require.Equal(t, testCase.expectCode, w.Code)
+			require.Equal(t, testCase.expectRetryAfter, w.Header().Get("Retry-After"))
+
+			// The body is left to the caller.
+			require.Empty(t, w.Body.String())
+		})
+	}
+}
+
+func TestHandleGRPCErrorProblem(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		err error
+
+		expect           bool
+		expectCode       int
+		expectRetryAfter string
+		expectBody       string
+	}{
+		{
+			name: "NilError",
+
+			expect:     false,
+			expectCode: http.StatusOK,
+		},
+		{
+			name: "NilStatus",
+
+			err: testutils.ErrDummy,
+
+			expect:     true,
+			expectCode: http.StatusInternalServerError,
+			// The message of the error is not leaked.
+			expectBody: `{"title":"Internal Server Error","status":500,"code":"Internal"}`,
+		},
+		{
+			name: "StatusError",
+
+			err: status.Error(codes.NotFound, "foo"),
+
+			expect:     true,
+			expectCode: http.StatusNotFound,
+			expectBody: `{"title":"Not Found","status":404,"detail":"foo","code":"NotFound"}`,
+		},
+		{
+			name: "ContextError",
+
+			err: fmt.Errorf("call backend: %w", context.DeadlineExceeded),
+
+			expect:     true,
+			expectCode: http.StatusGatewayTimeout,
+		},
+		{
+			name: "RetryInfo",
+
+			err: func() error {
+				grpcStatus, err := status.New(codes.Unavailable, "foo").WithDetails(&errdetails.RetryInfo{
+					RetryDelay: durationpb.New(1500 * time.Millisecond),
+				})
+				require.NoError(t, err)
+
+				return grpcStatus.Err()
+			}(),
+
+			expect:           true,
+			expectCode:       http.StatusServiceUnavailable,
+			expectRetryAfter: "2",
+			expectBody: `{
+				"title": "Service Unavailable",
+				"status": 503,
+				"detail": "foo",
+				"code": "Unavailable",
+				"details": [{"@type": "type.googleapis.com/google.rpc.RetryInfo", "retryDelay": "1.500s"}]
+			}`,
+		},
+		{
+			name: "MaxBytesError",
+
+			err: fmt.Errorf("read body: %w", &http.MaxBytesError{Limit: 1024}),
+
+			expect:     true,
+			expectCode: http.StatusRequestEntityTooLarge,
+			expectBody: `{"title":"Request Entity Too Large","status":413,"detail":"request body exceeds 1024 bytes"}`,
+		},
+		{
+			name: "ETagMismatch",
+
+			err: func() error {
+				grpcStatus, err := status.New(codes.Aborted, "etag mismatch").WithDetails(&errdetails.ErrorInfo{
+					Reason: ahttp.ETagMismatchReason,
+				})
+				require.NoError(t, err)
+
+				return grpcStatus.Err()
+			}(),
+
+			expect:     true,
+			expectCode: http.StatusPreconditionFailed,
+			expectBody: `{
+				"title": "Precondition Failed",
+				"status": 412,
+				"detail": "etag mismatch",
+				"code": "Aborted",
+				"details": [{"@type": "type.googleapis.com/google.rpc.ErrorInfo", "reason": "ETAG_MISMATCH"}]
+			}`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodGet, "/foo", nil)
+
+			ok := ahttp.HandleGRPCErrorProblem(ctx, testCase.err)
+			require.Equal(t, testCase.expect, ok)
+			require.Equal(t, testCase.expectCode, w.Code)
+			require.Equal(t, testCase.expectRetryAfter, w.Header().Get("Retry-After"))
+
+			if testCase.expectBody != "" {
+				require.Equal(t, ahttp.ContentTypeProblem, w.Header().Get("Content-Type"))
+				require.JSONEq(t, testCase.expectBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestErrorMappersMiddleware(t *testing.T) {
+	errLocked := errors.New("resource locked")
+
+	lockedMapper := func(_ *gin.Context, err error, problem *ahttp.Problem) bool {
+		if errors.Is(err, errLocked) {
+			problem.Status = http.StatusLocked
+			problem.Title = http.StatusText(http.StatusLocked)
+			problem.Detail = errLocked.Error()
+			problem.Code = ""
+		}
+
+		return false
+	}
+
+	teapotMapper := func(ctx *gin.Context, err error, _ *ahttp.Problem) bool {
+		if errors.Is(err, testutils.ErrDummy) {
+			ctx.String(http.StatusTeapot, "custom")
+			return true
+		}
+
+		return false
+	}
+
+	testCases := []struct {
+		name string
+
+		path string
+		err  error
+
+		expectCode int
+		expectBody string
+	}{
+		{
+			name: "UpdatedProblem",
+
+			path: "/api/foo",
+			err:  fmt.Errorf("update: %w", errLocked),
+
+			expectCode: http.StatusLocked,
+			expectBody: `{"title":"Locked","status":423,"detail":"resource locked"}`,
+		},
+		{
+			name: "CustomResponse",
+
+			path: "/api/custom/foo",
+			err:  testutils.ErrDummy,
+
+			expectCode: http.StatusTeapot,
+			expectBody: "custom",
+		},
+		{
+			name: "ParentMapper",
+
+			path: "/api/custom/foo",
+			err:  fmt.Errorf("update: %w", errLocked),
+
+			expectCode: http.StatusLocked,
+			expectBody: `{"title":"Locked","status":423,"detail":"resource locked"}`,
+		},
+		{
+			name: "ChildMapper",
+
+			path: "/api/foo",
+			err:  testutils.ErrDummy,
+
+			expectCode: http.StatusInternalServerError,
+			expectBody: `{"title":"Internal Server Error","status":500,"code":"Internal"}`,
+		},
+		{
+			name: "NoMappers",
+
+			path: "/foo",
+			err:  fmt.Errorf("update: %w", errLocked),
+
+			expectCode: http.StatusInternalServerError,
+			expectBody: `{"title":"Internal Server Error","status":500,"code":"Internal"}`,
+		},
+		{
+			name: "Unmapped",
+
+			path: "/api/foo",
+			err:  status.Error(codes.NotFound, "foo"),
+
+			expectCode: http.StatusNotFound,
+			expectBody: `{"title":"Not Found","status":404,"detail":"foo","code":"NotFound"}`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var handlerErrors []string
+
+			handler := func(ctx *gin.Context) {
+				require.True(t, ahttp.HandleGRPCErrorProblem(ctx, testCase.err))
+				require.True(t, ctx.IsAborted())
+
+				handlerErrors = ctx.Errors.Errors()
+			}
+
+			router := gin.New()
+			router.GET("/foo", handler)
+
+			api := router.Group("/api", ahttp.ErrorMappersMiddleware(lockedMapper))
+			api.GET("/foo", handler)
+			api.Group("/custom", ahttp.ErrorMappersMiddleware(teapotMapper)).GET("/foo", handler)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, testCase.path, nil))
+
+			require.Equal(t, testCase.expectCode, w.Code)
+			require.Equal(t, testCase.expectBody, w.Body.String())
+			require.Len(t, handlerErrors, 1)
 		})
 	}
 }
@@ -0,0 +1,120 @@
+package ahttp
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// CSPNonceKey is the gin key of the nonce of the Content-Security-Policy of a request. See CSPNonce.
+	CSPNonceKey = "ahttp.cspNonce"
+	// CSPNoncePlaceholder is replaced with the nonce of each request, in SecurityHeadersConfig.ContentSecurityPolicy.
+	CSPNoncePlaceholder = "{nonce}"
+)
+
+type SecurityHeadersConfig struct {
+	// HSTSMaxAge is the max-age of the Strict-Transport-Security header. The header is omitted when zero.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+
+	// ContentSecurityPolicy may use CSPNoncePlaceholder, for example "script-src 'self' 'nonce-{nonce}'".
+	ContentSecurityPolicy string
+	// CSPReportOnly sends the policy in the Content-Security-Policy-Report-Only header instead, so violations are
+	// reported but not blocked.
+	CSPReportOnly bool
+
+	ReferrerPolicy            string
+	PermissionsPolicy         string
+	CrossOriginOpenerPolicy   string
+	CrossOriginEmbedderPolicy string
+}
+
+// DefaultSecurityHeadersConfig is a strict configuration for APIs, which do not serve documents.
+var DefaultSecurityHeadersConfig = SecurityHeadersConfig{
+	HSTSMaxAge:                365 * 24 * time.Hour,
+	HSTSIncludeSubdomains:     true,
+	ContentSecurityPolicy:     "default-src 'none'; frame-ancestors 'none'",
+	ReferrerPolicy:            "no-referrer",
+	PermissionsPolicy:         "camera=(), geolocation=(), microphone=()",
+	CrossOriginOpenerPolicy:   "same-origin",
+	CrossOriginEmbedderPolicy: "require-corp",
+}
+
+// CSPNonce returns the nonce of the Content-Security-Policy of the request, set by SecurityHeadersMiddleware when
+// the policy uses CSPNoncePlaceholder. Templates use it in the nonce attribute of their inline scripts and styles.
+func CSPNonce(ctx *gin.Context) string {
+	return ctx.GetString(CSPNonceKey)
+}
+
+func newCSPNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(nonce), nil
+}
+
+// SecurityHeadersMiddleware sets security headers on every response. X-Content-Type-Options is always set to
+// "nosniff", other headers are omitted when their configuration is empty.
+func SecurityHeadersMiddleware(config SecurityHeadersConfig) gin.HandlerFunc {
+	hsts := ""
+	if config.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(config.HSTSMaxAge.Seconds()))
+
+		if config.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+
+		if config.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+
+	cspHeader := "Content-Security-Policy"
+	if config.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+
+	headers := map[string]string{
+		"Strict-Transport-Security":    hsts,
+		"Referrer-Policy":              config.ReferrerPolicy,
+		"Permissions-Policy":           config.PermissionsPolicy,
+		"Cross-Origin-Opener-Policy":   config.CrossOriginOpenerPolicy,
+		"Cross-Origin-Embedder-Policy": config.CrossOriginEmbedderPolicy,
+	}
+
+	return func(ctx *gin.Context) {
+		ctx.Header("X-Content-Type-Options", "nosniff")
+
+		for name, value := range headers {
+			if value != "" {
+				ctx.Header(name, value)
+			}
+		}
+
+		csp := config.ContentSecurityPolicy
+		if strings.Contains(csp, CSPNoncePlaceholder) {
+			nonce, err := newCSPNonce()
+			if err != nil {
+				HandleGRPCErrorProblem(ctx, err)
+				return
+			}
+
+			ctx.Set(CSPNonceKey, nonce)
+			csp = strings.ReplaceAll(csp, CSPNoncePlaceholder, nonce)
+		}
+
+		if csp != "" {
+			ctx.Header(cspHeader, csp)
+		}
+
+		ctx.Next()
+	}
+}
@@ -0,0 +1,130 @@
+package ahttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		config ahttp.SecurityHeadersConfig
+
+		expectHeaders map[string]string
+	}{
+		{
+			name: "Default",
+
+			config: ahttp.DefaultSecurityHeadersConfig,
+
+			expectHeaders: map[string]string{
+				"X-Content-Type-Options":       "nosniff",
+				"Strict-Transport-Security":    "max-age=31536000; includeSubDomains",
+				"Content-Security-Policy":      "default-src 'none'; frame-ancestors 'none'",
+				"Referrer-Policy":              "no-referrer",
+				"Permissions-Policy":           "camera=(), geolocation=(), microphone=()",
+				"Cross-Origin-Opener-Policy":   "same-origin",
+				"Cross-Origin-Embedder-Policy": "require-corp",
+			},
+		},
+		{
+			name: "Empty",
+
+			expectHeaders: map[string]string{
+				"X-Content-Type-Options":       "nosniff",
+				"Strict-Transport-Security":    "",
+				"Content-Security-Policy":      "",
+				"Referrer-Policy":              "",
+				"Permissions-Policy":           "",
+				"Cross-Origin-Opener-Policy":   "",
+				"Cross-Origin-Embedder-Policy": "",
+			},
+		},
+		{
+			name: "HSTSPreload",
+
+			config: ahttp.SecurityHeadersConfig{
+				HSTSMaxAge:            2 * time.Hour,
+				HSTSIncludeSubdomains: true,
+				HSTSPreload:           true,
+			},
+
+			expectHeaders: map[string]string{
+				"Strict-Transport-Security": "max-age=7200; includeSubDomains; preload",
+			},
+		},
+		{
+			name: "CSPReportOnly",
+
+			config: ahttp.SecurityHeadersConfig{
+				ContentSecurityPolicy: "default-src 'self'",
+				CSPReportOnly:         true,
+			},
+
+			expectHeaders: map[string]string{
+				"Content-Security-Policy":             "",
+				"Content-Security-Policy-Report-Only": "default-src 'self'",
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(ahttp.SecurityHeadersMiddleware(testCase.config))
+			router.GET("/foo", func(ctx *gin.Context) {
+				ctx.String(http.StatusOK, ahttp.CSPNonce(ctx))
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/foo", nil))
+
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Empty(t, w.Body.String())
+
+			for key, value := range testCase.expectHeaders {
+				require.Equal(t, value, w.Header().Get(key), key)
+			}
+		})
+	}
+}
+
+func TestSecurityHeadersMiddlewareNonce(t *testing.T) {
+	router := gin.New()
+	router.Use(ahttp.SecurityHeadersMiddleware(ahttp.SecurityHeadersConfig{
+		ContentSecurityPolicy: "script-src 'self' 'nonce-" + ahttp.CSPNoncePlaceholder + "'; " +
+			"style-src 'nonce-" + ahttp.CSPNoncePlaceholder + "'",
+	}))
+	router.GET("/foo", func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, ahttp.CSPNonce(ctx))
+	})
+
+	nonces := make(map[string]bool)
+
+	for range 3 {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/foo", nil))
+
+		require.Equal(t, http.StatusOK, w.Code)
+
+		nonce := w.Body.String()
+		require.NotEmpty(t, nonce)
+		require.False(t, nonces[nonce], "nonce reused")
+		nonces[nonce] = true
+
+		require.Equal(
+			t,
+			"script-src 'self' 'nonce-"+nonce+"'; style-src 'nonce-"+nonce+"'",
+			w.Header().Get("Content-Security-Policy"),
+		)
+		require.NotContains(t, w.Header().Get("Content-Security-Policy"), ahttp.CSPNoncePlaceholder)
+	}
+}
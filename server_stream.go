@@ -0,0 +1,217 @@
+package ahttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	ContentTypeSSE    = "text/event-stream"
+	ContentTypeNDJSON = "application/x-ndjson"
+)
+
+// DefaultStreamHeartbeat is a reasonable heartbeat interval for ForwardServerStream. It keeps most proxies from
+// closing idle connections.
+const DefaultStreamHeartbeat = 15 * time.Second
+
+// streamError is the payload of the terminal error event of a stream.
+type streamError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Status  int    `json:"status"`
+}
+
+// marshalStreamMessage encodes a stream message as single-line JSON. Protobuf messages use the protojson mapping.
+func marshalStreamMessage(msg any) ([]byte, error) {
+	if protoMsg, ok := msg.(proto.Message); ok {
+		return protojson.Marshal(protoMsg)
+	}
+
+	return json.Marshal(msg)
+}
+
+type streamWriter struct {
+	ctx *gin.Context
+	sse bool
+
+	started bool
+}
+
+func (writer *streamWriter) start() {
+	if writer.started {
+		return
+	}
+
+	writer.started = true
+
+	header := writer.ctx.Writer.Header()
+	header.Set("Cache-Control", "no-cache")
+	// Prevents reverse proxies such as nginx from buffering the response.
+	header.Set("X-Accel-Buffering", "no")
+
+	if writer.sse {
+		header.Set("Content-Type", ContentTypeSSE)
+	} else {
+		header.Set("Content-Type", ContentTypeNDJSON)
+	}
+
+	writer.ctx.Writer.WriteHeader(http.StatusOK)
+}
+
+func (writer *streamWriter) write(event string, data []byte) error {
+	writer.start()
+
+	var err error
+
+	switch {
+	case !writer.sse:
+		_, err = fmt.Fprintf(writer.ctx.Writer, "%s\n", data)
+	case event != "":
+		_, err = fmt.Fprintf(writer.ctx.Writer, "event: %s\ndata: %s\n\n", event, data)
+	default:
+		_, err = fmt.Fprintf(writer.ctx.Writer, "data: %s\n\n", data)
+	}
+
+	writer.ctx.Writer.Flush()
+
+	return err
+}
+
+func (writer *streamWriter) heartbeat() error {
+	writer.start()
+
+	var err error
+	if writer.sse {
+		_, err = io.WriteString(writer.ctx.Writer, ": heartbeat\n\n")
+	} else {
+		// Clients must ignore empty lines.
+		_, err = io.WriteString(writer.ctx.Writer, "\n")
+	}
+
+	writer.ctx.Writer.Flush()
+
+	return err
+}
+
+// fail terminates the stream with an error.
+func (writer *streamWriter) fail(err error) {
+	if !writer.started {
+		HandleGRPCErrorProblem(writer.ctx, err)
+		return
+	}
+
+	_ = writer.ctx.Error(err)
+	_ = writer.writeError(err)
+}
+
+func (writer *streamWriter) writeError(err error) error {
+	grpcStatus, _ := statusFromError(err)
+
+	payload := streamError{
+		Code:    grpcStatus.Code().String(),
+		Message: grpcStatus.Message(),
+		Status:  GRPCToHTTPCode(grpcStatus.Code()),
+	}
+
+	if writer.sse {
+		data, _ := json.Marshal(payload)
+		return writer.write("error", data)
+	}
+
+	data, _ := json.Marshal(map[string]streamError{"error": payload})
+
+	return writer.write("", data)
+}
+
+type streamResult[T any] struct {
+	msg *T
+	err error
+}
+
+// ForwardServerStream streams the messages of a server-streaming RPC to the HTTP client, either as Server-Sent
+// Events or as newline-delimited JSON, depending on the Accept header (NDJSON by default).
+//
+// Each message is flushed as soon as it is received. A heartbeat is sent every heartbeat interval while the
+// stream is idle; a zero value disables it. The stream must be opened with ctx.Request.Context(), so it is
+// cancelled when the client disconnects.
+//
+// If the stream fails before anything was written, the error is handled by HandleGRPCErrorProblem. Otherwise, the
+// HTTP status has already been sent, so the error is written as a terminal error event instead.
+//
+// The error that ended the stream is returned, or nil if the stream completed normally.
+func ForwardServerStream[T any](ctx *gin.Context, stream grpc.ServerStreamingClient[T], heartbeat time.Duration) error {
+	writer := &streamWriter{
+		ctx: ctx,
+		sse: ctx.NegotiateFormat(ContentTypeNDJSON, ContentTypeSSE) == ContentTypeSSE,
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	results := make(chan streamResult[T])
+
+	go func() {
+		for {
+			msg, err := stream.Recv()
+
+			select {
+			case results <- streamResult[T]{msg: msg, err: err}:
+			case <-done:
+				return
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var ticks <-chan time.Time
+
+	if heartbeat > 0 {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		ticks = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return ctx.Request.Context().Err()
+		case <-ticks:
+			if err := writer.heartbeat(); err != nil {
+				return err
+			}
+		case result := <-results:
+			if errors.Is(result.err, io.EOF) {
+				writer.start()
+				return nil
+			}
+
+			if result.err != nil {
+				writer.fail(result.err)
+				return result.err
+			}
+
+			data, err := marshalStreamMessage(result.msg)
+			if err != nil {
+				writer.fail(err)
+				return err
+			}
+
+			if err := writer.write("", data); err != nil {
+				return err
+			}
+		}
+	}
+}
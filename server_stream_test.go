@@ -0,0 +1,171 @@
+package ahttp_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+type fakeServerStream[T any] struct {
+	grpc.ClientStream
+
+	delay    time.Duration
+	messages []*T
+	err      error
+}
+
+func (stream *fakeServerStream[T]) Recv() (*T, error) {
+	time.Sleep(stream.delay)
+	stream.delay = 0
+
+	if len(stream.messages) == 0 {
+		if stream.err != nil {
+			return nil, stream.err
+		}
+
+		return nil, io.EOF
+	}
+
+	msg := stream.messages[0]
+	stream.messages = stream.messages[1:]
+
+	return msg, nil
+}
+
+func TestForwardServerStream(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		accept    string
+		heartbeat time.Duration
+		stream    *fakeServerStream[wrapperspb.StringValue]
+
+		expect            string
+		expectContains    string
+		expectContentType string
+		expectCode        int
+		expectErr         bool
+	}{
+		{
+			name: "NDJSON",
+
+			stream: &fakeServerStream[wrapperspb.StringValue]{
+				messages: []*wrapperspb.StringValue{wrapperspb.String("foo"), wrapperspb.String("bar")},
+			},
+
+			expect:            "\"foo\"\n\"bar\"\n",
+			expectContentType: ahttp.ContentTypeNDJSON,
+			expectCode:        http.StatusOK,
+		},
+		{
+			name: "SSE",
+
+			accept: "text/event-stream",
+			stream: &fakeServerStream[wrapperspb.StringValue]{
+				messages: []*wrapperspb.StringValue{wrapperspb.String("foo"), wrapperspb.String("bar")},
+			},
+
+			expect:            "data: \"foo\"\n\ndata: \"bar\"\n\n",
+			expectContentType: ahttp.ContentTypeSSE,
+			expectCode:        http.StatusOK,
+		},
+		{
+			name: "Empty",
+
+			stream: &fakeServerStream[wrapperspb.StringValue]{},
+
+			expectContentType: ahttp.ContentTypeNDJSON,
+			expectCode:        http.StatusOK,
+		},
+		{
+			name: "ErrorBeforeFirstMessage",
+
+			stream: &fakeServerStream[wrapperspb.StringValue]{
+				err: status.Error(codes.NotFound, "not found"),
+			},
+
+			expectContentType: ahttp.ContentTypeProblem,
+			expectCode:        http.StatusNotFound,
+			expectErr:         true,
+		},
+		{
+			name: "MidStreamError/NDJSON",
+
+			stream: &fakeServerStream[wrapperspb.StringValue]{
+				messages: []*wrapperspb.StringValue{wrapperspb.String("foo")},
+				err:      status.Error(codes.Unavailable, "gone"),
+			},
+
+			expect: "\"foo\"\n" +
+				"{\"error\":{\"code\":\"Unavailable\",\"message\":\"gone\",\"status\":503}}\n",
+			expectContentType: ahttp.ContentTypeNDJSON,
+			expectCode:        http.StatusOK,
+			expectErr:         true,
+		},
+		{
+			name: "MidStreamError/SSE",
+
+			accept: "text/event-stream",
+			stream: &fakeServerStream[wrapperspb.StringValue]{
+				messages: []*wrapperspb.StringValue{wrapperspb.String("foo")},
+				err:      status.Error(codes.Unavailable, "gone"),
+			},
+
+			expect: "data: \"foo\"\n\n" +
+				"event: error\ndata: {\"code\":\"Unavailable\",\"message\":\"gone\",\"status\":503}\n\n",
+			expectContentType: ahttp.ContentTypeSSE,
+			expectCode:        http.StatusOK,
+			expectErr:         true,
+		},
+		{
+			name: "Heartbeat",
+
+			accept:    "text/event-stream",
+			heartbeat: 10 * time.Millisecond,
+			stream: &fakeServerStream[wrapperspb.StringValue]{
+				delay:    35 * time.Millisecond,
+				messages: []*wrapperspb.StringValue{wrapperspb.String("foo")},
+			},
+
+			expectContains:    ": heartbeat\n\n",
+			expectContentType: ahttp.ContentTypeSSE,
+			expectCode:        http.StatusOK,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodGet, "/foo", nil)
+
+			if testCase.accept != "" {
+				ctx.Request.Header.Set("Accept", testCase.accept)
+			}
+
+			err := ahttp.ForwardServerStream(ctx, testCase.stream, testCase.heartbeat)
+			require.Equal(t, testCase.expectErr, err != nil)
+			require.Equal(t, testCase.expectCode, w.Code)
+			require.Equal(t, testCase.expectContentType, w.Header().Get("Content-Type"))
+
+			if testCase.expect != "" {
+				require.Equal(t, testCase.expect, w.Body.String())
+			}
+
+			if testCase.expectContains != "" {
+				require.Contains(t, w.Body.String(), testCase.expectContains)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package ahttp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrHijackWithTimeout = errors.New("connections cannot be hijacked under a timeout")
+
+// timeoutWriter guards the response writer while the handler runs in its own goroutine. The handler writes
+// headers to a private map, which is only copied to the response once it is committed. After the timeout
+// fired, writes from the handler are discarded.
+type timeoutWriter struct {
+	gin.ResponseWriter
+
+	// ctx is the request context. Writes are rejected as soon as its deadline is exceeded, even if the
+	// middleware did not respond yet.
+	ctx context.Context
+
+	mu        sync.Mutex
+	header    http.Header
+	status    int
+	size      int
+	committed bool
+	timedOut  bool
+}
+
+// expired must be called with the lock held.
+func (writer *timeoutWriter) expired() bool {
+	return writer.timedOut || errors.Is(writer.ctx.Err(), context.DeadlineExceeded)
+}
+
+// commit must be called with the lock held.
+func (writer *timeoutWriter) commit(now bool) {
+	if writer.committed {
+		return
+	}
+
+	writer.committed = true
+
+	for key, values := range writer.header {
+		writer.ResponseWriter.Header()[key] = values
+	}
+
+	writer.ResponseWriter.WriteHeader(writer.status)
+
+	if now {
+		writer.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (writer *timeoutWriter) Header() http.Header {
+	return writer.header
+}
+
+func (writer *timeoutWriter) WriteHeader(code int) {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	if code > 0 && !writer.committed && !writer.expired() {
+		writer.status = code
+	}
+}
+
+func (writer *timeoutWriter) WriteHeaderNow() {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	if !writer.expired() {
+		writer.commit(true)
+	}
+}
+
+func (writer *timeoutWriter) Write(data []byte) (int, error) {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	if writer.expired() {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	writer.commit(true)
+
+	n, err := writer.ResponseWriter.Write(data)
+	writer.size += n
+
+	return n, err
+}
+
+func (writer *timeoutWriter) WriteString(data string) (int, error) {
+	return writer.Write([]byte(data))
+}
+
+func (writer *timeoutWriter) Flush() {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	if !writer.expired() {
+		writer.commit(true)
+		writer.ResponseWriter.Flush()
+	}
+}
+
+func (writer *timeoutWriter) Status() int {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	return writer.status
+}
+
+func (writer *timeoutWriter) Size() int {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	if !writer.committed {
+		return -1
+	}
+
+	return writer.size
+}
+
+func (writer *timeoutWriter) Written() bool {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	return writer.committed
+}
+
+func (writer *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, ErrHijackWithTimeout
+}
+
+// timeout responds with a 504 status, unless the handler already committed its response. It reports whether
+// the response was written.
+//
+// The response is complete once flushed, so the client does not wait for the handler. The connection is closed
+// afterward, since it is only released once the handler returns.
+func (writer *timeoutWriter) timeout() bool {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	writer.timedOut = true
+
+	if writer.committed {
+		return false
+	}
+
+	writer.ResponseWriter.Header().Set("Connection", "close")
+	writeProblem(writer.ResponseWriter, problemFromStatus(status.New(codes.DeadlineExceeded, "request timed out")))
+	writer.ResponseWriter.Flush()
+
+	return true
+}
+
+// finish commits the response of a handler that completed in time, without writing the headers, so outer
+// middlewares can still update them.
+func (writer *timeoutWriter) finish() {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	if !writer.timedOut {
+		writer.commit(false)
+	}
+}
+
+// TimeoutMiddleware runs the rest of the chain with a timeout. Attach it to a route or a group to set a
+// per-route timeout.
+//
+// Unlike DeadlineMiddleware, it does not rely on the handler to honour the request context: once the timeout
+// fires, the request context is canceled, and the middleware responds with the DeadlineExceeded mapping (504)
+// if the handler did not commit a response yet. This response is complete when sent: the client gets it at the
+// deadline. Later writes from the handler are discarded, and fail with http.ErrHandlerTimeout.
+//
+// The middleware itself returns once the handler does, since gin reuses the context of a request as soon as the
+// chain returns, and the handler goroutine still holds it. Reports use the time the 504 was sent as latency.
+//
+// Response headers set by the handler are only sent when the response is committed. Connections cannot be
+// hijacked under a timeout.
+func TimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if timeout <= 0 {
+			ctx.Next()
+			return
+		}
+
+		reqCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+
+		original := ctx.Writer
+		writer := &timeoutWriter{
+			ResponseWriter: original,
+			ctx:            reqCtx,
+			header:         original.Header().Clone(),
+			status:         http.StatusOK,
+		}
+
+		ctx.Request = ctx.Request.WithContext(reqCtx)
+		ctx.Writer = writer
+
+		start := time.Now()
+		done := make(chan any, 1)
+
+		go func() {
+			defer func() {
+				done <- recover()
+			}()
+
+			ctx.Next()
+		}()
+
+		handlerDone := false
+
+		select {
+		case panicValue := <-done:
+			done <- panicValue
+			handlerDone = true
+		case <-reqCtx.Done():
+		}
+
+		if !handlerDone && errors.Is(reqCtx.Err(), context.DeadlineExceeded) {
+			responded := writer.timeout()
+			respondedAt := time.Now()
+
+			panicValue := <-done
+			ctx.Writer = original
+
+			ctx.Set(reportTimedOutKey, true)
+			ctx.Set(reportHandlerDurationKey, time.Since(start))
+
+			if responded {
+				ctx.Set(reportRespondedAtKey, respondedAt)
+				_ = ctx.Error(status.FromContextError(reqCtx.Err()).Err())
+				ctx.Abort()
+			}
+
+			if panicValue != nil {
+				panic(panicValue)
+			}
+
+			return
+		}
+
+		// Either the handler completed in time, or the client went away and there is nobody to respond to.
+		panicValue := <-done
+		ctx.Writer = original
+
+		// Panics are forwarded to the goroutine of the request, so recovery middlewares can handle them.
+		if panicValue != nil {
+			panic(panicValue)
+		}
+
+		writer.finish()
+	}
+}
@@ -0,0 +1,225 @@
+package ahttp_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a-novel-kit/quicklog"
+	quicklogmocks "github.com/a-novel-kit/quicklog/mocks"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+func TestTimeoutMiddleware(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		timeout time.Duration
+		handler func(ctx *gin.Context, lateWrite chan<- error)
+
+		expectCode      int
+		expectBody      string
+		expectHeader    string
+		expectLateWrite error
+	}{
+		{
+			name: "InTime",
+
+			timeout: time.Second,
+			handler: func(ctx *gin.Context, _ chan<- error) {
+				ctx.Header("X-Foo", "bar")
+				ctx.Status(http.StatusCreated)
+				// Headers can be set until the response is committed.
+				ctx.Header("X-Bar", "baz")
+				ctx.String(http.StatusCreated, "hello")
+			},
+
+			expectCode:   http.StatusCreated,
+			expectBody:   "hello",
+			expectHeader: "bar",
+		},
+		{
+			name: "InTime/StatusOnly",
+
+			timeout: time.Second,
+			handler: func(ctx *gin.Context, _ chan<- error) {
+				ctx.Header("X-Foo", "bar")
+				ctx.Status(http.StatusNoContent)
+			},
+
+			expectCode:   http.StatusNoContent,
+			expectHeader: "bar",
+		},
+		{
+			name: "NoTimeout",
+
+			handler: func(ctx *gin.Context, _ chan<- error) {
+				ctx.String(http.StatusOK, "hello")
+			},
+
+			expectCode: http.StatusOK,
+			expectBody: "hello",
+		},
+		{
+			name: "TimedOut",
+
+			timeout: 10 * time.Millisecond,
+			handler: func(ctx *gin.Context, lateWrite chan<- error) {
+				// The handler ignores the request context.
+				time.Sleep(50 * time.Millisecond)
+				ctx.Header("X-Foo", "bar")
+
+				_, err := ctx.Writer.WriteString("hello")
+				lateWrite <- err
+			},
+
+			expectCode: http.StatusGatewayTimeout,
+			expectBody: `{"title":"Gateway Timeout","status":504,"detail":"request timed out","code":"DeadlineExceeded"}`,
+
+			expectLateWrite: http.ErrHandlerTimeout,
+		},
+		{
+			name: "TimedOut/AlreadyCommitted",
+
+			timeout: 10 * time.Millisecond,
+			handler: func(ctx *gin.Context, lateWrite chan<- error) {
+				ctx.Header("X-Foo", "bar")
+				ctx.String(http.StatusOK, "hello")
+				<-ctx.Request.Context().Done()
+
+				_, err := ctx.Writer.WriteString(" world")
+				lateWrite <- err
+			},
+
+			expectCode:      http.StatusOK,
+			expectBody:      "hello",
+			expectHeader:    "bar",
+			expectLateWrite: http.ErrHandlerTimeout,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			lateWrite := make(chan error, 1)
+
+			router := gin.New()
+			router.GET("/foo", ahttp.TimeoutMiddleware(testCase.timeout), func(ctx *gin.Context) {
+				testCase.handler(ctx, lateWrite)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/foo", nil))
+
+			require.Equal(t, testCase.expectCode, w.Code)
+			require.Equal(t, testCase.expectBody, w.Body.String())
+			require.Equal(t, testCase.expectHeader, w.Header().Get("X-Foo"))
+
+			if testCase.expectLateWrite != nil {
+				require.ErrorIs(t, <-lateWrite, testCase.expectLateWrite)
+			}
+		})
+	}
+}
+
+func TestTimeoutMiddlewareReport(t *testing.T) {
+	logger := quicklogmocks.NewMockLogger(t)
+	logger.
+		On("Log", quicklog.LevelError, mock.Anything).
+		Run(func(args mock.Arguments) {
+			report := args.Get(1).(quicklog.Message).RenderJSON()
+			require.Equal(t, true, report["timedOut"])
+
+			latency, err := time.ParseDuration(report["httpRequest"].(map[string]interface{})["latency"].(string))
+			require.NoError(t, err)
+
+			handlerLatency, err := time.ParseDuration(report["handlerLatency"].(string))
+			require.NoError(t, err)
+
+			// The response was sent at the deadline, while the handler kept running.
+			require.Less(t, latency, 40*time.Millisecond)
+			require.GreaterOrEqual(t, handlerLatency, 50*time.Millisecond)
+		}).
+		Once()
+
+	router := gin.New()
+	router.Use(ahttp.ReportMiddleware(logger, ""))
+	router.GET("/foo", ahttp.TimeoutMiddleware(10*time.Millisecond), func(_ *gin.Context) {
+		time.Sleep(50 * time.Millisecond)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/foo", nil))
+
+	require.Equal(t, http.StatusGatewayTimeout, w.Code)
+	logger.AssertExpectations(t)
+}
+
+func TestTimeoutMiddlewarePanic(t *testing.T) {
+	router := gin.New()
+	router.Use(gin.CustomRecovery(func(ctx *gin.Context, _ any) {
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	router.GET("/foo", ahttp.TimeoutMiddleware(time.Second), func(_ *gin.Context) {
+		panic("oops")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/foo", nil))
+
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestTimeoutMiddlewareHijack(t *testing.T) {
+	router := gin.New()
+	router.GET("/foo", ahttp.TimeoutMiddleware(time.Second), func(ctx *gin.Context) {
+		_, _, err := ctx.Writer.Hijack()
+		require.True(t, errors.Is(err, ahttp.ErrHijackWithTimeout))
+		ctx.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/foo", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestTimeoutMiddlewareCompleteResponse(t *testing.T) {
+	release := make(chan struct{})
+
+	router := gin.New()
+	router.GET("/foo", ahttp.TimeoutMiddleware(20*time.Millisecond), func(_ *gin.Context) {
+		// The handler ignores the request context, and only returns once the client got the full response.
+		<-release
+	})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+	defer close(release)
+
+	// Without a complete response, reading the body would block until the handler returns.
+	client := &http.Client{Timeout: 2 * time.Second}
+	start := time.Now()
+
+	res, err := client.Get(server.URL + "/foo")
+	require.NoError(t, err)
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, http.StatusGatewayTimeout, res.StatusCode)
+	require.Equal(
+		t,
+		`{"title":"Gateway Timeout","status":504,"detail":"request timed out","code":"DeadlineExceeded"}`,
+		string(body),
+	)
+}
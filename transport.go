@@ -0,0 +1,114 @@
+package ahttp
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/a-novel-kit/quicklog"
+
+	ahttpmessages "github.com/a-novel-kit/ahttp/messages"
+)
+
+// PropagatedHeaders are copied from the incoming request to outgoing requests sent through ReportTransport, so
+// they can be correlated.
+var PropagatedHeaders = []string{
+	"X-Request-Id",
+	"X-Cloud-Trace-Context",
+	"Traceparent",
+	"Tracestate",
+}
+
+// reportContext is attached to the request context by ReportMiddleware, so outgoing requests can be reported
+// alongside the incoming one.
+type reportContext struct {
+	projectID string
+	header    http.Header
+}
+
+type reportContextKey struct{}
+
+type retryCountKey struct{}
+
+func newReportContext(ctx context.Context, projectID string, header http.Header) context.Context {
+	propagated := http.Header{}
+
+	for _, name := range PropagatedHeaders {
+		if values := header.Values(name); len(values) > 0 {
+			propagated[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+
+	return context.WithValue(ctx, reportContextKey{}, &reportContext{projectID: projectID, header: propagated})
+}
+
+// WithRetryCount sets the number of attempts that preceded an outgoing request, for reporting purposes.
+func WithRetryCount(ctx context.Context, count int) context.Context {
+	return context.WithValue(ctx, retryCountKey{}, count)
+}
+
+type reportTransport struct {
+	base   http.RoundTripper
+	logger quicklog.Logger
+}
+
+func (transport *reportTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+
+	projectID := ""
+
+	if reportCtx, ok := req.Context().Value(reportContextKey{}).(*reportContext); ok {
+		projectID = reportCtx.projectID
+
+		// A RoundTripper must not modify the original request.
+		req = req.Clone(req.Context())
+
+		for name, values := range reportCtx.header {
+			if req.Header.Get(name) == "" {
+				req.Header[name] = values
+			}
+		}
+	}
+
+	res, err := transport.base.RoundTrip(req)
+
+	retryCount, _ := req.Context().Value(retryCountKey{}).(int)
+
+	request := &ahttpmessages.OutgoingRequest{
+		Method: req.Method,
+		URL:    req.URL,
+		// The caller may reuse the request once it returns, and the report may be rendered later.
+		Header: req.Header.Clone(),
+		Err:    err,
+	}
+
+	if res != nil {
+		request.Status = res.StatusCode
+	}
+
+	transport.logger.Log(ahttpmessages.TransportReportLevel(request), ahttpmessages.NewTransportReport(
+		&ahttpmessages.TransportMetrics{
+			Latency:    time.Since(start),
+			StartedAt:  start,
+			RetryCount: retryCount,
+		},
+		projectID,
+		request,
+	))
+
+	return res, err
+}
+
+// ReportTransport logs every request sent through the base transport. If base is nil, http.DefaultTransport is
+// used.
+//
+// When the request context derives from a request handled by ReportMiddleware, the PropagatedHeaders of the
+// incoming request are forwarded, and the report is attached to the same trace. The latency covers the time
+// until the response headers are received.
+func ReportTransport(base http.RoundTripper, logger quicklog.Logger) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &reportTransport{base: base, logger: logger}
+}
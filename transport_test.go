@@ -0,0 +1,183 @@
+package ahttp_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a-novel-kit/quicklog"
+	quicklogmocks "github.com/a-novel-kit/quicklog/mocks"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+func TestReportTransport(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		upstreamStatus int
+		retryCount     int
+		closeUpstream  bool
+
+		expectLevel quicklog.Level
+		expectTrace string
+	}{
+		{
+			name: "Success",
+
+			upstreamStatus: http.StatusOK,
+
+			expectLevel: quicklog.LevelInfo,
+			expectTrace: "projects/cd/traces/abcdefg",
+		},
+		{
+			name: "ClientError",
+
+			upstreamStatus: http.StatusNotFound,
+			retryCount:     2,
+
+			expectLevel: quicklog.LevelWarning,
+			expectTrace: "projects/cd/traces/abcdefg",
+		},
+		{
+			name: "TransportError",
+
+			closeUpstream: true,
+
+			expectLevel: quicklog.LevelError,
+			expectTrace: "projects/cd/traces/abcdefg",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "abc", r.Header.Get("X-Request-Id"))
+				require.Equal(t, "abcdefg/hijklmnop", r.Header.Get("X-Cloud-Trace-Context"))
+				// Other headers are not propagated.
+				require.Empty(t, r.Header.Get("Authorization"))
+				w.WriteHeader(testCase.upstreamStatus)
+			}))
+			defer upstream.Close()
+
+			if testCase.closeUpstream {
+				upstream.Close()
+			}
+
+			transportLogger := quicklogmocks.NewMockLogger(t)
+			transportLogger.
+				On("Log", testCase.expectLevel, mock.Anything).
+				Run(func(args mock.Arguments) {
+					message := args.Get(1).(quicklog.Message)
+
+					report := message.RenderJSON()
+					require.Equal(t, testCase.expectTrace, report["logging.googleapis.com/trace"])
+					require.Equal(t, testCase.retryCount, report["retryCount"])
+					require.Equal(t, "abc", report["requestId"])
+					require.Equal(t, "/upstream", report["path"])
+					// The query holds credentials.
+					require.NotContains(t, message.RenderTerminal(), "secret")
+					require.NotContains(t, fmt.Sprint(report), "secret")
+				}).
+				Once()
+
+			logger := quicklogmocks.NewMockLogger(t)
+			logger.On("Log", mock.Anything, mock.Anything).Once()
+
+			client := &http.Client{Transport: ahttp.ReportTransport(nil, transportLogger)}
+
+			router := gin.New()
+			router.Use(ahttp.ReportMiddleware(logger, "cd"))
+			router.GET("/foo", func(ctx *gin.Context) {
+				reqCtx := ahttp.WithRetryCount(ctx.Request.Context(), testCase.retryCount)
+
+				req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, upstream.URL+"/upstream?key=secret", nil)
+				require.NoError(t, err)
+
+				res, err := client.Do(req)
+				if err == nil {
+					_ = res.Body.Close()
+				}
+
+				ctx.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/foo", nil)
+			req.Header.Set("X-Request-Id", "abc")
+			req.Header.Set("X-Cloud-Trace-Context", "abcdefg/hijklmnop")
+			req.Header.Set("Authorization", "Bearer foo")
+
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			transportLogger.AssertExpectations(t)
+			logger.AssertExpectations(t)
+		})
+	}
+}
+
+func TestReportTransportStandalone(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer upstream.Close()
+
+	logger := quicklogmocks.NewMockLogger(t)
+	logger.
+		On("Log", quicklog.LevelError, mock.Anything).
+		Run(func(args mock.Arguments) {
+			report := args.Get(1).(quicklog.Message).RenderJSON()
+			require.NotContains(t, report, "logging.googleapis.com/trace")
+			require.Equal(t, 0, report["retryCount"])
+		}).
+		Once()
+
+	client := &http.Client{Transport: ahttp.ReportTransport(http.DefaultTransport, logger)}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, upstream.URL, nil)
+	require.NoError(t, err)
+
+	res, err := client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+
+	logger.AssertExpectations(t)
+}
+
+func TestReportTransportHeaderSnapshot(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	var message quicklog.Message
+
+	logger := quicklogmocks.NewMockLogger(t)
+	logger.
+		On("Log", quicklog.LevelInfo, mock.Anything).
+		Run(func(args mock.Arguments) {
+			message = args.Get(1).(quicklog.Message)
+		}).
+		Once()
+
+	client := &http.Client{Transport: ahttp.ReportTransport(http.DefaultTransport, logger)}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, upstream.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Request-Id", "foo")
+
+	res, err := client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+
+	// The report is not affected by later changes to the request.
+	req.Header.Set("X-Request-Id", "bar")
+
+	require.Equal(t, "foo", message.RenderJSON()["requestId"])
+	logger.AssertExpectations(t)
+}
@@ -0,0 +1,89 @@
+package ahttp
+
+import (
+	"sync"
+	"time"
+)
+
+// Expired entries are removed lazily, during writes, at most once per sweep interval.
+const ttlCacheSweepInterval = time.Minute
+
+type ttlEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// ttlCache is an in-memory map whose entries expire. It backs the default in-memory stores of the package.
+type ttlCache[V any] struct {
+	mu        sync.Mutex
+	entries   map[string]ttlEntry[V]
+	lastSweep time.Time
+}
+
+func newTTLCache[V any]() *ttlCache[V] {
+	return &ttlCache[V]{
+		entries:   make(map[string]ttlEntry[V]),
+		lastSweep: time.Now(),
+	}
+}
+
+// sweep must be called with the lock held.
+func (cache *ttlCache[V]) sweep(now time.Time) {
+	if now.Sub(cache.lastSweep) < ttlCacheSweepInterval {
+		return
+	}
+
+	for key, entry := range cache.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(cache.entries, key)
+		}
+	}
+
+	cache.lastSweep = now
+}
+
+func (cache *ttlCache[V]) get(key string, now time.Time) (V, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	entry, ok := cache.entries[key]
+	if !ok || !now.Before(entry.expiresAt) {
+		var zero V
+		return zero, false
+	}
+
+	return entry.value, true
+}
+
+// update atomically replaces the value of key with the result of fn. If fn returns false, the entry is left
+// untouched.
+func (cache *ttlCache[V]) update(
+	key string, now time.Time, fn func(current V, found bool) (next V, ttl time.Duration, ok bool),
+) bool {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.sweep(now)
+
+	entry, found := cache.entries[key]
+	if found && !now.Before(entry.expiresAt) {
+		found = false
+		entry = ttlEntry[V]{}
+	}
+
+	next, ttl, ok := fn(entry.value, found)
+	if !ok {
+		return false
+	}
+
+	cache.entries[key] = ttlEntry[V]{value: next, expiresAt: now.Add(ttl)}
+
+	return true
+}
+
+func (cache *ttlCache[V]) delete(key string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	delete(cache.entries, key)
+}
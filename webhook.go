@@ -0,0 +1,358 @@
+package ahttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	DefaultWebhookTolerance = 5 * time.Minute
+	// DefaultWebhookReplayWindow is the time the nonces of webhooks with no signed timestamp are remembered for.
+	DefaultWebhookReplayWindow = 7 * 24 * time.Hour
+	DefaultWebhookMaxBodySize  = 1 << 20
+)
+
+// Default headers of GenericWebhookScheme.
+const (
+	DefaultWebhookSignatureHeader = "X-Signature"
+	DefaultWebhookTimestampHeader = "X-Signature-Timestamp"
+)
+
+var (
+	ErrMissingSignature   = errors.New("missing signature")
+	ErrMalformedSignature = errors.New("malformed signature")
+	ErrWebhookExpired     = errors.New("timestamp outside of the tolerance")
+	ErrWebhookReplayed    = errors.New("webhook replayed")
+)
+
+// WebhookSignature is the signature of a webhook, read from its headers.
+type WebhookSignature struct {
+	// Timestamp is the zero time for schemes that do not sign a timestamp.
+	Timestamp time.Time
+	// Signatures are the candidate signatures. Senders may send several, while they rotate their secret.
+	Signatures [][]byte
+}
+
+// WebhookScheme describes how a sender signs its webhooks.
+type WebhookScheme interface {
+	// Parse reads the signature of a request. It returns ErrMissingSignature or ErrMalformedSignature.
+	Parse(header http.Header) (*WebhookSignature, error)
+	// Sign returns the signature of a body, sent at timestamp.
+	Sign(secret []byte, timestamp time.Time, body []byte) []byte
+}
+
+func hmacSHA256(secret []byte, parts ...[]byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	for _, part := range parts {
+		mac.Write(part)
+	}
+
+	return mac.Sum(nil)
+}
+
+func parseUnixTimestamp(value string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: timestamp: %w", ErrMalformedSignature, err)
+	}
+
+	return time.Unix(seconds, 0), nil
+}
+
+type stripeWebhookScheme struct{}
+
+func (stripeWebhookScheme) Parse(header http.Header) (*WebhookSignature, error) {
+	value := header.Get("Stripe-Signature")
+	if value == "" {
+		return nil, ErrMissingSignature
+	}
+
+	signature := &WebhookSignature{}
+
+	for _, item := range strings.Split(value, ",") {
+		key, itemValue, _ := strings.Cut(strings.TrimSpace(item), "=")
+
+		switch key {
+		case "t":
+			timestamp, err := parseUnixTimestamp(itemValue)
+			if err != nil {
+				return nil, err
+			}
+
+			signature.Timestamp = timestamp
+		case "v1":
+			decoded, err := hex.DecodeString(itemValue)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrMalformedSignature, err)
+			}
+
+			signature.Signatures = append(signature.Signatures, decoded)
+		}
+	}
+
+	if signature.Timestamp.IsZero() || len(signature.Signatures) == 0 {
+		return nil, ErrMalformedSignature
+	}
+
+	return signature, nil
+}
+
+func (stripeWebhookScheme) Sign(secret []byte, timestamp time.Time, body []byte) []byte {
+	return hmacSHA256(secret, []byte(strconv.FormatInt(timestamp.Unix(), 10)+"."), body)
+}
+
+type gitHubWebhookScheme struct{}
+
+func (gitHubWebhookScheme) Parse(header http.Header) (*WebhookSignature, error) {
+	value := header.Get("X-Hub-Signature-256")
+	if value == "" {
+		return nil, ErrMissingSignature
+	}
+
+	encoded, ok := strings.CutPrefix(value, "sha256=")
+	if !ok {
+		return nil, ErrMalformedSignature
+	}
+
+	decoded, err := hex.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedSignature, err)
+	}
+
+	return &WebhookSignature{Signatures: [][]byte{decoded}}, nil
+}
+
+func (gitHubWebhookScheme) Sign(secret []byte, _ time.Time, body []byte) []byte {
+	return hmacSHA256(secret, body)
+}
+
+type genericWebhookScheme struct {
+	signatureHeader string
+	timestampHeader string
+}
+
+func (scheme *genericWebhookScheme) Parse(header http.Header) (*WebhookSignature, error) {
+	value, timestampValue := header.Get(scheme.signatureHeader), header.Get(scheme.timestampHeader)
+	if value == "" || timestampValue == "" {
+		return nil, ErrMissingSignature
+	}
+
+	timestamp, err := parseUnixTimestamp(timestampValue)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedSignature, err)
+	}
+
+	return &WebhookSignature{Timestamp: timestamp, Signatures: [][]byte{decoded}}, nil
+}
+
+func (scheme *genericWebhookScheme) Sign(secret []byte, timestamp time.Time, body []byte) []byte {
+	return hmacSHA256(secret, []byte(strconv.FormatInt(timestamp.Unix(), 10)+"."), body)
+}
+
+var (
+	// StripeWebhookScheme verifies the Stripe-Signature header: "t=<unix timestamp>,v1=<hex signature>", signed
+	// over "<timestamp>.<body>".
+	StripeWebhookScheme WebhookScheme = stripeWebhookScheme{}
+	// GitHubWebhookScheme verifies the X-Hub-Signature-256 header: "sha256=<hex signature>", signed over the body.
+	// It carries no timestamp, so replays are only detected while their nonce is remembered: see
+	// WebhookConfig.ReplayWindow.
+	GitHubWebhookScheme WebhookScheme = gitHubWebhookScheme{}
+)
+
+// GenericWebhookScheme verifies a hex HMAC-SHA256 signature of "<timestamp>.<body>", with the timestamp in unix
+// seconds. Empty headers default to DefaultWebhookSignatureHeader and DefaultWebhookTimestampHeader.
+func GenericWebhookScheme(signatureHeader, timestampHeader string) WebhookScheme {
+	if signatureHeader == "" {
+		signatureHeader = DefaultWebhookSignatureHeader
+	}
+
+	if timestampHeader == "" {
+		timestampHeader = DefaultWebhookTimestampHeader
+	}
+
+	return &genericWebhookScheme{signatureHeader: signatureHeader, timestampHeader: timestampHeader}
+}
+
+// WebhookNonceStore remembers the webhooks that were already received.
+type WebhookNonceStore interface {
+	// Claim remembers a nonce for ttl, and reports whether it was not remembered already.
+	Claim(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+	// Release forgets a nonce, so the webhook can be delivered again.
+	Release(ctx context.Context, nonce string) error
+}
+
+type memoryWebhookNonceStore struct {
+	cache *ttlCache[struct{}]
+}
+
+func (store *memoryWebhookNonceStore) Claim(_ context.Context, nonce string, ttl time.Duration) (bool, error) {
+	return store.cache.update(nonce, time.Now(), func(_ struct{}, found bool) (struct{}, time.Duration, bool) {
+		return struct{}{}, ttl, !found
+	}), nil
+}
+
+func (store *memoryWebhookNonceStore) Release(_ context.Context, nonce string) error {
+	store.cache.delete(nonce)
+	return nil
+}
+
+// NewMemoryWebhookNonceStore returns a WebhookNonceStore that keeps nonces in memory, until they expire. It is not
+// shared between instances of a service.
+func NewMemoryWebhookNonceStore() WebhookNonceStore {
+	return &memoryWebhookNonceStore{cache: newTTLCache[struct{}]()}
+}
+
+type WebhookConfig struct {
+	Scheme WebhookScheme
+	// Secrets verify the signatures. A signature is valid if it matches any of them, so secrets can be rotated.
+	Secrets [][]byte
+
+	// Tolerance is the maximum difference between the timestamp of a webhook and the time it is received.
+	// Defaults to DefaultWebhookTolerance.
+	Tolerance time.Duration
+	// ReplayWindow is the time nonces are remembered for, for schemes with no signed timestamp. Those webhooks
+	// can be replayed once it elapsed. Defaults to DefaultWebhookReplayWindow.
+	ReplayWindow time.Duration
+	// Nonces defaults to an in-memory store, which does not survive restarts. Nonces of timestamped webhooks are
+	// remembered for twice the tolerance, which covers the whole window of accepted timestamps.
+	Nonces WebhookNonceStore
+
+	// MaxBodySize limits the body read before the signature is verified. Larger webhooks are rejected with a 413
+	// status. Defaults to DefaultWebhookMaxBodySize.
+	MaxBodySize int64
+}
+
+// verifyWebhook returns the signature of the webhook that matches one of the secrets, and the time its nonce
+// must be remembered for.
+func verifyWebhook(
+	config WebhookConfig, header http.Header, body []byte, now time.Time,
+) ([]byte, time.Duration, error) {
+	signature, err := config.Scheme.Parse(header)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	nonceTTL := config.ReplayWindow
+
+	if !signature.Timestamp.IsZero() {
+		if delta := now.Sub(signature.Timestamp); delta > config.Tolerance || delta < -config.Tolerance {
+			return nil, 0, ErrWebhookExpired
+		}
+
+		nonceTTL = 2 * config.Tolerance
+	}
+
+	for _, secret := range config.Secrets {
+		expected := config.Scheme.Sign(secret, signature.Timestamp, body)
+
+		for _, candidate := range signature.Signatures {
+			if hmac.Equal(expected, candidate) {
+				return expected, nonceTTL, nil
+			}
+		}
+	}
+
+	return nil, 0, ErrInvalidSignature
+}
+
+// webhookErrorMessage returns the public message of a verification error. Details, such as which part of the
+// signature failed to parse, are only reported.
+func webhookErrorMessage(err error) string {
+	for _, sentinel := range []error{ErrMissingSignature, ErrMalformedSignature, ErrWebhookExpired} {
+		if errors.Is(err, sentinel) {
+			return sentinel.Error()
+		}
+	}
+
+	return ErrInvalidSignature.Error()
+}
+
+// WebhookMiddleware verifies the signature of incoming webhooks, over their raw body. Each webhook is accepted
+// once: its signature, which is unique to its timestamp and body, is used as a nonce. Delivery IDs sent by some
+// schemes, such as the X-GitHub-Delivery header, are not used, since they are not signed. The nonce is released
+// when the handler fails with a 5xx status, so the sender can retry.
+//
+// Invalid webhooks are rejected with a 401 status. The body remains readable by the handler, and is also cached
+// in gin for the ShouldBindBodyWith methods.
+//
+// It panics if config has no Scheme.
+func WebhookMiddleware(config WebhookConfig) gin.HandlerFunc {
+	if config.Scheme == nil {
+		panic("ahttp: WebhookConfig.Scheme is required")
+	}
+
+	if config.Tolerance <= 0 {
+		config.Tolerance = DefaultWebhookTolerance
+	}
+
+	if config.ReplayWindow <= 0 {
+		config.ReplayWindow = DefaultWebhookReplayWindow
+	}
+
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = DefaultWebhookMaxBodySize
+	}
+
+	if config.Nonces == nil {
+		config.Nonces = NewMemoryWebhookNonceStore()
+	}
+
+	return func(ctx *gin.Context) {
+		body, err := readBodyWithLimit(ctx.Request, config.MaxBodySize)
+		if err != nil {
+			HandleGRPCErrorProblem(ctx, err)
+			return
+		}
+
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+		ctx.Set(gin.BodyBytesKey, body)
+
+		signature, nonceTTL, err := verifyWebhook(config, ctx.Request.Header, body, time.Now())
+		if err != nil {
+			HandleGRPCErrorProblem(ctx, status.Error(codes.Unauthenticated, webhookErrorMessage(err)))
+			_ = ctx.Error(err)
+
+			return
+		}
+
+		nonce := hex.EncodeToString(signature)
+
+		claimed, err := config.Nonces.Claim(ctx.Request.Context(), nonce, nonceTTL)
+		if err != nil {
+			HandleGRPCErrorProblem(ctx, err)
+			return
+		}
+
+		if !claimed {
+			HandleGRPCErrorProblem(ctx, status.Error(codes.Unauthenticated, ErrWebhookReplayed.Error()))
+			return
+		}
+
+		ctx.Next()
+
+		if ctx.Writer.Status() >= http.StatusInternalServerError {
+			if err := config.Nonces.Release(context.WithoutCancel(ctx.Request.Context()), nonce); err != nil {
+				_ = ctx.Error(err)
+			}
+		}
+	}
+}
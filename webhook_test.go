@@ -0,0 +1,520 @@
+package ahttp_test
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/a-novel-kit/quicklog"
+	quicklogmocks "github.com/a-novel-kit/quicklog/mocks"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+const webhookBody = `{"type":"invoice.paid"}`
+
+func stripeSignature(secret string, timestamp time.Time, body string) string {
+	signature := ahttp.StripeWebhookScheme.Sign([]byte(secret), timestamp, []byte(body))
+	return fmt.Sprintf("t=%d,v1=%s", timestamp.Unix(), hex.EncodeToString(signature))
+}
+
+func newWebhookRouter(config ahttp.WebhookConfig, status int) *gin.Engine {
+	router := gin.New()
+	router.POST("/webhook", ahttp.WebhookMiddleware(config), func(ctx *gin.Context) {
+		var event struct {
+			Type string `json:"type"`
+		}
+
+		// The body can be read twice, once raw and once bound.
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil || ctx.ShouldBindBodyWith(&event, binding.JSON) != nil {
+			ctx.Status(http.StatusInternalServerError)
+			return
+		}
+
+		ctx.String(status, "%s %s", event.Type, body)
+	})
+
+	return router
+}
+
+func TestWebhookMiddleware(t *testing.T) {
+	now := time.Now()
+	secret := hex.EncodeToString([]byte("whsec_test"))
+
+	testCases := []struct {
+		name string
+
+		scheme  ahttp.WebhookScheme
+		secrets []string
+		headers map[string]string
+
+		expectCode   int
+		expectDetail string
+	}{
+		{
+			name: "Stripe",
+
+			scheme:  ahttp.StripeWebhookScheme,
+			headers: map[string]string{"Stripe-Signature": stripeSignature(secret, now, webhookBody)},
+
+			expectCode: http.StatusOK,
+		},
+		{
+			name: "StripeSenderRotation",
+
+			scheme: ahttp.StripeWebhookScheme,
+			headers: map[string]string{
+				"Stripe-Signature": stripeSignature(secret, now, webhookBody) + ",v1=" +
+					hex.EncodeToString(ahttp.StripeWebhookScheme.Sign([]byte("old"), now, []byte(webhookBody))) +
+					",v0=foo",
+			},
+
+			expectCode: http.StatusOK,
+		},
+		{
+			name: "StripeReceiverRotation",
+
+			scheme:  ahttp.StripeWebhookScheme,
+			secrets: []string{"new", secret},
+			headers: map[string]string{"Stripe-Signature": stripeSignature(secret, now, webhookBody)},
+
+			expectCode: http.StatusOK,
+		},
+		{
+			name: "StripeWrongSecret",
+
+			scheme:  ahttp.StripeWebhookScheme,
+			headers: map[string]string{"Stripe-Signature": stripeSignature("foo", now, webhookBody)},
+
+			expectCode:   http.StatusUnauthorized,
+			expectDetail: "invalid signature",
+		},
+		{
+			name: "StripeTamperedBody",
+
+			scheme:  ahttp.StripeWebhookScheme,
+			headers: map[string]string{"Stripe-Signature": stripeSignature(secret, now, `{"type":"invoice.void"}`)},
+
+			expectCode:   http.StatusUnauthorized,
+			expectDetail: "invalid signature",
+		},
+		{
+			name: "StripeTamperedTimestamp",
+
+			scheme: ahttp.StripeWebhookScheme,
+			headers: map[string]string{
+				"Stripe-Signature": strings.Replace(
+					stripeSignature(secret, now, webhookBody),
+					"t="+strconv.FormatInt(now.Unix(), 10), "t="+strconv.FormatInt(now.Unix()-1, 10), 1,
+				),
+			},
+
+			expectCode:   http.StatusUnauthorized,
+			expectDetail: "invalid signature",
+		},
+		{
+			name: "StripeExpired",
+
+			scheme:  ahttp.StripeWebhookScheme,
+			headers: map[string]string{"Stripe-Signature": stripeSignature(secret, now.Add(-6*time.Minute), webhookBody)},
+
+			expectCode:   http.StatusUnauthorized,
+			expectDetail: "timestamp outside of the tolerance",
+		},
+		{
+			name: "StripeFuture",
+
+			scheme:  ahttp.StripeWebhookScheme,
+			headers: map[string]string{"Stripe-Signature": stripeSignature(secret, now.Add(6*time.Minute), webhookBody)},
+
+			expectCode:   http.StatusUnauthorized,
+			expectDetail: "timestamp outside of the tolerance",
+		},
+		{
+			name: "StripeMissing",
+
+			scheme: ahttp.StripeWebhookScheme,
+
+			expectCode:   http.StatusUnauthorized,
+			expectDetail: "missing signature",
+		},
+		{
+			name: "StripeMalformed",
+
+			scheme:  ahttp.StripeWebhookScheme,
+			headers: map[string]string{"Stripe-Signature": "t=foo,v1=bar"},
+
+			expectCode:   http.StatusUnauthorized,
+			expectDetail: "malformed signature",
+		},
+		{
+			name: "StripeNoSignature",
+
+			scheme:  ahttp.StripeWebhookScheme,
+			headers: map[string]string{"Stripe-Signature": fmt.Sprintf("t=%d", now.Unix())},
+
+			expectCode:   http.StatusUnauthorized,
+			expectDetail: "malformed signature",
+		},
+		{
+			name: "GitHub",
+
+			scheme: ahttp.GitHubWebhookScheme,
+			headers: map[string]string{
+				"X-Hub-Signature-256": "sha256=" + hex.EncodeToString(
+					ahttp.GitHubWebhookScheme.Sign([]byte(secret), time.Time{}, []byte(webhookBody)),
+				),
+			},
+
+			expectCode: http.StatusOK,
+		},
+		{
+			name: "GitHubWrongSecret",
+
+			scheme: ahttp.GitHubWebhookScheme,
+			headers: map[string]string{
+				"X-Hub-Signature-256": "sha256=" + hex.EncodeToString(
+					ahttp.GitHubWebhookScheme.Sign([]byte("foo"), time.Time{}, []byte(webhookBody)),
+				),
+			},
+
+			expectCode:   http.StatusUnauthorized,
+			expectDetail: "invalid signature",
+		},
+		{
+			name: "GitHubMalformed",
+
+			scheme:  ahttp.GitHubWebhookScheme,
+			headers: map[string]string{"X-Hub-Signature-256": "sha1=foo"},
+
+			expectCode:   http.StatusUnauthorized,
+			expectDetail: "malformed signature",
+		},
+		{
+			name: "Generic",
+
+			scheme: ahttp.GenericWebhookScheme("", ""),
+			headers: map[string]string{
+				ahttp.DefaultWebhookSignatureHeader: hex.EncodeToString(
+					ahttp.GenericWebhookScheme("", "").Sign([]byte(secret), now, []byte(webhookBody)),
+				),
+				ahttp.DefaultWebhookTimestampHeader: strconv.FormatInt(now.Unix(), 10),
+			},
+
+			expectCode: http.StatusOK,
+		},
+		{
+			name: "GenericMissingTimestamp",
+
+			scheme: ahttp.GenericWebhookScheme("", ""),
+			headers: map[string]string{
+				ahttp.DefaultWebhookSignatureHeader: hex.EncodeToString(
+					ahttp.GenericWebhookScheme("", "").Sign([]byte(secret), now, []byte(webhookBody)),
+				),
+			},
+
+			expectCode:   http.StatusUnauthorized,
+			expectDetail: "missing signature",
+		},
+		{
+			name: "GenericCustomHeaders",
+
+			scheme: ahttp.GenericWebhookScheme("X-Mailer-Signature", "X-Mailer-Timestamp"),
+			headers: map[string]string{
+				"X-Mailer-Signature": hex.EncodeToString(
+					ahttp.GenericWebhookScheme("", "").Sign([]byte(secret), now, []byte(webhookBody)),
+				),
+				"X-Mailer-Timestamp": strconv.FormatInt(now.Unix(), 10),
+			},
+
+			expectCode: http.StatusOK,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			secrets := testCase.secrets
+			if secrets == nil {
+				secrets = []string{secret}
+			}
+
+			config := ahttp.WebhookConfig{Scheme: testCase.scheme}
+			for _, secret := range secrets {
+				config.Secrets = append(config.Secrets, []byte(secret))
+			}
+
+			router := newWebhookRouter(config, http.StatusOK)
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(webhookBody))
+			for key, value := range testCase.headers {
+				req.Header.Set(key, value)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, testCase.expectCode, w.Code)
+
+			if testCase.expectDetail == "" {
+				require.Equal(t, "invoice.paid "+webhookBody, w.Body.String())
+				return
+			}
+
+			require.Equal(t, ahttp.ContentTypeProblem, w.Header().Get("Content-Type"))
+			var problem ahttp.Problem
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			require.Equal(t, testCase.expectDetail, problem.Detail)
+			require.NotContains(t, w.Body.String(), secret)
+		})
+	}
+}
+
+func TestWebhookMiddlewareReplay(t *testing.T) {
+	const secret = "whsec_test"
+
+	testCases := []struct {
+		name string
+
+		handlerStatus int
+
+		expectRetryCode int
+	}{
+		{
+			name: "Replayed",
+
+			handlerStatus: http.StatusOK,
+
+			expectRetryCode: http.StatusUnauthorized,
+		},
+		{
+			// Failed deliveries can be retried.
+			name: "HandlerFailed",
+
+			handlerStatus: http.StatusServiceUnavailable,
+
+			expectRetryCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router := newWebhookRouter(ahttp.WebhookConfig{
+				Scheme:  ahttp.StripeWebhookScheme,
+				Secrets: [][]byte{[]byte(secret)},
+			}, testCase.handlerStatus)
+
+			signature := stripeSignature(secret, time.Now(), webhookBody)
+
+			send := func() *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(webhookBody))
+				req.Header.Set("Stripe-Signature", signature)
+
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				return w
+			}
+
+			require.Equal(t, testCase.handlerStatus, send().Code)
+
+			w := send()
+			require.Equal(t, testCase.expectRetryCode, w.Code)
+
+			if testCase.expectRetryCode == http.StatusUnauthorized {
+				require.Contains(t, w.Body.String(), "webhook replayed")
+			}
+		})
+	}
+}
+
+// ttlRecorder is a WebhookNonceStore that records the time nonces are remembered for.
+type ttlRecorder struct {
+	ahttp.WebhookNonceStore
+
+	ttl time.Duration
+}
+
+func (recorder *ttlRecorder) Claim(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	recorder.ttl = ttl
+	return recorder.WebhookNonceStore.Claim(ctx, nonce, ttl)
+}
+
+func TestWebhookMiddlewareReplayWindow(t *testing.T) {
+	const secret = "whsec_test"
+
+	testCases := []struct {
+		name string
+
+		scheme  ahttp.WebhookScheme
+		headers map[string]string
+
+		expectTTL time.Duration
+	}{
+		{
+			name: "Timestamped",
+
+			scheme:  ahttp.StripeWebhookScheme,
+			headers: map[string]string{"Stripe-Signature": stripeSignature(secret, time.Now(), webhookBody)},
+
+			expectTTL: 2 * time.Minute,
+		},
+		{
+			// Without a timestamp, the nonce is the only protection against replays.
+			name: "NoTimestamp",
+
+			scheme: ahttp.GitHubWebhookScheme,
+			headers: map[string]string{
+				"X-Hub-Signature-256": "sha256=" + hex.EncodeToString(
+					ahttp.GitHubWebhookScheme.Sign([]byte(secret), time.Time{}, []byte(webhookBody)),
+				),
+			},
+
+			expectTTL: ahttp.DefaultWebhookReplayWindow,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			nonces := &ttlRecorder{WebhookNonceStore: ahttp.NewMemoryWebhookNonceStore()}
+
+			router := newWebhookRouter(ahttp.WebhookConfig{
+				Scheme:    testCase.scheme,
+				Secrets:   [][]byte{[]byte(secret)},
+				Tolerance: time.Minute,
+				Nonces:    nonces,
+			}, http.StatusOK)
+
+			send := func(deliveryID string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(webhookBody))
+				for key, value := range testCase.headers {
+					req.Header.Set(key, value)
+				}
+
+				req.Header.Set("X-GitHub-Delivery", deliveryID)
+
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				return w
+			}
+
+			require.Equal(t, http.StatusOK, send("1").Code)
+			require.Equal(t, testCase.expectTTL, nonces.ttl)
+
+			// The delivery ID is not signed, so changing it does not bypass the replay protection.
+			require.Equal(t, http.StatusUnauthorized, send("2").Code)
+		})
+	}
+}
+
+func TestWebhookMiddlewareBodyLimit(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		bodyLimit   ahttp.BodyLimitConfig
+		maxBodySize int64
+		body        io.Reader
+	}{
+		{
+			name: "BodyLimitMiddleware",
+
+			bodyLimit: ahttp.BodyLimitConfig{Limit: 8},
+			body:      io.NopCloser(strings.NewReader(webhookBody)),
+		},
+		{
+			name: "MaxBodySize",
+
+			maxBodySize: 8,
+			body:        strings.NewReader(webhookBody),
+		},
+		{
+			name: "MaxBodySize/UnknownLength",
+
+			maxBodySize: 8,
+			body:        io.NopCloser(strings.NewReader(webhookBody)),
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			router := gin.New()
+			router.POST(
+				"/webhook",
+				ahttp.BodyLimitMiddleware(testCase.bodyLimit),
+				ahttp.WebhookMiddleware(ahttp.WebhookConfig{
+					Scheme:      ahttp.StripeWebhookScheme,
+					Secrets:     [][]byte{[]byte("whsec_test")},
+					MaxBodySize: testCase.maxBodySize,
+				}),
+				func(ctx *gin.Context) {
+					ctx.Status(http.StatusOK)
+				},
+			)
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", testCase.body)
+			req.Header.Set("Stripe-Signature", stripeSignature("whsec_test", time.Now(), webhookBody))
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		})
+	}
+}
+
+func TestWebhookMiddlewareNoScheme(t *testing.T) {
+	require.Panics(t, func() {
+		ahttp.WebhookMiddleware(ahttp.WebhookConfig{Secrets: [][]byte{[]byte("whsec_test")}})
+	})
+}
+
+func TestWebhookMiddlewareReport(t *testing.T) {
+	const secret = "whsec_test"
+
+	logger := quicklogmocks.NewMockLogger(t)
+	logger.
+		On("Log", quicklog.LevelWarning, mock.Anything).
+		Run(func(args mock.Arguments) {
+			message := args.Get(1).(quicklog.Message)
+
+			report := message.RenderJSON()
+			require.Equal(t, []string{
+				"rpc error: code = Unauthenticated desc = invalid signature",
+				"invalid signature",
+			}, report["errors"])
+			require.NotContains(t, message.RenderTerminal(), secret)
+		}).
+		Once()
+
+	router := gin.New()
+	router.Use(ahttp.ReportMiddleware(logger, ""))
+	router.POST("/webhook", ahttp.WebhookMiddleware(ahttp.WebhookConfig{
+		Scheme:  ahttp.StripeWebhookScheme,
+		Secrets: [][]byte{[]byte(secret)},
+	}), func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(webhookBody))
+	req.Header.Set("Stripe-Signature", stripeSignature("foo", time.Now(), webhookBody))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	logger.AssertExpectations(t)
+}
@@ -0,0 +1,274 @@
+package ahttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	ahttpmessages "github.com/a-novel-kit/ahttp/messages"
+)
+
+const (
+	DefaultWebSocketPingInterval = 30 * time.Second
+	DefaultWebSocketWriteTimeout = 10 * time.Second
+)
+
+// Close reasons are limited to 123 bytes, so the close frame fits in a single control frame.
+const maxCloseReasonSize = 123
+
+var rpcToWebSocketCloseCodes = map[codes.Code]int{
+	codes.OK:                websocket.CloseNormalClosure,
+	codes.Canceled:          websocket.CloseGoingAway,
+	codes.InvalidArgument:   websocket.CloseInvalidFramePayloadData,
+	codes.PermissionDenied:  websocket.ClosePolicyViolation,
+	codes.Unauthenticated:   websocket.ClosePolicyViolation,
+	codes.ResourceExhausted: websocket.CloseTryAgainLater,
+	codes.Unavailable:       websocket.CloseTryAgainLater,
+}
+
+func GRPCToWebSocketCloseCode(code codes.Code) int {
+	if c, ok := rpcToWebSocketCloseCodes[code]; ok {
+		return c
+	}
+
+	return websocket.CloseInternalServerErr
+}
+
+type WebSocketConfig struct {
+	// Upgrader used to upgrade the HTTP connection. Uses the default gorilla upgrader if nil, which rejects
+	// cross-origin requests.
+	Upgrader *websocket.Upgrader
+
+	// ReadLimit is the maximum size of a message sent by the client. Zero means no limit.
+	ReadLimit int64
+	// PingInterval is the interval between two keepalive pings. The connection is closed if the client does not
+	// answer within two intervals. Defaults to DefaultWebSocketPingInterval.
+	PingInterval time.Duration
+	// WriteTimeout is the maximum time allowed to write a message to the client. Defaults to
+	// DefaultWebSocketWriteTimeout.
+	WriteTimeout time.Duration
+}
+
+type webSocketBridge[Req, Res any] struct {
+	conn   *websocket.Conn
+	stream grpc.BidiStreamingClient[Req, Res]
+	config WebSocketConfig
+
+	// Receives the decoding error of an invalid client frame, before the stream is cancelled.
+	invalidFrame chan error
+
+	metrics struct {
+		in, out atomic.Int64
+	}
+}
+
+// readLoop forwards client frames to the stream, until the client closes the connection or the stream is
+// terminated.
+func (bridge *webSocketBridge[Req, Res]) readLoop(cancel context.CancelFunc) {
+	for {
+		_, data, err := bridge.conn.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				// Graceful close: let the server terminate the stream on its own terms.
+				_ = bridge.stream.CloseSend()
+				return
+			}
+
+			// The connection is broken, there is no point in waiting for the server.
+			cancel()
+
+			return
+		}
+
+		bridge.metrics.in.Add(1)
+
+		msg := new(Req)
+		if err := unmarshalStreamMessage(data, msg); err != nil {
+			bridge.invalidFrame <- err
+
+			cancel()
+
+			return
+		}
+
+		// Send blocks while the server is not ready to receive more messages, which in turn stops reading
+		// from the client.
+		if err := bridge.stream.Send(msg); err != nil {
+			// io.EOF means the server terminated the stream: its status is returned by Recv.
+			if !errors.Is(err, io.EOF) {
+				cancel()
+			}
+
+			return
+		}
+	}
+}
+
+// pingLoop sends keepalive pings until done is closed.
+func (bridge *webSocketBridge[Req, Res]) pingLoop(done <-chan struct{}) {
+	ticker := time.NewTicker(bridge.config.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			deadline := time.Now().Add(bridge.config.WriteTimeout)
+			if err := bridge.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeLoop forwards stream messages to the client, and returns the error that terminated the stream.
+func (bridge *webSocketBridge[Req, Res]) writeLoop() error {
+	for {
+		msg, err := bridge.stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return err
+		}
+
+		data, err := marshalStreamMessage(msg)
+		if err != nil {
+			return err
+		}
+
+		_ = bridge.conn.SetWriteDeadline(time.Now().Add(bridge.config.WriteTimeout))
+		if err := bridge.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			return err
+		}
+
+		bridge.metrics.out.Add(1)
+	}
+}
+
+func (bridge *webSocketBridge[Req, Res]) close(code int, reason string) {
+	if len(reason) > maxCloseReasonSize {
+		reason = reason[:maxCloseReasonSize]
+	}
+
+	deadline := time.Now().Add(bridge.config.WriteTimeout)
+	_ = bridge.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+}
+
+// BridgeWebSocket upgrades the request to a WebSocket connection, and pipes JSON frames to and from a
+// bidirectional gRPC stream. Protobuf messages use the protojson mapping.
+//
+// The stream is opened with a context derived from the request, that is cancelled when the connection breaks.
+// If it cannot be opened, the error is handled by HandleGRPCErrorProblem and the connection is not upgraded.
+//
+// When the client closes the connection, the sending side of the stream is closed. When the stream terminates,
+// the connection is closed with a code derived from its final status (see GRPCToWebSocketCloseCode).
+//
+// Message counts and the close code are reported by ReportMiddleware.
+func BridgeWebSocket[Req, Res any](
+	ctx *gin.Context,
+	open func(ctx context.Context) (grpc.BidiStreamingClient[Req, Res], error),
+	config WebSocketConfig,
+) error {
+	if config.Upgrader == nil {
+		config.Upgrader = &websocket.Upgrader{}
+	}
+
+	if config.PingInterval <= 0 {
+		config.PingInterval = DefaultWebSocketPingInterval
+	}
+
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = DefaultWebSocketWriteTimeout
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx.Request.Context())
+	defer cancel()
+
+	stream, err := open(streamCtx)
+	if err != nil {
+		HandleGRPCErrorProblem(ctx, err)
+		return err
+	}
+
+	conn, err := config.Upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		// The upgrader already replied with an HTTP error.
+		_ = ctx.Error(err)
+		return err
+	}
+	defer conn.Close()
+
+	bridge := &webSocketBridge[Req, Res]{
+		conn:         conn,
+		stream:       stream,
+		config:       config,
+		invalidFrame: make(chan error, 1),
+	}
+	metrics := &ahttpmessages.WebSocketMetrics{}
+
+	defer func() {
+		metrics.MessagesIn = bridge.metrics.in.Load()
+		metrics.MessagesOut = bridge.metrics.out.Load()
+		ctx.Set(reportWebSocketKey, metrics)
+	}()
+
+	if config.ReadLimit > 0 {
+		conn.SetReadLimit(config.ReadLimit)
+	}
+
+	// The default handler echoes the close frame right away. Instead, the connection is closed once the stream
+	// terminates, with a code that reflects its final status.
+	conn.SetCloseHandler(func(int, string) error { return nil })
+
+	// A client that misses two pings in a row is considered gone.
+	_ = conn.SetReadDeadline(time.Now().Add(2 * config.PingInterval))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * config.PingInterval))
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go bridge.pingLoop(done)
+
+	go bridge.readLoop(cancel)
+
+	streamErr := bridge.writeLoop()
+
+	// An invalid client frame takes precedence over the cancellation it caused.
+	select {
+	case err := <-bridge.invalidFrame:
+		metrics.CloseCode = websocket.CloseInvalidFramePayloadData
+		bridge.close(metrics.CloseCode, err.Error())
+		_ = ctx.Error(err)
+
+		return err
+	default:
+	}
+
+	grpcStatus, ok := statusFromError(streamErr)
+	if streamErr != nil && !ok {
+		metrics.CloseCode = websocket.CloseInternalServerErr
+	} else {
+		metrics.CloseCode = GRPCToWebSocketCloseCode(grpcStatus.Code())
+	}
+
+	if streamErr != nil {
+		_ = ctx.Error(streamErr)
+	}
+
+	bridge.close(metrics.CloseCode, grpcStatus.Message())
+
+	return streamErr
+}
@@ -0,0 +1,233 @@
+package ahttp_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/a-novel-kit/quicklog"
+	quicklogmocks "github.com/a-novel-kit/quicklog/mocks"
+
+	"github.com/a-novel-kit/ahttp"
+)
+
+// fakeBidiStream echoes messages in upper case. Once the client closes its side, the stream terminates with err.
+type fakeBidiStream struct {
+	grpc.ClientStream
+
+	ctx      context.Context
+	messages chan *wrapperspb.StringValue
+	err      error
+}
+
+func (stream *fakeBidiStream) Send(msg *wrapperspb.StringValue) error {
+	select {
+	case stream.messages <- wrapperspb.String(strings.ToUpper(msg.GetValue())):
+		return nil
+	case <-stream.ctx.Done():
+		return io.EOF
+	}
+}
+
+func (stream *fakeBidiStream) CloseSend() error {
+	close(stream.messages)
+	return nil
+}
+
+func (stream *fakeBidiStream) Recv() (*wrapperspb.StringValue, error) {
+	select {
+	case msg, ok := <-stream.messages:
+		if !ok {
+			if stream.err != nil {
+				return nil, stream.err
+			}
+
+			return nil, io.EOF
+		}
+
+		return msg, nil
+	case <-stream.ctx.Done():
+		return nil, status.FromContextError(stream.ctx.Err()).Err()
+	}
+}
+
+func TestGRPCToWebSocketCloseCode(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		in codes.Code
+
+		expect int
+	}{
+		{name: "OK", in: codes.OK, expect: 1000},
+		{name: "Canceled", in: codes.Canceled, expect: 1001},
+		{name: "InvalidArgument", in: codes.InvalidArgument, expect: 1007},
+		{name: "PermissionDenied", in: codes.PermissionDenied, expect: 1008},
+		{name: "Unauthenticated", in: codes.Unauthenticated, expect: 1008},
+		{name: "ResourceExhausted", in: codes.ResourceExhausted, expect: 1013},
+		{name: "Unavailable", in: codes.Unavailable, expect: 1013},
+		{name: "Default", in: codes.Internal, expect: 1011},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.expect, ahttp.GRPCToWebSocketCloseCode(testCase.in))
+		})
+	}
+}
+
+func TestBridgeWebSocket(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		openErr   error
+		streamErr error
+		send      []string
+
+		expectStatus     int
+		expectReceived   []string
+		expectCloseCode  int
+		expectLevel      quicklog.Level
+		expectReportCode int
+	}{
+		{
+			name: "Echo",
+
+			send: []string{`"foo"`, `"bar"`},
+
+			expectStatus:     http.StatusSwitchingProtocols,
+			expectReceived:   []string{`"FOO"`, `"BAR"`},
+			expectCloseCode:  websocket.CloseNormalClosure,
+			expectLevel:      quicklog.LevelInfo,
+			expectReportCode: websocket.CloseNormalClosure,
+		},
+		{
+			name: "StreamError",
+
+			streamErr: status.Error(codes.Unavailable, "gone"),
+			send:      []string{`"foo"`},
+
+			expectStatus:     http.StatusSwitchingProtocols,
+			expectReceived:   []string{`"FOO"`},
+			expectCloseCode:  websocket.CloseTryAgainLater,
+			expectLevel:      quicklog.LevelError,
+			expectReportCode: websocket.CloseTryAgainLater,
+		},
+		{
+			name: "InvalidFrame",
+
+			send: []string{`"foo"`, `{not json`},
+
+			expectStatus:     http.StatusSwitchingProtocols,
+			expectReceived:   []string{`"FOO"`},
+			expectCloseCode:  websocket.CloseInvalidFramePayloadData,
+			expectLevel:      quicklog.LevelWarning,
+			expectReportCode: websocket.CloseInvalidFramePayloadData,
+		},
+		{
+			name: "OpenError",
+
+			openErr: status.Error(codes.NotFound, "not found"),
+
+			expectStatus: http.StatusNotFound,
+			expectLevel:  quicklog.LevelWarning,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			logged := make(chan map[string]interface{}, 1)
+
+			logger := quicklogmocks.NewMockLogger(t)
+			logger.
+				On("Log", testCase.expectLevel, mock.Anything).
+				Run(func(args mock.Arguments) {
+					logged <- args.Get(1).(quicklog.Message).RenderJSON()
+				}).
+				Once()
+
+			router := gin.New()
+			router.Use(ahttp.ReportMiddleware(logger, ""))
+			router.GET("/ws", func(ctx *gin.Context) {
+				_ = ahttp.BridgeWebSocket(
+					ctx,
+					func(streamCtx context.Context) (grpc.BidiStreamingClient[wrapperspb.StringValue, wrapperspb.StringValue], error) {
+						if testCase.openErr != nil {
+							return nil, testCase.openErr
+						}
+
+						return &fakeBidiStream{
+							ctx:      streamCtx,
+							messages: make(chan *wrapperspb.StringValue, 10),
+							err:      testCase.streamErr,
+						}, nil
+					},
+					ahttp.WebSocketConfig{},
+				)
+			})
+
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			conn, res, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+			require.Equal(t, testCase.expectStatus, res.StatusCode)
+			_ = res.Body.Close()
+
+			if testCase.expectStatus == http.StatusSwitchingProtocols {
+				require.NoError(t, err)
+
+				for _, msg := range testCase.send {
+					require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(msg)))
+				}
+
+				var received []string
+
+				for range testCase.expectReceived {
+					_, data, err := conn.ReadMessage()
+					require.NoError(t, err)
+
+					received = append(received, string(data))
+				}
+
+				require.Equal(t, testCase.expectReceived, received)
+
+				_ = conn.WriteMessage(
+					websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				)
+
+				_, _, err = conn.ReadMessage()
+
+				var closeErr *websocket.CloseError
+				require.True(t, errors.As(err, &closeErr))
+				require.Equal(t, testCase.expectCloseCode, closeErr.Code)
+
+				_ = conn.Close()
+			}
+
+			select {
+			case report := <-logged:
+				if testCase.expectReportCode != 0 {
+					require.Equal(t, http.StatusSwitchingProtocols, report["httpRequest"].(map[string]interface{})["status"])
+					require.Equal(t, testCase.expectReportCode, report["websocket"].(map[string]interface{})["closeCode"])
+				}
+			case <-time.After(time.Second):
+				t.Fatal("report was not logged")
+			}
+		})
+	}
+}